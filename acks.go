@@ -0,0 +1,222 @@
+package reacter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/executil"
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+var DefaultAckFile = executil.RootOrString(`/var/lib/reacter/acks.json`, `~/.local/share/reacter/acks.json`)
+var ErrNotAcknowledged = fmt.Errorf("Check is not acknowledged")
+
+// An Acknowledgement records that someone is aware of (and presumably working on) an alerting
+// check.  Non-sticky acknowledgements are cleared whenever the check changes state; sticky ones
+// remain until the check recovers.  Either kind is removed once it expires.
+type Acknowledgement struct {
+	NodeName  string           `json:"node"`
+	CheckName string           `json:"check"`
+	Author    string           `json:"author"`
+	Comment   string           `json:"comment,omitempty"`
+	Sticky    bool             `json:"sticky"`
+	State     ObservationState `json:"state"`
+	CreatedAt time.Time        `json:"created_at"`
+	ExpiresAt *time.Time       `json:"expires_at,omitempty"`
+}
+
+func (self *Acknowledgement) Key() string {
+	return fmt.Sprintf("%s:%s", self.NodeName, self.CheckName)
+}
+
+func (self *Acknowledgement) IsExpired() bool {
+	return (self.ExpiresAt != nil && time.Now().After(*self.ExpiresAt))
+}
+
+// An AckStore holds acknowledgements and persists them to a file.  Because the file is re-read
+// whenever it changes, several processes (e.g.: "reacter check", "reacter handle", and
+// "reacter ack") can share the same store.
+type AckStore struct {
+	Filename string
+	acks     map[string]*Acknowledgement
+	modtime  time.Time
+	lock     sync.Mutex
+}
+
+func NewAckStore(filename string) *AckStore {
+	return &AckStore{
+		Filename: filename,
+		acks:     make(map[string]*Acknowledgement),
+	}
+}
+
+// Records the given acknowledgement, replacing any existing one for the same check.
+func (self *AckStore) Acknowledge(ack *Acknowledgement) error {
+	if ack.NodeName == `` || ack.CheckName == `` {
+		return fmt.Errorf("An acknowledgement must specify both a node and a check")
+	}
+
+	if ack.CreatedAt.IsZero() {
+		ack.CreatedAt = time.Now()
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.reload()
+	self.acks[ack.Key()] = ack
+
+	log.Noticef("Check %s acknowledged by %s", ack.Key(), ack.Author)
+	return self.save()
+}
+
+// Removes the acknowledgement for the given check, returning ErrNotAcknowledged if there isn't one.
+func (self *AckStore) Remove(nodeName string, checkName string) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.reload()
+	key := fmt.Sprintf("%s:%s", nodeName, checkName)
+
+	if _, ok := self.acks[key]; ok {
+		delete(self.acks, key)
+		log.Noticef("Acknowledgement for check %s removed", key)
+		return self.save()
+	}
+
+	return ErrNotAcknowledged
+}
+
+// Returns the current acknowledgement for the given check, or nil if there isn't one.
+func (self *AckStore) Get(nodeName string, checkName string) *Acknowledgement {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.reload()
+
+	if ack, ok := self.acks[fmt.Sprintf("%s:%s", nodeName, checkName)]; ok && !ack.IsExpired() {
+		return ack
+	}
+
+	return nil
+}
+
+// Returns all current acknowledgements.
+func (self *AckStore) List() []*Acknowledgement {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.reload()
+	acks := make([]*Acknowledgement, 0, len(self.acks))
+
+	for _, ack := range self.acks {
+		if !ack.IsExpired() {
+			acks = append(acks, ack)
+		}
+	}
+
+	sort.Slice(acks, func(i int, j int) bool {
+		return acks[i].Key() < acks[j].Key()
+	})
+
+	return acks
+}
+
+// Updates the acknowledgement for the given check based on its current state, clearing it if the
+// check has recovered, changed state (for non-sticky acknowledgements), or the acknowledgement
+// expired.  The check's Acknowledgement field is set to the result.
+func (self *AckStore) Observe(check *Check) *Acknowledgement {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.reload()
+	key := fmt.Sprintf("%s:%s", check.NodeName, check.Name)
+	check.Acknowledgement = nil
+
+	if ack, ok := self.acks[key]; ok {
+		var reason string
+
+		if ack.IsExpired() {
+			reason = `it expired`
+		} else if check.IsOK() {
+			reason = `the check recovered`
+		} else if ack.State == SuccessState {
+			//  acknowledged without knowing the state (e.g.: from the command line); adopt the
+			//  current one so that non-sticky acknowledgements can detect changes
+			ack.State = check.State
+			self.save()
+		} else if !ack.Sticky && ack.State != check.State {
+			reason = fmt.Sprintf("the check changed state from %v to %v", ack.State, check.State)
+		}
+
+		if reason != `` {
+			log.Infof("Clearing acknowledgement for check %s because %s", key, reason)
+			delete(self.acks, key)
+			self.save()
+		} else {
+			check.Acknowledgement = ack
+		}
+	}
+
+	return check.Acknowledgement
+}
+
+func (self *AckStore) reload() {
+	if self.Filename == `` {
+		return
+	}
+
+	filename := fileutil.MustExpandUser(self.Filename)
+
+	if stat, err := os.Stat(filename); err == nil {
+		if stat.ModTime().Equal(self.modtime) {
+			return
+		}
+
+		if data, err := ioutil.ReadFile(filename); err == nil {
+			acks := make(map[string]*Acknowledgement)
+
+			if err := json.Unmarshal(data, &acks); err == nil {
+				self.acks = acks
+				self.modtime = stat.ModTime()
+			} else {
+				log.Warningf("Failed to parse acknowledgements file %s: %v", filename, err)
+			}
+		} else {
+			log.Warningf("Failed to read acknowledgements file %s: %v", filename, err)
+		}
+	}
+}
+
+func (self *AckStore) save() error {
+	if self.Filename == `` {
+		return nil
+	}
+
+	filename := fileutil.MustExpandUser(self.Filename)
+
+	if data, err := json.MarshalIndent(self.acks, ``, `  `); err == nil {
+		if err := os.MkdirAll(path.Dir(filename), 0755); err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+			return err
+		}
+
+		if stat, err := os.Stat(filename); err == nil {
+			self.modtime = stat.ModTime()
+		}
+
+		return nil
+	} else {
+		return err
+	}
+}
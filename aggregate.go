@@ -0,0 +1,191 @@
+package reacter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/go-stockutil/sliceutil"
+	"github.com/ghetzel/go-stockutil/typeutil"
+)
+
+// An EventGroup is attached to events that a handler received as part of a group.  It contains
+// every event that was aggregated into the group.
+type EventGroup struct {
+	Key     string       `json:"key"`
+	Members []CheckEvent `json:"members"`
+}
+
+// Returns the key this handler uses to group the given event.  Each group_by field is one of
+// "check", "node", or "state"; a Go template (evaluated against the event); or the name of one of
+// the check's parameters.
+func (self *Handler) GroupKey(event CheckEvent) string {
+	fields := sliceutil.Stringify(self.GroupBy)
+	parts := make([]string, 0, len(fields))
+
+	for _, field := range fields {
+		switch field {
+		case `check`:
+			parts = append(parts, event.Check.Name)
+		case `node`:
+			parts = append(parts, event.Check.NodeName)
+		case `state`:
+			parts = append(parts, event.Check.StateString())
+		default:
+			if strings.Contains(field, `{{`) {
+				if tmpl, err := template.New(self.Name).Parse(field); err == nil {
+					var out bytes.Buffer
+
+					if err := tmpl.Execute(&out, event); err == nil {
+						parts = append(parts, out.String())
+					} else {
+						log.Warningf("Handler '%s' group_by template failed: %v", self.Name, err)
+						parts = append(parts, ``)
+					}
+				} else {
+					log.Warningf("Handler '%s' has an invalid group_by template: %v", self.Name, err)
+					parts = append(parts, ``)
+				}
+			} else {
+				parts = append(parts, typeutil.String(event.Check.Parameters[field]))
+			}
+		}
+	}
+
+	return strings.Join(parts, `/`)
+}
+
+// Whether this handler aggregates events into groups before executing.
+func (self *Handler) IsGrouped() bool {
+	return !typeutil.IsEmpty(self.GroupBy) && duration(self.GroupWait) > 0
+}
+
+type pendingGroup struct {
+	handler *Handler
+	group   *EventGroup
+	timer   *time.Timer
+}
+
+// The Aggregator collects events destined for grouping handlers and executes each handler once per
+// group after its group_wait window has elapsed.
+type Aggregator struct {
+	router *EventRouter
+	groups map[string]*pendingGroup
+	lock   sync.Mutex
+}
+
+func NewAggregator(router *EventRouter) *Aggregator {
+	return &Aggregator{
+		router: router,
+		groups: make(map[string]*pendingGroup),
+	}
+}
+
+// Adds an event to the appropriate group for the given handler, starting that group's window if
+// it is the first member.  Later events for a check that is already in the group replace it.
+func (self *Aggregator) Add(handler *Handler, event CheckEvent) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	key := handler.GroupKey(event)
+	id := handler.Name + "\x00" + key
+
+	if pending, ok := self.groups[id]; ok {
+		for i, member := range pending.group.Members {
+			if member.Check.NodeName == event.Check.NodeName && member.Check.Name == event.Check.Name {
+				pending.group.Members[i] = event
+				return
+			}
+		}
+
+		pending.group.Members = append(pending.group.Members, event)
+	} else {
+		wait := duration(handler.GroupWait)
+
+		log.Debugf("Handler '%s' is grouping events for %q for %v", handler.Name, key, wait)
+
+		self.groups[id] = &pendingGroup{
+			handler: handler,
+			group: &EventGroup{
+				Key:     key,
+				Members: []CheckEvent{event},
+			},
+			timer: time.AfterFunc(wait, func() {
+				self.flush(id)
+			}),
+		}
+	}
+}
+
+// Immediately executes all pending groups.
+func (self *Aggregator) Flush() {
+	self.lock.Lock()
+	ids := make([]string, 0, len(self.groups))
+
+	for id, pending := range self.groups {
+		pending.timer.Stop()
+		ids = append(ids, id)
+	}
+
+	self.lock.Unlock()
+
+	for _, id := range ids {
+		self.flush(id)
+	}
+}
+
+func (self *Aggregator) flush(id string) {
+	self.lock.Lock()
+	pending, ok := self.groups[id]
+	delete(self.groups, id)
+	self.lock.Unlock()
+
+	if ok {
+		self.router.execute(pending.handler, pending.group.Event())
+	}
+}
+
+// Returns a single event representing the whole group.  Its check is the group member in the
+// worst state, and its output summarizes every member.
+func (self *EventGroup) Event() CheckEvent {
+	var event CheckEvent
+	var lines []string
+
+	for i, member := range self.Members {
+		if i == 0 || stateSeverity(member.Check.State) > stateSeverity(event.Check.State) {
+			event = member
+		}
+
+		line := fmt.Sprintf("%s/%s [%s]", member.Check.NodeName, member.Check.Name, member.Check.StateString())
+
+		if member.Output != `` {
+			line += `: ` + strings.Replace(member.Output, "\n", ` `, -1)
+		}
+
+		lines = append(lines, line)
+	}
+
+	event.Output = strings.Join(lines, "\n")
+	event.Observation = nil
+	event.Group = self
+
+	return event
+}
+
+// ranks states so that critical outranks unknown, which outranks warning and OK.
+func stateSeverity(state ObservationState) int {
+	switch state {
+	case SuccessState:
+		return 0
+	case WarningState:
+		return 1
+	case CriticalState:
+		return 3
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,122 @@
+package reacter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func groupMember(node string, name string, state ObservationState, output string) CheckEvent {
+	check := NewCheck()
+	check.NodeName = node
+	check.Name = name
+	check.State = state
+	check.Parameters[`rack`] = `r1`
+
+	return CheckEvent{
+		Check:  check,
+		Output: output,
+	}
+}
+
+func TestHandlerGroupKey(t *testing.T) {
+	event := groupMember(`web1`, `ping`, CriticalState, ``)
+
+	for _, tt := range []struct {
+		groupBy interface{}
+		key     string
+	}{
+		{`check`, `ping`},
+		{`node`, `web1`},
+		{[]string{`check`, `state`}, `ping/critical`},
+		{[]string{`check`, `rack`}, `ping/r1`},
+		{`{{ .Check.NodeName }}-{{ .Check.Name }}`, `web1-ping`},
+		{`missing`, ``},
+	} {
+		handler := &Handler{
+			Name:    `test`,
+			GroupBy: tt.groupBy,
+		}
+
+		if key := handler.GroupKey(event); key != tt.key {
+			t.Errorf("group_by %v: expected %q, got %q", tt.groupBy, tt.key, key)
+		}
+	}
+}
+
+func TestEventGroupEvent(t *testing.T) {
+	group := &EventGroup{
+		Key: `ping`,
+		Members: []CheckEvent{
+			groupMember(`web1`, `ping`, WarningState, `slow`),
+			groupMember(`web2`, `ping`, CriticalState, "down\nhard"),
+			groupMember(`web3`, `ping`, UnknownState, ``),
+		},
+	}
+
+	event := group.Event()
+
+	if event.Check.NodeName != `web2` {
+		t.Errorf("expected the critical member to represent the group, got %s", event.Check.NodeName)
+	}
+
+	if expected := "web1/ping [warning]: slow\nweb2/ping [critical]: down hard\nweb3/ping [unknown]"; event.Output != expected {
+		t.Errorf("unexpected summary:\n%s", event.Output)
+	}
+
+	if event.Group != group {
+		t.Errorf("event does not reference its group")
+	}
+}
+
+func TestGroupedHandlerReceivesMembers(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `reacter-aggregate`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, `stdin.json`)
+	group := &EventGroup{
+		Key: `ping`,
+		Members: []CheckEvent{
+			groupMember(`web1`, `ping`, CriticalState, `down`),
+			groupMember(`web2`, `ping`, WarningState, `slow`),
+		},
+	}
+
+	handler := &Handler{
+		Name:    `grouped`,
+		Command: []string{`sh`, `-c`, `cat > ` + output},
+	}
+
+	if err := handler.Execute(group.Event()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(output)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var members []CheckEvent
+
+	if err := json.Unmarshal(data, &members); err != nil {
+		t.Fatalf("handler input is not a JSON array of events: %v: %s", err, data)
+	}
+
+	if len(members) != 2 {
+		t.Fatalf("expected 2 members, got %d", len(members))
+	}
+
+	for i, member := range members {
+		if expected := group.Members[i]; member.Check == nil || member.Check.NodeName != expected.Check.NodeName || member.Check.State != expected.Check.State || member.Output != expected.Output {
+			t.Errorf("member %d: expected %s [%v] %q, got %+v", i, expected.Check.NodeName, expected.Check.State, expected.Output, member)
+		}
+	}
+}
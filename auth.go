@@ -0,0 +1,170 @@
+package reacter
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/ghetzel/go-stockutil/httputil"
+)
+
+// Whether every request (not just those that modify state) must be authenticated.
+func (self *Server) requiresAuth() bool {
+	return self.Username != `` || self.ClientCAFile != ``
+}
+
+type contextKey string
+
+// Set on requests received through the control socket.
+const localRequestKey contextKey = `local`
+
+// Whether the given request was received through the control socket, or presents a verified client
+// certificate, valid basic credentials, or the bearer token.
+func (self *Server) authenticated(req *http.Request) bool {
+	if local, ok := req.Context().Value(localRequestKey).(bool); ok && local {
+		return true
+	}
+
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		return true
+	}
+
+	if username, password, ok := req.BasicAuth(); ok && self.Username != `` {
+		userOk := subtle.ConstantTimeCompare([]byte(username), []byte(self.Username))
+		passOk := subtle.ConstantTimeCompare([]byte(password), []byte(self.Password))
+
+		if userOk&passOk == 1 {
+			return true
+		}
+	}
+
+	if self.Token != `` {
+		if token := req.Header.Get(`Authorization`); strings.HasPrefix(token, `Bearer `) {
+			if subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(token, `Bearer `)), []byte(self.Token)) == 1 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (self *Server) unauthorized(w http.ResponseWriter) {
+	if self.Username != `` {
+		w.Header().Set(`WWW-Authenticate`, `Basic realm="reacter"`)
+	} else {
+		w.Header().Set(`WWW-Authenticate`, `Bearer realm="reacter"`)
+	}
+
+	httputil.RespondJSON(w, fmt.Errorf("Unauthorized"), http.StatusUnauthorized)
+}
+
+// Middleware that rejects unauthenticated requests when basic credentials or a client CA are
+// configured.
+func (self *Server) authenticate(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	if self.requiresAuth() && !self.authenticated(req) {
+		self.unauthorized(w)
+		return
+	}
+
+	next(w, req)
+}
+
+// Wraps the given handler so that, if a Token is set, requests must present it (or be otherwise
+// authenticated.)
+func (self *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if self.Token != `` && !self.authenticated(req) {
+			self.unauthorized(w)
+			return
+		}
+
+		handler(w, req)
+	}
+}
+
+// Whether the server is configured to serve HTTPS.
+func (self *Server) TLSEnabled() bool {
+	return self.CertFile != `` && self.KeyFile != ``
+}
+
+func (self *Server) clientCAs() (*x509.CertPool, error) {
+	if self.ClientCAFile == `` {
+		return nil, nil
+	}
+
+	if data, err := ioutil.ReadFile(self.ClientCAFile); err == nil {
+		pool := x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", self.ClientCAFile)
+		}
+
+		return pool, nil
+	} else {
+		return nil, err
+	}
+}
+
+// Returns the TLS configuration for serving requests.  If a client CA is given, clients that
+// present a certificate signed by it are authenticated without needing any other credentials.
+func (self *Server) serverTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if pool, err := self.clientCAs(); err == nil && pool != nil {
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	} else if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Returns the TLS configuration for requests this server makes to its peers.  Peers are verified
+// against the client CA (if given), and are presented with this server's certificate so that they
+// can verify us in turn.
+func (self *Server) peerTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if pool, err := self.clientCAs(); err == nil && pool != nil {
+		config.RootCAs = pool
+	} else if err != nil {
+		return nil, err
+	}
+
+	if self.TLSEnabled() {
+		if cert, err := tls.LoadX509KeyPair(self.CertFile, self.KeyFile); err == nil {
+			config.Certificates = []tls.Certificate{cert}
+		} else {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+// Returns the headers that authenticate requests this server makes to its peers.
+func (self *Server) peerHeaders() http.Header {
+	headers := make(http.Header)
+
+	if self.Username != `` {
+		req := &http.Request{
+			Header: headers,
+		}
+
+		req.SetBasicAuth(self.Username, self.Password)
+	} else if self.Token != `` {
+		headers.Set(`Authorization`, `Bearer `+self.Token)
+	}
+
+	return headers
+}
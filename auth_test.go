@@ -0,0 +1,82 @@
+package reacter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerAuthentication(t *testing.T) {
+	basic := func(username string, password string) func(req *http.Request) {
+		return func(req *http.Request) {
+			req.SetBasicAuth(username, password)
+		}
+	}
+
+	bearer := func(token string) func(req *http.Request) {
+		return func(req *http.Request) {
+			req.Header.Set(`Authorization`, `Bearer `+token)
+		}
+	}
+
+	local := func(req *http.Request) *http.Request {
+		return req.WithContext(context.WithValue(req.Context(), localRequestKey, true))
+	}
+
+	for _, tt := range []struct {
+		name        string
+		server      Server
+		credentials func(req *http.Request)
+		local       bool
+		read        int
+		write       int
+	}{
+		{`no auth`, Server{}, nil, false, http.StatusOK, http.StatusNotFound},
+		{`token without credentials`, Server{Token: `s3cr3t`}, nil, false, http.StatusOK, http.StatusUnauthorized},
+		{`token`, Server{Token: `s3cr3t`}, bearer(`s3cr3t`), false, http.StatusOK, http.StatusNotFound},
+		{`wrong token`, Server{Token: `s3cr3t`}, bearer(`guess`), false, http.StatusOK, http.StatusUnauthorized},
+		{`token as basic password`, Server{Token: `s3cr3t`}, basic(`ops`, `s3cr3t`), false, http.StatusOK, http.StatusUnauthorized},
+		{`basic without credentials`, Server{Username: `ops`, Password: `hunter2`}, nil, false, http.StatusUnauthorized, http.StatusUnauthorized},
+		{`basic`, Server{Username: `ops`, Password: `hunter2`}, basic(`ops`, `hunter2`), false, http.StatusOK, http.StatusNotFound},
+		{`wrong password`, Server{Username: `ops`, Password: `hunter2`}, basic(`ops`, `guess`), false, http.StatusUnauthorized, http.StatusUnauthorized},
+		{`basic and token`, Server{Username: `ops`, Password: `hunter2`, Token: `s3cr3t`}, bearer(`s3cr3t`), false, http.StatusOK, http.StatusNotFound},
+		{`control socket`, Server{Username: `ops`, Password: `hunter2`, Token: `s3cr3t`}, nil, true, http.StatusOK, http.StatusNotFound},
+	} {
+		server := tt.server
+		server.reacter = NewReacter()
+		router := server.apiRouter()
+
+		handler := func(w http.ResponseWriter, req *http.Request) {
+			server.authenticate(w, req, router.ServeHTTP)
+		}
+
+		for _, request := range []struct {
+			method string
+			path   string
+			status int
+		}{
+			{`GET`, `/reacter/v1/node`, tt.read},
+			{`PUT`, `/reacter/v1/checks/missing/disable`, tt.write},
+		} {
+			req := httptest.NewRequest(request.method, request.path, nil)
+
+			if tt.credentials != nil {
+				tt.credentials(req)
+			}
+
+			if tt.local {
+				req = local(req)
+			}
+
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			if w.Code != request.status {
+				t.Errorf("%s: %s %s: expected %d, got %d", tt.name, request.method, request.path, request.status, w.Code)
+			} else if w.Code == http.StatusUnauthorized && w.Header().Get(`WWW-Authenticate`) == `` {
+				t.Errorf("%s: %s %s: expected a WWW-Authenticate header", tt.name, request.method, request.path)
+			}
+		}
+	}
+}
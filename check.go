@@ -1,8 +1,6 @@
 package reacter
 
 import (
-	"bufio"
-	"bytes"
 	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
@@ -20,41 +18,74 @@ import (
 
 var DefaultCheckInterval = 60
 var DefaultCheckTimeout = 10000
+var DefaultSubmitTimeout = 5 * time.Second
 
 type Check struct {
-	UID               string                 `json:"id"`
-	NodeName          string                 `json:"node_name"`
-	Name              string                 `json:"name"`
-	Command           interface{}            `json:"command"`
-	Timeout           interface{}            `json:"timeout"`
-	Enabled           bool                   `json:"enabled"`
-	State             ObservationState       `json:"state"`
-	HardState         bool                   `json:"hard"`
-	StateChanged      bool                   `json:"changed"`
-	Parameters        map[string]interface{} `json:"parameters"`
-	Environment       map[string]string      `json:"environment"`
-	Directory         string                 `json:"directory,omitempty"`
-	Interval          interface{}            `json:"interval"`
-	FlapThresholdHigh float64                `json:"flap_threshold_high"`
-	FlapThresholdLow  float64                `json:"flap_threshold_low"`
-	Rise              int                    `json:"rise"`
-	Fall              int                    `json:"fall"`
-	Observations      *Observations          `json:"observations"`
-	EventStream       chan CheckEvent        `json:"-"`
-	StopMonitorC      chan bool              `json:"-"`
+	UID                string                 `json:"id"`
+	NodeName           string                 `json:"node_name"`
+	Name               string                 `json:"name"`
+	Command            interface{}            `json:"command"`
+	Timeout            interface{}            `json:"timeout"`
+	Enabled            bool                   `json:"enabled"`
+	State              ObservationState       `json:"state"`
+	HardState          bool                   `json:"hard"`
+	StateChanged       bool                   `json:"changed"`
+	Parameters         map[string]interface{} `json:"parameters"`
+	Environment        Values                 `json:"environment"`
+	Redact             []string               `json:"redact,omitempty"`
+	Directory          string                 `json:"directory,omitempty"`
+	Interval           interface{}            `json:"interval"`
+	FlapThresholdHigh  float64                `json:"flap_threshold_high"`
+	FlapThresholdLow   float64                `json:"flap_threshold_low"`
+	Rise               int                    `json:"rise"`
+	Fall               int                    `json:"fall"`
+	Passive            bool                   `json:"passive,omitempty"`
+	FreshnessThreshold interface{}            `json:"freshness_threshold,omitempty"`
+	LastObservedAt     time.Time              `json:"last_observed_at"`
+	Stale              bool                   `json:"stale,omitempty"`
+	Observations       *Observations          `json:"observations"`
+	HistorySize        int                    `json:"history_size,omitempty"`
+	History            *History               `json:"-"`
+	Acknowledgement    *Acknowledgement       `json:"ack,omitempty"`
+	EventStream        chan CheckEvent        `json:"-"`
+	StopMonitorC       chan bool              `json:"-"`
+	redactor           *Redactor
+	controlC           chan checkControl
 }
 
 type CheckEvent struct {
-	Check       *Check       `json:"check"`
-	Observation *Observation `json:"observation,omitempty"`
-	Output      string       `json:"output,omitempty"`
-	Error       bool         `json:"error,omitempty"`
-	Timestamp   time.Time    `json:"timestamp"`
+	Check           *Check       `json:"check,omitempty"`
+	Observation     *Observation `json:"observation,omitempty"`
+	Output          string       `json:"output,omitempty"`
+	Error           bool         `json:"error,omitempty"`
+	Timestamp       time.Time    `json:"timestamp"`
+	EscalationLevel int          `json:"escalation_level,omitempty"`
+	Group           *EventGroup  `json:"group,omitempty"`
+	Heartbeat       *Heartbeat   `json:"heartbeat,omitempty"`
+}
+
+type checkControl struct {
+	fn      func() error
+	reply   chan checkReply
+	execute bool
+}
+
+type checkReply struct {
+	check *Check
+	err   error
+}
+
+// A CheckResult is the result of a passive check, submitted by whatever performed it.
+type CheckResult struct {
+	Status   int    `json:"status"`
+	Output   string `json:"output"`
+	PerfData string `json:"perfdata,omitempty"`
 }
 
 func NewCheck() *Check {
 	return &Check{
 		Observations: NewObservations(),
+		History:      NewHistory(DefaultHistorySize),
 		Timeout:      DefaultCheckTimeout,
 		Enabled:      true,
 		HardState:    true,
@@ -63,9 +94,10 @@ func NewCheck() *Check {
 		Rise:         1,
 		Fall:         1,
 		Parameters:   make(map[string]interface{}),
-		Environment:  make(map[string]string),
+		Environment:  make(Values),
 		Interval:     DefaultCheckInterval,
 		StopMonitorC: make(chan bool),
+		controlC:     make(chan checkControl),
 	}
 }
 
@@ -92,6 +124,10 @@ func (self *Check) IsOK() bool {
 	return (self.State == SuccessState)
 }
 
+func (self *Check) IsAcknowledged() bool {
+	return (self.Acknowledgement != nil && !self.Acknowledgement.IsExpired())
+}
+
 func (self *Check) ID() string {
 	idStr := fmt.Sprintf("%s:%d:%s", self.NodeName, os.Getpid(), self.Name)
 	hash := sha1.Sum([]byte(idStr[:]))
@@ -114,141 +150,232 @@ func (self *Check) cmdline() ([]string, error) {
 	}
 }
 
+// Executes the check's command and updates the state of the check with its result.  Disabled
+// checks are not executed.
 func (self *Check) Execute() (Observation, error) {
+	if self.Enabled {
+		return self.execute()
+	} else {
+		self.UID = self.ID()
+		return Observation{}, fmt.Errorf("Cannot execute check '%s': check is disabled", self.Name)
+	}
+}
+
+// Executes the check's command regardless of whether the check is enabled.
+func (self *Check) execute() (Observation, error) {
 	self.UID = self.ID()
 
-	if self.Enabled {
-		if args, err := self.cmdline(); err == nil {
-			var output []byte
-			var err error
-			var exitStatus int
+	if args, err := self.cmdline(); err == nil {
+		var output []byte
+		var err error
+		var exitStatus int
 
-			errchan := make(chan error)
+		//  references to secrets are resolved on every execution, so changes to them take effect
+		//  without reloading
+		environment, err := self.Environment.Resolve()
 
-			go func() {
-				var err error
-				log.Debugf("Executing check '%s': %s", self.Name, args)
-				cmd := exec.Command(args[0], args[1:]...)
+		if err != nil {
+			return Observation{}, fmt.Errorf("Error resolving the environment of check '%s': %v", self.Name, err)
+		}
 
-				if self.Directory != `` {
-					cmd.Dir = self.Directory
-				}
+		errchan := make(chan error)
 
-				//  pass in environment variables
-				for k, v := range self.Environment {
-					cmd.Env = append(cmd.Env, k+`=`+v)
-				}
+		go func() {
+			var err error
+			log.Debugf("Executing check '%s': %v", self.Name, self.redactor.CheckCommand(self))
+			cmd := exec.Command(args[0], args[1:]...)
 
-				output, err = cmd.Output()
-				errchan <- err
-			}()
+			if self.Directory != `` {
+				cmd.Dir = self.Directory
+			}
 
-			//  wait for the command to complete or the Timeout, whichever comes first
-			select {
-			case err = <-errchan:
-				log.Debugf("Check '%s' execution complete", self.Name)
-			case <-time.After(duration(self.Timeout)):
-				return Observation{}, fmt.Errorf("Timed out after %v waiting for the command to execute", duration(self.Timeout))
+			//  pass in environment variables
+			for k, v := range environment {
+				cmd.Env = append(cmd.Env, k+`=`+v)
 			}
 
-			if err == nil {
-				exitStatus = 0
-			} else {
-				if exiterr, ok := err.(*exec.ExitError); ok {
-					if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-						exitStatus = status.ExitStatus()
-					} else {
-						log.Errorf("Error running check '%s': unknown exit status", self.Name)
-						exitStatus = 3
-					}
+			output, err = cmd.Output()
+			errchan <- err
+		}()
+
+		//  wait for the command to complete or the Timeout, whichever comes first
+		select {
+		case err = <-errchan:
+			log.Debugf("Check '%s' execution complete", self.Name)
+		case <-time.After(duration(self.Timeout)):
+			return Observation{}, fmt.Errorf("Timed out after %v waiting for the command to execute", duration(self.Timeout))
+		}
+
+		if err == nil {
+			exitStatus = 0
+		} else {
+			if exiterr, ok := err.(*exec.ExitError); ok {
+				if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+					exitStatus = status.ExitStatus()
 				} else {
-					return Observation{}, fmt.Errorf("Error running check '%s': %v", self.Name, err)
+					log.Errorf("Error running check '%s': unknown exit status", self.Name)
+					exitStatus = 3
 				}
+			} else {
+				return Observation{}, fmt.Errorf("Error running check '%s': %v", self.Name, err)
 			}
+		}
 
-			//  build observation
-			observation := Observation{
-				Timestamp:       time.Now(),
-				PerformanceData: make(map[string]Measurement),
-			}
+		return self.observe(NewObservation(exitStatus, output))
+	} else {
+		self.Enabled = false
+		return Observation{}, fmt.Errorf("Cannot execute check '%s': %v; disabling check", self.Name, err)
+	}
+}
 
-			observation.SetState(exitStatus)
-
-			//  add STDOUT lines
-			outputScanner := bufio.NewScanner(bytes.NewReader(output))
-
-			for outputScanner.Scan() {
-				line := outputScanner.Text()
-				parts := strings.SplitN(line, `|`, 2)
-
-				observation.Output = append(observation.Output, strings.TrimSpace(parts[0]))
-
-				if len(parts) > 1 {
-					for _, measurement := range strings.Split(strings.TrimSpace(parts[1]), ` `) {
-						kv := strings.SplitN(measurement, `=`, 2)
-						if len(kv) == 2 {
-							values := strings.Split(kv[1], `;`)
-							if len(values) >= 5 {
-								m := Measurement{}
-								m.SetValues(values[0], values[1], values[2], values[3], values[4])
-								observation.PerformanceData[kv[0]] = m
-							}
-						}
-					}
-				}
+// Saves the given observation and updates the state of the check based on it and the rise/fall
+// parameters.
+func (self *Check) observe(observation Observation) (Observation, error) {
+	if err := self.Observations.Push(observation); err != nil {
+		return observation, fmt.Errorf("Failed to save observation for check '%s': %v", self.Name, err)
+	} else {
+		self.LastObservedAt = observation.Timestamp
+		self.Stale = false
+
+		//  set the current state of the check based on observation
+		//  results and rise/fall parameters
+
+		//  currently failed; check if the last observation makes us pass
+		if self.Rise > 1 && self.State != SuccessState {
+			if self.IsRisen() {
+				self.State = SuccessState
+				self.StateChanged = true
+			} else {
+				self.StateChanged = false
 			}
 
-			if err := self.Observations.Push(observation); err != nil {
-				return observation, fmt.Errorf("Failed to save observation for check '%s': %v", self.Name, err)
+			//  currently okay; check if the last observation makes us fail
+		} else if self.Fall > 1 && self.State == SuccessState {
+			if self.IsFallen() {
+				self.State = observation.State
+				self.StateChanged = true
 			} else {
-				//  set the current state of the check based on observation
-				//  results and rise/fall parameters
-
-				//  currently failed; check if the last observation makes us pass
-				if self.Rise > 1 && self.State != SuccessState {
-					if self.IsRisen() {
-						self.State = SuccessState
-						self.StateChanged = true
-					} else {
-						self.StateChanged = false
-					}
-
-					//  currently okay; check if the last observation makes us fail
-				} else if self.Fall > 1 && self.State == SuccessState {
-					if self.IsFallen() {
-						self.State = observation.State
-						self.StateChanged = true
-					} else {
-						self.StateChanged = false
-					}
-
-					//  rise/fall are both 1; just set check state to the latest observation state
-				} else {
-					self.State = observation.State
+				self.StateChanged = false
+			}
 
-					if len(self.Observations.Values) > 1 {
-						self.StateChanged = (self.Observations.Values[len(self.Observations.Values)-2].State != observation.State)
-					}
-				}
+			//  rise/fall are both 1; just set check state to the latest observation state
+		} else {
+			self.State = observation.State
 
-				return observation, nil
+			if len(self.Observations.Values) > 1 {
+				self.StateChanged = (self.Observations.Values[len(self.Observations.Values)-2].State != observation.State)
 			}
+		}
 
-		} else {
-			self.Enabled = false
-			return Observation{}, fmt.Errorf("Cannot execute check '%s': %v; disabling check", self.Name, err)
+		return observation, nil
+	}
+}
+
+// Submits a passively-obtained result for this check.  The result is processed by the check's
+// monitor exactly like the result of executing the check's command.
+func (self *Check) Submit(result CheckResult) error {
+	output := result.Output
+
+	if result.PerfData != `` {
+		output += ` | ` + result.PerfData
+	}
+
+	observation := NewObservation(result.Status, []byte(output))
+
+	_, err := self.control(func() error {
+		if !self.Enabled {
+			return fmt.Errorf("Cannot submit result for check '%s': check is disabled", self.Name)
 		}
-	} else {
-		return Observation{}, fmt.Errorf("Cannot execute check '%s': check is disabled", self.Name)
+
+		self.push(self.observe(observation))
+		return nil
+	}, false)
+
+	return err
+}
+
+// Immediately executes the check (outside of its regular interval) and emits the result.  Returns
+// a copy of the check as it was before executing.
+func (self *Check) RunNow() (*Check, error) {
+	return self.control(func() error {
+		if !self.Enabled {
+			return fmt.Errorf("Cannot execute check '%s': check is disabled", self.Name)
+		} else if self.Passive {
+			return fmt.Errorf("Cannot execute check '%s': check is passive", self.Name)
+		}
+
+		return nil
+	}, true)
+}
+
+// Enables or disables the check.  Disabled checks are not executed, and reject submitted results.
+// Returns a copy of the updated check.
+func (self *Check) SetEnabled(enabled bool) (*Check, error) {
+	return self.control(func() error {
+		if enabled != self.Enabled {
+			self.Enabled = enabled
+
+			if enabled {
+				//  the time spent disabled doesn't count towards the freshness threshold
+				self.LastObservedAt = time.Now()
+				log.Noticef("Check '%s' enabled", self.Name)
+			} else {
+				log.Noticef("Check '%s' disabled", self.Name)
+			}
+		}
+
+		return nil
+	}, false)
+}
+
+// Changes how often the check is executed.  The new interval takes effect immediately.  Returns a
+// copy of the updated check.
+func (self *Check) SetInterval(interval time.Duration) (*Check, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("Interval must be a positive duration")
 	}
+
+	return self.control(func() error {
+		log.Noticef("Check '%s' will now execute every %v", self.Name, interval)
+		self.Interval = interval
+		return nil
+	}, false)
 }
 
-func (self *Check) executeAndPush() {
-	var event CheckEvent
+// Runs the given function from the check's monitor, where it can safely modify the check, then
+// (optionally, and only if the function succeeded) executes the check.  Returns a copy of the check
+// taken by the monitor after the function ran, which can be read while the monitor goes on
+// updating the check.
+func (self *Check) control(fn func() error, execute bool) (*Check, error) {
+	reply := make(chan checkReply, 1)
+
+	select {
+	case self.controlC <- checkControl{fn: fn, reply: reply, execute: execute}:
+		result := <-reply
+		return result.check, result.err
+	case <-time.After(DefaultSubmitTimeout):
+		return nil, fmt.Errorf("Timed out updating check '%s'; is it being monitored?", self.Name)
+	}
+}
+
+// Returns a copy of the check that is safe to read from other goroutines.  Everything the monitor
+// modifies in place is copied; the remaining fields are only ever replaced.
+func (self *Check) copy() *Check {
+	check := *self
+
+	if self.Observations != nil {
+		observations := *self.Observations
+		observations.Values = append([]Observation(nil), self.Observations.Values...)
+		check.Observations = &observations
+	}
+
+	return &check
+}
 
-	if observation, err := self.Execute(); err == nil {
-		//  push event onto event channel
-		event = CheckEvent{
+// Returns an event describing the given observation (or the error that prevented it.)
+func (self *Check) newEvent(observation Observation, err error) CheckEvent {
+	if err == nil {
+		return CheckEvent{
 			Timestamp:   time.Now(),
 			Check:       self,
 			Observation: &observation,
@@ -256,17 +383,30 @@ func (self *Check) executeAndPush() {
 			Error:       false,
 		}
 	} else {
-		event = CheckEvent{
+		return CheckEvent{
 			Timestamp: time.Now(),
 			Check:     self,
 			Output:    err.Error(),
 			Error:     true,
 		}
 	}
+}
+
+func (self *Check) push(observation Observation, err error) {
+	event := self.newEvent(observation, err)
+
+	if self.History != nil {
+		self.History.Push(event)
+	}
 
+	//  push event onto event channel
 	self.EventStream <- event
 }
 
+func (self *Check) executeAndPush() {
+	self.push(self.Execute())
+}
+
 func (self *Check) IsRisen() bool {
 	oLen := len(self.Observations.Values)
 
@@ -304,15 +444,54 @@ func (self *Check) IsFallen() bool {
 }
 
 func (self *Check) Monitor(eventStream chan CheckEvent) error {
-	ticker := time.NewTicker(duration(self.Interval))
+	var ticker *time.Ticker
+	var tickerC <-chan time.Time
+
+	self.UID = self.ID()
 	self.EventStream = eventStream
 
-	self.executeAndPush()
+	//  passive checks don't execute anything, they only wait for submitted results
+	if !self.Passive {
+		ticker = time.NewTicker(duration(self.Interval))
+		tickerC = ticker.C
+
+		if self.Enabled {
+			self.executeAndPush()
+		}
+	}
+
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
 
 	for {
 		select {
-		case <-ticker.C:
-			self.executeAndPush()
+		case <-tickerC:
+			if self.Enabled {
+				self.executeAndPush()
+			}
+		case ctl := <-self.controlC:
+			interval := duration(self.Interval)
+			err := ctl.fn()
+
+			if err == nil {
+				ctl.reply <- checkReply{check: self.copy()}
+			} else {
+				ctl.reply <- checkReply{err: err}
+			}
+
+			//  restart the ticker if the interval changed
+			if ticker != nil && duration(self.Interval) != interval {
+				ticker.Stop()
+				ticker = time.NewTicker(duration(self.Interval))
+				tickerC = ticker.C
+			}
+
+			if err == nil && ctl.execute {
+				self.executeAndPush()
+			}
 		case stop := <-self.StopMonitorC:
 			if stop {
 				log.Infof("Check '%s' monitor is stopping", self.Name)
@@ -0,0 +1,221 @@
+package reacter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+var DefaultPeerTimeout = 5 * time.Second
+var DefaultClusterCacheTTL = time.Second
+
+// The status of a single peer, as seen from this node.
+type PeerStatus struct {
+	Address   string                `json:"address"`
+	Hostname  string                `json:"hostname,omitempty"`
+	Reachable bool                  `json:"reachable"`
+	Error     string                `json:"error,omitempty"`
+	Latency   float64               `json:"latency_ms"`
+	CheckedAt time.Time             `json:"checked_at"`
+	Nodes     []string              `json:"nodes,omitempty"`
+	Counts    map[string]int        `json:"counts"`
+	Checks    map[string]CheckEvent `json:"checks,omitempty"`
+}
+
+// A ClusterStatus summarizes the checks of every peer.
+type ClusterStatus struct {
+	Peers       []*PeerStatus  `json:"peers"`
+	Counts      map[string]int `json:"counts"`
+	Reachable   int            `json:"reachable"`
+	Unreachable int            `json:"unreachable"`
+	GeneratedAt time.Time      `json:"generated_at"`
+}
+
+// A Cluster queries the current checks of all of a Reacter's peers, caching the results briefly so
+// that many clients (e.g.: several open web interfaces) don't multiply the load on every peer.
+type Cluster struct {
+	Timeout  time.Duration
+	CacheTTL time.Duration
+	Scheme   string
+	Client   *http.Client
+	Header   http.Header
+	reacter  *Reacter
+	status   *ClusterStatus
+	lock     sync.Mutex
+}
+
+func NewCluster(reacter *Reacter) *Cluster {
+	return &Cluster{
+		Timeout:  DefaultPeerTimeout,
+		CacheTTL: DefaultClusterCacheTTL,
+		Scheme:   `http`,
+		Client:   http.DefaultClient,
+		Header:   make(http.Header),
+		reacter:  reacter,
+	}
+}
+
+// Whether the given address belongs to one of the Reacter's peers.
+func (self *Cluster) IsPeer(address string) bool {
+	for _, peer := range self.reacter.Peers {
+		if peer.Address == address {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Performs a GET request for the given path against a peer.  Only known peers may be queried.
+func (self *Cluster) Get(address string, path string) (*http.Response, error) {
+	return self.get(context.Background(), address, path, self.Timeout)
+}
+
+// Performs a GET request for the given path against a peer whose response is read for as long as
+// the given context lasts (e.g.: an event stream.)  Only known peers may be queried.
+func (self *Cluster) Stream(ctx context.Context, address string, path string) (*http.Response, error) {
+	return self.get(ctx, address, path, 0)
+}
+
+func (self *Cluster) get(ctx context.Context, address string, path string, timeout time.Duration) (*http.Response, error) {
+	if !self.IsPeer(address) {
+		return nil, fmt.Errorf("%s is not a known peer", address)
+	}
+
+	url := address
+
+	if !strings.Contains(url, `://`) {
+		url = self.Scheme + `://` + url
+	}
+
+	client := *self.Client
+	client.Timeout = timeout
+
+	if req, err := http.NewRequest(`GET`, strings.TrimSuffix(url, `/`)+path, nil); err == nil {
+		req = req.WithContext(ctx)
+
+		for k, v := range self.Header {
+			req.Header[k] = v
+		}
+
+		return client.Do(req)
+	} else {
+		return nil, err
+	}
+}
+
+func newStateCounts() map[string]int {
+	return map[string]int{
+		`okay`:     0,
+		`warning`:  0,
+		`critical`: 0,
+		`unknown`:  0,
+	}
+}
+
+// Returns the status of every peer, querying them all (concurrently) if the cached status has
+// expired.
+func (self *Cluster) Status() *ClusterStatus {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.status != nil && time.Since(self.status.GeneratedAt) < self.CacheTTL {
+		return self.status
+	}
+
+	peers := self.reacter.Peers
+	status := &ClusterStatus{
+		Peers:  make([]*PeerStatus, len(peers)),
+		Counts: newStateCounts(),
+	}
+
+	var wg sync.WaitGroup
+
+	for i, peer := range peers {
+		wg.Add(1)
+
+		go func(i int, address string, hostname string) {
+			defer wg.Done()
+			status.Peers[i] = self.queryPeer(address, hostname)
+		}(i, peer.Address, peer.Hostname)
+	}
+
+	wg.Wait()
+
+	for _, peer := range status.Peers {
+		if peer.Reachable {
+			status.Reachable += 1
+		} else {
+			status.Unreachable += 1
+		}
+
+		for state, count := range peer.Counts {
+			status.Counts[state] += count
+		}
+	}
+
+	sort.Slice(status.Peers, func(i int, j int) bool {
+		return status.Peers[i].Address < status.Peers[j].Address
+	})
+
+	status.GeneratedAt = time.Now()
+	self.status = status
+
+	return status
+}
+
+func (self *Cluster) queryPeer(address string, hostname string) *PeerStatus {
+	peer := &PeerStatus{
+		Address:   address,
+		Hostname:  hostname,
+		CheckedAt: time.Now(),
+		Counts:    newStateCounts(),
+		Checks:    make(map[string]CheckEvent),
+	}
+
+	if response, err := self.Get(address, `/reacter/v1/checks`); err == nil {
+		defer response.Body.Close()
+
+		if response.StatusCode < 400 {
+			if err := json.NewDecoder(response.Body).Decode(&peer.Checks); err == nil {
+				peer.Reachable = true
+			} else {
+				peer.Error = fmt.Sprintf("invalid response: %v", err)
+			}
+		} else {
+			peer.Error = response.Status
+		}
+	} else {
+		peer.Error = err.Error()
+	}
+
+	peer.Latency = float64(time.Since(peer.CheckedAt)) / float64(time.Millisecond)
+
+	if peer.Reachable {
+		nodes := make(map[string]bool)
+
+		for _, event := range peer.Checks {
+			if event.Check != nil {
+				peer.Counts[event.Check.StateString()] += 1
+				nodes[event.Check.NodeName] = true
+			}
+		}
+
+		for node := range nodes {
+			peer.Nodes = append(peer.Nodes, node)
+		}
+
+		sort.Strings(peer.Nodes)
+	} else {
+		log.Warningf("Peer %s is unreachable: %s", address, peer.Error)
+	}
+
+	return peer
+}
@@ -0,0 +1,148 @@
+package reacter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/netutil"
+)
+
+func clusterPeer(hits *int32, states map[string]ObservationState) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(hits, 1)
+
+		if states == nil {
+			http.Error(w, `broken`, http.StatusInternalServerError)
+			return
+		}
+
+		events := make(map[string]CheckEvent)
+
+		for name, state := range states {
+			check := NewCheck()
+			check.NodeName = strings.Split(name, `/`)[0]
+			check.Name = strings.Split(name, `/`)[1]
+			check.State = state
+			events[name] = CheckEvent{Check: check}
+		}
+
+		json.NewEncoder(w).Encode(events)
+	}))
+}
+
+func TestClusterStatus(t *testing.T) {
+	var hits int32
+
+	db := clusterPeer(&hits, map[string]ObservationState{
+		`db1/disk`: SuccessState,
+		`db1/load`: CriticalState,
+		`db2/disk`: WarningState,
+	})
+	defer db.Close()
+
+	web := clusterPeer(&hits, map[string]ObservationState{
+		`web1/http`: SuccessState,
+	})
+	defer web.Close()
+
+	broken := clusterPeer(&hits, nil)
+	defer broken.Close()
+
+	gone := clusterPeer(&hits, nil)
+	gone.Close()
+
+	reacter := NewReacter()
+
+	for _, peer := range []*httptest.Server{db, web, broken, gone} {
+		reacter.Peers = append(reacter.Peers, &netutil.Service{
+			Address: strings.TrimPrefix(peer.URL, `http://`),
+		})
+	}
+
+	cluster := NewCluster(reacter)
+	cluster.CacheTTL = time.Hour
+	status := cluster.Status()
+
+	if status.Reachable != 2 || status.Unreachable != 2 {
+		t.Errorf("expected 2 reachable and 2 unreachable peers, got %d and %d", status.Reachable, status.Unreachable)
+	}
+
+	expected := map[string]int{`okay`: 2, `warning`: 1, `critical`: 1, `unknown`: 0}
+
+	if !reflect.DeepEqual(status.Counts, expected) {
+		t.Errorf("expected counts %v, got %v", expected, status.Counts)
+	}
+
+	for _, tt := range []struct {
+		peer      *httptest.Server
+		reachable bool
+		nodes     []string
+	}{
+		{db, true, []string{`db1`, `db2`}},
+		{web, true, []string{`web1`}},
+		{broken, false, nil},
+		{gone, false, nil},
+	} {
+		address := strings.TrimPrefix(tt.peer.URL, `http://`)
+		var peer *PeerStatus
+
+		for _, p := range status.Peers {
+			if p.Address == address {
+				peer = p
+			}
+		}
+
+		if peer == nil {
+			t.Errorf("%s: missing from the cluster status", address)
+		} else if peer.Reachable != tt.reachable {
+			t.Errorf("%s: expected reachable=%v (error: %q)", address, tt.reachable, peer.Error)
+		} else if !tt.reachable && peer.Error == `` {
+			t.Errorf("%s: expected an error for an unreachable peer", address)
+		} else if !reflect.DeepEqual(peer.Nodes, tt.nodes) {
+			t.Errorf("%s: expected nodes %v, got %v", address, tt.nodes, peer.Nodes)
+		}
+	}
+
+	queried := atomic.LoadInt32(&hits)
+
+	if cluster.Status() != status || atomic.LoadInt32(&hits) != queried {
+		t.Errorf("expected the cached status to be returned without querying peers again")
+	}
+
+	cluster.CacheTTL = 0
+
+	if cluster.Status() == status || atomic.LoadInt32(&hits) == queried {
+		t.Errorf("expected an expired status to be refreshed")
+	}
+}
+
+func TestClusterOnlyQueriesPeers(t *testing.T) {
+	reacter := NewReacter()
+	reacter.Peers = []*netutil.Service{{Address: `db1:8000`}}
+	cluster := NewCluster(reacter)
+
+	for _, tt := range []struct {
+		address string
+		peer    bool
+	}{
+		{`db1:8000`, true},
+		{`db1:8001`, false},
+		{`169.254.169.254`, false},
+	} {
+		if cluster.IsPeer(tt.address) != tt.peer {
+			t.Errorf("%s: expected IsPeer to be %v", tt.address, tt.peer)
+		}
+
+		if !tt.peer {
+			if _, err := cluster.Get(tt.address, `/reacter/v1/checks`); err == nil {
+				t.Errorf("%s: expected querying a non-peer to fail", tt.address)
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ghetzel/cli"
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/reacter"
+)
+
+// Subcommands that work with configuration files.
+func configCommand() cli.Command {
+	return cli.Command{
+		Name:  `config`,
+		Usage: `Work with check and handler configuration files`,
+		Subcommands: []cli.Command{
+			{
+				Name:  `validate`,
+				Usage: `Report every mistake in the configuration (see --config-file and --config-dir) without running anything, and exit non-zero if there are any`,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  `json, j`,
+						Usage: `Print the problems found as JSON`,
+					},
+				},
+				Action: func(c *cli.Context) {
+					validator, err := reacter.ValidateConfig(c.GlobalString(`config-file`), c.GlobalString(`config-dir`))
+
+					if err != nil {
+						log.Fatalf("%v", err)
+					}
+
+					if c.Bool(`json`) {
+						printJSON(validator.Problems)
+					} else {
+						for _, problem := range validator.Problems {
+							fmt.Println(problem.String())
+						}
+					}
+
+					if len(validator.Problems) > 0 {
+						log.Errorf("Found %d problem(s) in %d file(s)", len(validator.Problems), len(validator.Files))
+						os.Exit(1)
+					}
+
+					log.Noticef("%d check(s) and %d handler(s) in %d file(s) are valid", validator.Checks, validator.Handlers, len(validator.Files))
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ghetzel/cli"
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/reacter"
+)
+
+// Subcommands that inspect and control a running Reacter instance through its control socket.
+func ctlCommand() cli.Command {
+	return cli.Command{
+		Name:  `ctl`,
+		Usage: `Inspect and control a running Reacter instance through its control socket (see --control-socket)`,
+		Subcommands: []cli.Command{
+			{
+				Name:  `status`,
+				Usage: `Show the current state of every check`,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  `json, j`,
+						Usage: `Print the most recent event of every check as JSON`,
+					},
+				},
+				Action: func(c *cli.Context) {
+					var node struct {
+						Name string `json:"name"`
+					}
+
+					checks := make(map[string]reacter.CheckEvent)
+
+					if err := ctlRequest(c, `GET`, `/reacter/v1/node`, nil, &node); err != nil {
+						log.Fatalf("%v", err)
+					}
+
+					if err := ctlRequest(c, `GET`, `/reacter/v1/checks`, nil, &checks); err != nil {
+						log.Fatalf("%v", err)
+					}
+
+					if c.Bool(`json`) {
+						printJSON(checks)
+					} else {
+						printStatus(node.Name, checks)
+					}
+				},
+			}, {
+				Name:      `run`,
+				Usage:     `Execute a check now, outside of its regular interval`,
+				ArgsUsage: `CHECK`,
+				Action: func(c *cli.Context) {
+					ctlCheck(c, `POST`, `run`, nil)
+				},
+			}, {
+				Name:      `enable`,
+				Usage:     `Resume executing a disabled check`,
+				ArgsUsage: `CHECK`,
+				Action: func(c *cli.Context) {
+					ctlCheck(c, `PUT`, `enable`, nil)
+				},
+			}, {
+				Name:      `disable`,
+				Usage:     `Stop executing a check until it is re-enabled`,
+				ArgsUsage: `CHECK`,
+				Action: func(c *cli.Context) {
+					ctlCheck(c, `PUT`, `disable`, nil)
+				},
+			}, {
+				Name:      `interval`,
+				Usage:     `Change how often a check runs`,
+				ArgsUsage: `CHECK DURATION`,
+				Action: func(c *cli.Context) {
+					if len(c.Args()) != 2 {
+						log.Fatalf("Must specify a check name and an interval")
+					}
+
+					ctlCheck(c, `PUT`, `interval`, map[string]interface{}{
+						`interval`: c.Args()[1],
+					})
+				},
+			}, {
+				Name:  `events`,
+				Usage: `Print check events to standard output as they happen`,
+				Flags: []cli.Flag{
+					cli.StringSliceFlag{
+						Name:  `node, N`,
+						Usage: `Only print events from these node(s)`,
+					},
+					cli.StringSliceFlag{
+						Name:  `check, k`,
+						Usage: `Only print events from these check(s)`,
+					},
+					cli.StringSliceFlag{
+						Name:  `state, s`,
+						Usage: `Only print events for checks in these state(s) (e.g.: "okay", "warning", "critical", "unknown")`,
+					},
+				},
+				Action: func(c *cli.Context) {
+					query := url.Values{}
+
+					for _, key := range []string{`node`, `check`, `state`} {
+						for _, value := range c.StringSlice(key) {
+							query.Add(key, value)
+						}
+					}
+
+					if err := tailEvents(c, `unix://`+ctlSocket(c), query); err != nil {
+						log.Fatalf("%v", err)
+					}
+				},
+			},
+		},
+	}
+}
+
+func ctlSocket(c *cli.Context) string {
+	if socket := c.GlobalString(`control-socket`); socket != `` {
+		return socket
+	}
+
+	return reacter.DefaultControlSocket
+}
+
+func ctlRequest(c *cli.Context, method string, path string, body interface{}, out interface{}) error {
+	return apiRequest(c, method, `unix://`+ctlSocket(c), path, body, out)
+}
+
+// Performs an action on the check named in the first argument, and prints its updated state.
+func ctlCheck(c *cli.Context, method string, action string, body interface{}) {
+	if len(c.Args()) == 0 {
+		log.Fatalf("Must specify the name of a check")
+	}
+
+	var check reacter.Check
+
+	if err := ctlRequest(c, method, `/reacter/v1/checks/`+url.PathEscape(c.Args()[0])+`/`+action, body, &check); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	printStatus(check.NodeName, map[string]reacter.CheckEvent{
+		check.Name: {
+			Check: &check,
+		},
+	})
+}
+
+func printStatus(nodeName string, checks map[string]reacter.CheckEvent) {
+	events := make([]reacter.CheckEvent, 0, len(checks))
+
+	for _, event := range checks {
+		if event.Check != nil {
+			events = append(events, event)
+		}
+	}
+
+	sort.Slice(events, func(i int, j int) bool {
+		return events[i].Check.Name < events[j].Check.Name
+	})
+
+	if nodeName != `` {
+		fmt.Printf("Node: %s\n\n", nodeName)
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "CHECK\tSTATE\tLAST RUN\tFLAGS\tOUTPUT")
+
+	for _, event := range events {
+		check := event.Check
+		flags := make([]string, 0)
+		lastRun := `never`
+
+		if !check.LastObservedAt.IsZero() {
+			lastRun = time.Since(check.LastObservedAt).Round(time.Second).String() + ` ago`
+		}
+
+		if !check.Enabled {
+			flags = append(flags, `disabled`)
+		}
+
+		if check.Observations != nil && check.IsFlapping() {
+			flags = append(flags, `flapping`)
+		}
+
+		if check.IsAcknowledged() {
+			flags = append(flags, `acknowledged`)
+		}
+
+		if check.Stale {
+			flags = append(flags, `stale`)
+		}
+
+		output := strings.Replace(event.Output, "\n", ` `, -1)
+
+		if len(output) > 60 {
+			output = output[:57] + `...`
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", check.Name, check.StateString(), lastRun, strings.Join(flags, `,`), output)
+	}
+
+	table.Flush()
+}
+
+func printJSON(value interface{}) {
+	if data, err := json.MarshalIndent(value, ``, `  `); err == nil {
+		fmt.Println(string(data))
+	} else {
+		log.Fatalf("%v", err)
+	}
+}
+
+func printJSONLine(value interface{}) {
+	if data, err := json.Marshal(value); err == nil {
+		fmt.Println(string(data))
+	} else {
+		log.Fatalf("%v", err)
+	}
+}
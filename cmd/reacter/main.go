@@ -1,12 +1,26 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/ghetzel/cli"
+	"github.com/ghetzel/go-stockutil/fileutil"
 	"github.com/ghetzel/go-stockutil/log"
 	"github.com/ghetzel/go-stockutil/stringutil"
 	"github.com/ghetzel/reacter"
@@ -45,6 +59,12 @@ func main() {
 			Value:  reacter.DefaultConfigDir,
 			EnvVar: `REACTER_CONFIG_DIR`,
 		},
+		cli.StringFlag{
+			Name:   `ack-file`,
+			Usage:  `The file where check acknowledgements are stored`,
+			Value:  reacter.DefaultAckFile,
+			EnvVar: `REACTER_ACK_FILE`,
+		},
 		cli.StringFlag{
 			Name:   `http-address, a`,
 			Usage:  `If provided, start an HTTP server at this address and serve a web interface.`,
@@ -55,6 +75,41 @@ func main() {
 			Usage:  `If specified, frontend web assets will be expected to be served from this URL subdirectory.`,
 			EnvVar: `REACTER_HTTP_PREFIX`,
 		},
+		cli.StringFlag{
+			Name:   `http-token`,
+			Usage:  `If provided, requests that modify state via the HTTP API must present this bearer token (and commands that call the API will send it.)`,
+			EnvVar: `REACTER_HTTP_TOKEN`,
+		},
+		cli.StringFlag{
+			Name:   `http-user`,
+			Usage:  `If provided, all HTTP requests must present these basic credentials (or the bearer token, or a verified client certificate.)`,
+			EnvVar: `REACTER_HTTP_USER`,
+		},
+		cli.StringFlag{
+			Name:   `http-password`,
+			Usage:  `The password that accompanies --http-user.`,
+			EnvVar: `REACTER_HTTP_PASSWORD`,
+		},
+		cli.StringFlag{
+			Name:   `http-cert`,
+			Usage:  `Serve HTTPS using this PEM-encoded certificate (which is also presented to peers and to servers that verify client certificates.)`,
+			EnvVar: `REACTER_HTTP_CERT`,
+		},
+		cli.StringFlag{
+			Name:   `http-key`,
+			Usage:  `The PEM-encoded private key of the --http-cert certificate.`,
+			EnvVar: `REACTER_HTTP_KEY`,
+		},
+		cli.StringFlag{
+			Name:   `http-client-ca`,
+			Usage:  `A PEM-encoded CA bundle used to verify client certificates and the certificates of peers.  Clients presenting a certificate signed by it need no other credentials; all others are rejected unless they present valid credentials.`,
+			EnvVar: `REACTER_HTTP_CLIENT_CA`,
+		},
+		cli.StringFlag{
+			Name:   `control-socket, S`,
+			Usage:  `If provided, serve the JSON API (without credentials) on a unix socket at this path for use by "reacter ctl"`,
+			EnvVar: `REACTER_CONTROL_SOCKET`,
+		},
 		cli.BoolFlag{
 			Name:   `zeroconf`,
 			Usage:  `Publish and perform automatic discovery of peer Reacter instances`,
@@ -73,9 +128,22 @@ func main() {
 
 	app.Action = func(c *cli.Context) {
 		// wire up check outputs directly to handler inputs
-		src, dst := io.Pipe()
-		go runHandlers(c, src)
-		runChecks(c, dst)
+		pipe := reacter.NewPipe()
+		handlers := newEventRouter(c)
+		checks := newReacter(c)
+		checks.AddSink(pipe)
+
+		startServer(c, checks, handlers)
+
+		go func() {
+			if err := handlers.RunSource(pipe); err != nil {
+				log.Fatalf("[handlers] %v", err)
+			}
+		}()
+
+		if err := checks.Run(); err != nil {
+			log.Fatalf("[checks] %v", err)
+		}
 	}
 
 	app.Commands = []cli.Command{
@@ -95,15 +163,162 @@ func main() {
 					Name:  `no-flapping, F`,
 					Usage: `Do not emit events whose checks are flapping between okay and non-okay`,
 				},
+				cli.BoolFlag{
+					Name:  `omit-environment`,
+					Usage: `Leave check environments out of emitted events and API responses`,
+				},
+				cli.DurationFlag{
+					Name:  `heartbeat-interval, H`,
+					Usage: `How often to emit a heartbeat event announcing that this node is alive (e.g.: "30s"; heartbeats are disabled by default)`,
+					Value: reacter.DefaultHeartbeatInterval,
+				},
+				cli.StringSliceFlag{
+					Name:  `output, o`,
+					Usage: `Write check events to this destination (may be repeated): stdout://, file:///path, unix:///path, http(s)://host/path, or amqp://host/?exchange=name`,
+				},
+				cli.StringFlag{
+					Name:   `spool-dir`,
+					Usage:  `Spool events for each --output in a subdirectory of this directory, so that checks never wait for an output that is slow or unavailable`,
+					EnvVar: `REACTER_SPOOL_DIR`,
+				},
+				cli.IntFlag{
+					Name:  `spool-segment-size`,
+					Usage: `Start a new spool segment file once the current one reaches this many bytes`,
+					Value: int(reacter.DefaultSpoolSegmentSize),
+				},
+				cli.IntFlag{
+					Name:  `spool-max-size`,
+					Usage: `Discard the oldest spool segments (delivered or not) once an output's spool exceeds this many bytes (0 for no limit)`,
+					Value: int(reacter.DefaultSpoolMaxSize),
+				},
+				cli.DurationFlag{
+					Name:  `spool-max-age`,
+					Usage: `Discard spool segments (delivered or not) once they are this old (0 for no limit)`,
+					Value: reacter.DefaultSpoolMaxAge,
+				},
+				cli.BoolFlag{
+					Name:  `once`,
+					Usage: `Execute the checks once (in parallel), print their events as JSON, and exit with the worst state as the exit status`,
+				},
+				cli.StringSliceFlag{
+					Name:  `check, k`,
+					Usage: `With --once, only execute these check(s)`,
+				},
 			},
 			Action: func(c *cli.Context) {
-				runChecks(c, nil)
+				checks := newReacter(c)
+				fatalf := log.Fatalf
+
+				if c.Bool(`once`) {
+					//  log.Fatalf exits with 1, which would be indistinguishable from a warning
+					fatalf = func(format string, args ...interface{}) {
+						log.Errorf(format, args...)
+						os.Exit(int(reacter.UnknownState))
+					}
+				}
+
+				for _, output := range c.StringSlice(`output`) {
+					if sink, err := newSink(c, output); err == nil {
+						checks.AddSink(sink)
+					} else {
+						fatalf("[checks] %v", err)
+					}
+				}
+
+				if c.Bool(`once`) {
+					checks.PrintJson = true
+					events, err := checks.RunOnce(c.StringSlice(`check`)...)
+
+					for _, sink := range checks.Sinks {
+						if err := sink.Close(); err != nil {
+							log.Warningf("[checks] Failed to close %T: %v", sink, err)
+						}
+					}
+
+					if err != nil {
+						fatalf("[checks] %v", err)
+					}
+
+					os.Exit(int(reacter.WorstState(events)))
+				}
+
+				startServer(c, checks, nil)
+
+				if err := checks.Run(); err != nil {
+					log.Fatalf("[checks] %v", err)
+				}
 			},
 		}, {
 			Name:  `handle`,
 			Usage: `Receive check events and execute handlers`,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  `input, i`,
+					Usage: `Read check events from this source: stdin://, file:///path, unix:///path (listened on), http://address/path (listened on), or amqp://host/?queue=name`,
+					Value: `stdin://`,
+				},
+				cli.StringFlag{
+					Name:   `amqp-uri`,
+					Usage:  `Consume events directly from this AMQP broker (configured with the queue and exchange options) instead of --input, acknowledging each message once its handlers have executed`,
+					EnvVar: `REACTER_AMQP_URI`,
+				},
+				cli.DurationFlag{
+					Name:  `freshness-threshold`,
+					Usage: `Raise an UNKNOWN event for any check (that doesn't specify its own freshness_threshold) that hasn't reported in this long`,
+				},
+				cli.IntFlag{
+					Name:  `missed-heartbeats, M`,
+					Usage: `How many consecutive heartbeats a node may miss before it is declared dead`,
+					Value: reacter.DefaultMissedHeartbeats,
+				},
+				cli.BoolFlag{
+					Name:  `dry-run, n`,
+					Usage: `Print which handlers each event would execute (and the rule that decided it) instead of executing anything`,
+				},
+			}, amqpFlags()...),
 			Action: func(c *cli.Context) {
-				runHandlers(c, os.Stdin)
+				if c.Bool(`dry-run`) {
+					//  consuming from a broker acknowledges (and so removes) every message, which a dry
+					//  run must not do
+					if u, err := url.Parse(c.String(`input`)); c.String(`amqp-uri`) != `` || (err == nil && strings.HasPrefix(strings.ToLower(u.Scheme), `amqp`)) {
+						log.Fatalf("[handlers] --dry-run cannot consume from AMQP; use --input with a copy of the events instead")
+					}
+				}
+
+				handlers := newEventRouter(c)
+
+				if !c.Bool(`dry-run`) {
+					//  the HTTP server exposes the node registry; there are no local checks to report on
+					startServer(c, reacter.NewReacter(), handlers)
+				}
+
+				var source reacter.Source
+				var err error
+
+				if uri := c.String(`amqp-uri`); uri != `` {
+					source, err = newConsumer(c, uri)
+				} else {
+					source, err = reacter.NewSource(c.String(`input`))
+				}
+
+				if err != nil {
+					log.Fatalf("[handlers] %v", err)
+				}
+
+				//  events POSTed to an HTTP input require the same credentials (and TLS) as the API
+				if httpSource, ok := source.(*reacter.HTTPSource); ok {
+					httpSource.Server = newServer(c, reacter.NewReacter(), handlers)
+				}
+
+				if c.Bool(`dry-run`) {
+					err = explainEvents(handlers, source, false)
+				} else {
+					err = handlers.RunSource(source)
+				}
+
+				if err != nil {
+					log.Fatalf("[handlers] %v", err)
+				}
 			},
 		}, {
 			Name:  `cacher`,
@@ -141,59 +356,256 @@ func main() {
 				}
 			},
 		}, {
-			Name:  `consume`,
-			Usage: `Connect to an AMQP message broker and print check events to standard output`,
+			Name:      `ack`,
+			Usage:     `Acknowledge an alerting check, suppressing further escalations and (optionally) notifications`,
+			ArgsUsage: `NODE CHECK`,
 			Flags: []cli.Flag{
 				cli.StringFlag{
-					Name:  `queue, Q`,
-					Usage: `The name of the queue to bind to`,
-					Value: reacter.DEFAULT_QUEUE_NAME,
+					Name:   `author, a`,
+					Usage:  `Who is acknowledging the check`,
+					EnvVar: `USER`,
 				},
-				cli.BoolFlag{
-					Name:  `durable, D`,
-					Usage: `Durable queues will survive server restarts and remain when there are no remaining consumers or bindings`,
+				cli.StringFlag{
+					Name:  `comment, m`,
+					Usage: `A comment to attach to the acknowledgement`,
+				},
+				cli.DurationFlag{
+					Name:  `expires, e`,
+					Usage: `If set, the acknowledgement will be removed after this amount of time`,
 				},
 				cli.BoolFlag{
-					Name:  `autodelete, A`,
-					Usage: `Auto-deleted queues will be automatically removed when all clients disconnect`,
+					Name:  `sticky, s`,
+					Usage: `Keep the acknowledgement until the check recovers, even if its state changes`,
 				},
 				cli.BoolFlag{
-					Name:  `exclusive, E`,
-					Usage: `Exclusive queues are only accessible by the connection that declares them and will be deleted when the connection closes`,
+					Name:  `remove, r`,
+					Usage: `Remove an existing acknowledgement instead of creating one`,
+				},
+				cli.StringFlag{
+					Name:   `url, u`,
+					Usage:  `The URL of a Reacter HTTP server (or "unix:///path/to/control.sock") to submit the acknowledgement to; if not set, the local acknowledgements file is updated`,
+					EnvVar: `REACTER_URL`,
 				},
 			},
 			Action: func(c *cli.Context) {
-				if len(c.Args()) > 0 {
-					if consumer, err := reacter.NewConsumer(c.Args()[0]); err == nil {
-						if q := c.String(`queue`); q != `` {
-							consumer.QueueName = q
+				if len(c.Args()) != 2 {
+					log.Fatalf("Must specify a node name and a check name")
+				}
+
+				node, check := c.Args()[0], c.Args()[1]
+
+				if c.Bool(`remove`) {
+					if u := c.String(`url`); u != `` {
+						if err := apiRequest(c, `DELETE`, u, `/reacter/v1/acks/`+node+`/`+check, nil, nil); err != nil {
+							log.Fatalf("%v", err)
 						}
+					} else if err := reacter.NewAckStore(c.GlobalString(`ack-file`)).Remove(node, check); err != nil {
+						log.Fatalf("%v", err)
+					}
+
+					return
+				}
+
+				ack := &reacter.Acknowledgement{
+					NodeName:  node,
+					CheckName: check,
+					Author:    c.String(`author`),
+					Comment:   c.String(`comment`),
+					Sticky:    c.Bool(`sticky`),
+				}
+
+				if u := c.String(`url`); u != `` {
+					body := map[string]interface{}{
+						`node`:    ack.NodeName,
+						`check`:   ack.CheckName,
+						`author`:  ack.Author,
+						`comment`: ack.Comment,
+						`sticky`:  ack.Sticky,
+					}
+
+					if expires := c.Duration(`expires`); expires > 0 {
+						body[`expires`] = expires.String()
+					}
+
+					if err := apiRequest(c, `POST`, u, `/reacter/v1/acks`, body, nil); err != nil {
+						log.Fatalf("%v", err)
+					}
+				} else {
+					if expires := c.Duration(`expires`); expires > 0 {
+						expiresAt := time.Now().Add(expires)
+						ack.ExpiresAt = &expiresAt
+					}
+
+					if err := reacter.NewAckStore(c.GlobalString(`ack-file`)).Acknowledge(ack); err != nil {
+						log.Fatalf("%v", err)
+					}
+				}
+			},
+		}, {
+			Name:      `submit`,
+			Usage:     `Submit the result of a passive check to a running Reacter instance`,
+			ArgsUsage: `CHECK`,
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  `status, s`,
+					Usage: `The exit status of the check (0 = OK, 1 = Warning, 2 = Critical, 3+ = Unknown)`,
+				},
+				cli.StringFlag{
+					Name:  `output, o`,
+					Usage: `The output of the check; if "-", it will be read from standard input`,
+				},
+				cli.StringFlag{
+					Name:  `perfdata, p`,
+					Usage: `Nagios-style performance data for the check (e.g.: "time=1.5s;5;10;0;60")`,
+				},
+				cli.StringFlag{
+					Name:   `url, u`,
+					Usage:  `The URL of the Reacter HTTP server (or "unix:///path/to/control.sock") that runs the check`,
+					Value:  `http://localhost:8080`,
+					EnvVar: `REACTER_URL`,
+				},
+			},
+			Action: func(c *cli.Context) {
+				if len(c.Args()) != 1 {
+					log.Fatalf("Must specify the name of the check to submit a result for")
+				}
 
-						consumer.Durable = c.Bool(`durable`)
-						consumer.Autodelete = c.Bool(`autodelete`)
-						consumer.Exclusive = c.Bool(`exclusive`)
+				result := reacter.CheckResult{
+					Status:   c.Int(`status`),
+					Output:   c.String(`output`),
+					PerfData: c.String(`perfdata`),
+				}
 
-						log.Infof("Connecting to %s:%d vhost=%s queue=%s", consumer.Host, consumer.Port, consumer.Vhost, consumer.QueueName)
+				if result.Output == `-` {
+					if data, err := ioutil.ReadAll(os.Stdin); err == nil {
+						result.Output = strings.TrimSpace(string(data))
+					} else {
+						log.Fatalf("Failed to read output: %v", err)
+					}
+				}
 
-						if err := consumer.Connect(); err == nil {
-							if msgs, err := consumer.Subscribe(); err == nil {
-								for msg := range msgs {
-									fmt.Println(msg)
-								}
-							} else {
-								log.Fatalf("Error subscribing: %v", err)
+				if err := apiRequest(c, `POST`, c.String(`url`), `/reacter/v1/checks/`+c.Args()[0]+`/results`, result, nil); err != nil {
+					log.Fatalf("%v", err)
+				}
+			},
+		}, {
+			Name:  `tail`,
+			Usage: `Print check events from a running Reacter instance to standard output as they happen`,
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  `node, N`,
+					Usage: `Only print events from these node(s)`,
+				},
+				cli.StringSliceFlag{
+					Name:  `check, k`,
+					Usage: `Only print events from these check(s)`,
+				},
+				cli.StringSliceFlag{
+					Name:  `state, s`,
+					Usage: `Only print events for checks in these state(s) (e.g.: "okay", "warning", "critical", "unknown")`,
+				},
+				cli.StringFlag{
+					Name:   `url, u`,
+					Usage:  `The URL of the Reacter HTTP server (or "unix:///path/to/control.sock") to stream events from`,
+					Value:  `http://localhost:8080`,
+					EnvVar: `REACTER_URL`,
+				},
+			},
+			Action: func(c *cli.Context) {
+				query := url.Values{}
+
+				for _, key := range []string{`node`, `check`, `state`} {
+					for _, value := range c.StringSlice(key) {
+						query.Add(key, value)
+					}
+				}
+
+				if err := tailEvents(c, c.String(`url`), query); err != nil {
+					log.Fatalf("%v", err)
+				}
+			},
+		}, {
+			Name:  `consume`,
+			Usage: `Connect to an AMQP message broker and print check events to standard output`,
+			Flags: amqpFlags(),
+			Action: func(c *cli.Context) {
+				if len(c.Args()) > 0 {
+					if consumer, err := newConsumer(c, c.Args()[0]); err == nil {
+						if msgs, err := consumer.Subscribe(); err == nil {
+							for msg := range msgs {
+								fmt.Println(msg)
 							}
 						} else {
-							log.Fatalf("Error connecting to consumer: %v", err)
+							log.Fatalf("Error subscribing: %v", err)
 						}
 					} else {
-						log.Fatalf("Error initializing consumer: %v", err)
+						log.Fatalf("%v", err)
 					}
 				} else {
 					log.Fatalf("Must provide an AMQP connection URI as an argument")
 				}
 			},
+		}, {
+			Name:      `publish`,
+			Usage:     `Read check events from standard input and publish them to an AMQP exchange, routed by node, check, and state`,
+			ArgsUsage: `URI`,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  `exchange, X`,
+					Usage: `The exchange to publish to (declared if it doesn't exist)`,
+					Value: reacter.DEFAULT_EXCHANGE_NAME,
+				},
+				cli.StringFlag{
+					Name:  `exchange-type`,
+					Usage: `The type of exchange to declare ("direct", "fanout", "topic", or "headers")`,
+					Value: reacter.DEFAULT_EXCHANGE_TYPE,
+				},
+			},
+			Action: func(c *cli.Context) {
+				if len(c.Args()) == 0 {
+					log.Fatalf("Must provide an AMQP connection URI as an argument")
+				}
+
+				publisher, err := reacter.NewPublisher(c.Args()[0])
+
+				if err != nil {
+					log.Fatalf("Error initializing publisher: %v", err)
+				}
+
+				publisher.Exchange = c.String(`exchange`)
+				publisher.ExchangeType = c.String(`exchange-type`)
+
+				log.Infof("Connecting to %s:%d vhost=%s exchange=%s", publisher.Host, publisher.Port, publisher.Vhost, publisher.Exchange)
+
+				if err := publisher.Connect(); err != nil {
+					log.Fatalf("Error connecting to publisher: %v", err)
+				}
+
+				defer publisher.Close()
+
+				lines := bufio.NewScanner(os.Stdin)
+
+				for lines.Scan() {
+					var event reacter.CheckEvent
+
+					if err := json.Unmarshal(lines.Bytes(), &event); err != nil {
+						log.Warningf("Failed to parse input line: %v", err)
+						continue
+					}
+
+					key := reacter.EventRoutingKey(event)
+
+					if err := publisher.PublishRaw(key, lines.Bytes(), event.Timestamp); err == nil {
+						log.Debugf("Published event with routing key %s", key)
+					} else {
+						log.Fatalf("Error publishing: %v", err)
+					}
+				}
+			},
 		},
+		ctlCommand(),
+		configCommand(),
+		routeCommand(),
 	}
 
 	//  load plugin subcommands
@@ -202,7 +614,7 @@ func main() {
 	app.Run(os.Args)
 }
 
-func runChecks(c *cli.Context, dst io.Writer) {
+func newReacter(c *cli.Context) *reacter.Reacter {
 	f := reacter.NewReacter()
 	f.ConfigFile = c.GlobalString(`config-file`)
 	f.ConfigDir = c.GlobalString(`config-dir`)
@@ -220,31 +632,326 @@ func runChecks(c *cli.Context, dst io.Writer) {
 	log.Infof("Node name is '%s'", f.NodeName)
 
 	f.PrintJson = c.Bool(`print-json`)
-	f.WriteJson = dst
 	f.OnlyPrintChanges = c.Bool(`only-changes`)
 	f.SuppressFlapping = c.Bool(`no-flapping`)
+	f.Acks = reacter.NewAckStore(c.GlobalString(`ack-file`))
 
-	if addr := c.GlobalString(`http-address`); addr != `` {
-		server := reacter.NewServer(f)
-		server.PathPrefix = c.GlobalString(`http-path-prefix`)
-		server.ZeroconfMDNS = c.GlobalBool(`zeroconf`)
-		server.ZeroconfEC2Tag = c.GlobalString(`zeroconf-ec2-tag`)
-
-		log.Infof("Starting HTTP server at %v", addr)
-		go server.ListenAndServe(addr)
+	if c.Bool(`omit-environment`) {
+		f.Redactor.OmitEnvironment = true
 	}
 
-	if err := f.Run(); err != nil {
-		log.Fatalf("[checks] %v", err)
+	if c.IsSet(`heartbeat-interval`) {
+		f.HeartbeatInterval = c.Duration(`heartbeat-interval`)
 	}
+
+	return f
 }
 
-func runHandlers(c *cli.Context, src io.Reader) {
+func newEventRouter(c *cli.Context) *reacter.EventRouter {
 	f := reacter.NewEventRouter()
 	f.ConfigFile = c.GlobalString(`config-file`)
 	f.ConfigDir = c.GlobalString(`config-dir`)
+	f.Acks = reacter.NewAckStore(c.GlobalString(`ack-file`))
+	f.FreshnessThreshold = c.Duration(`freshness-threshold`)
 
-	if err := f.Run(src); err != nil {
-		log.Fatalf("[handlers] %v", err)
+	if c.IsSet(`missed-heartbeats`) {
+		f.Nodes.MissedHeartbeats = c.Int(`missed-heartbeats`)
 	}
+
+	return f
+}
+
+// Creates a sink for the given output, spooled if a spool directory was given.  Each output is
+// spooled in its own subdirectory, named after a hash of the output's URI.
+func newSink(c *cli.Context, output string) (reacter.Sink, error) {
+	sink, err := reacter.NewSink(output)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if dir := c.String(`spool-dir`); dir != `` {
+		dir = filepath.Join(dir, fmt.Sprintf("%x", sha1.Sum([]byte(output)))[0:16])
+
+		if spool, err := reacter.OpenSpool(dir); err == nil {
+			spool.SegmentSize = int64(c.Int(`spool-segment-size`))
+			spool.MaxSize = int64(c.Int(`spool-max-size`))
+			spool.MaxAge = c.Duration(`spool-max-age`)
+
+			log.Infof("Spooling events for %s in %s", output, dir)
+
+			return reacter.NewSpooledSink(sink, spool), nil
+		} else {
+			sink.Close()
+			return nil, err
+		}
+	}
+
+	return sink, nil
+}
+
+// Options for declaring the queue (and the exchanges it's bound to) that AMQP consumers read from.
+func amqpFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  `queue, Q`,
+			Usage: `The name of the queue to bind to`,
+			Value: reacter.DEFAULT_QUEUE_NAME,
+		},
+		cli.BoolFlag{
+			Name:  `durable, D`,
+			Usage: `Durable queues will survive server restarts and remain when there are no remaining consumers or bindings`,
+		},
+		cli.BoolFlag{
+			Name:  `autodelete, A`,
+			Usage: `Auto-deleted queues will be automatically removed when all clients disconnect`,
+		},
+		cli.BoolFlag{
+			Name:  `exclusive, E`,
+			Usage: `Exclusive queues are only accessible by the connection that declares them and will be deleted when the connection closes`,
+		},
+		cli.IntFlag{
+			Name:  `prefetch, P`,
+			Usage: `How many unacknowledged messages the broker will deliver at once (0 for no limit)`,
+			Value: reacter.DefaultAMQPPrefetch,
+		},
+		cli.StringFlag{
+			Name:  `exchange, X`,
+			Usage: `Declare this exchange and bind the queue to it`,
+		},
+		cli.StringFlag{
+			Name:  `exchange-type`,
+			Usage: `The type of exchange to declare ("direct", "fanout", "topic", or "headers")`,
+			Value: reacter.DEFAULT_EXCHANGE_TYPE,
+		},
+		cli.StringSliceFlag{
+			Name:  `binding-key, B`,
+			Usage: `Bind the queue to the exchange with this routing key (may be repeated; defaults to "#", matching everything).  Words in topic keys may contain glob patterns, e.g. "checks.*.db-*.critical"`,
+		},
+		cli.StringFlag{
+			Name:  `dead-letter-exchange`,
+			Usage: `Route rejected messages to this exchange, and declare a queue (named "<queue>.dead-letter") to retain them`,
+		},
+	}
+}
+
+// Creates a consumer from the flags in amqpFlags and connects it to the given broker.
+func newConsumer(c *cli.Context, uri string) (*reacter.Consumer, error) {
+	if consumer, err := reacter.NewConsumer(uri); err == nil {
+		if q := c.String(`queue`); q != `` {
+			consumer.QueueName = q
+		}
+
+		consumer.Durable = c.Bool(`durable`)
+		consumer.Autodelete = c.Bool(`autodelete`)
+		consumer.Exclusive = c.Bool(`exclusive`)
+		consumer.Prefetch = c.Int(`prefetch`)
+		consumer.Exchange = c.String(`exchange`)
+		consumer.ExchangeType = c.String(`exchange-type`)
+		consumer.BindingKeys = c.StringSlice(`binding-key`)
+		consumer.DeadLetterExchange = c.String(`dead-letter-exchange`)
+
+		log.Infof("Connecting to %s:%d vhost=%s queue=%s", consumer.Host, consumer.Port, consumer.Vhost, consumer.QueueName)
+
+		if err := consumer.Connect(); err == nil {
+			return consumer, nil
+		} else {
+			return nil, fmt.Errorf("Error connecting to consumer: %v", err)
+		}
+	} else {
+		return nil, fmt.Errorf("Error initializing consumer: %v", err)
+	}
+}
+
+// Starts the HTTP server and the control socket in the background (if an address or path was
+// given.)  The router is optional.
+// Returns a server configured with the global HTTP options.
+func newServer(c *cli.Context, checks *reacter.Reacter, handlers *reacter.EventRouter) *reacter.Server {
+	server := reacter.NewServer(checks)
+	server.Router = handlers
+	server.PathPrefix = c.GlobalString(`http-path-prefix`)
+	server.Token = c.GlobalString(`http-token`)
+	server.Username = c.GlobalString(`http-user`)
+	server.Password = c.GlobalString(`http-password`)
+	server.CertFile = c.GlobalString(`http-cert`)
+	server.KeyFile = c.GlobalString(`http-key`)
+	server.ClientCAFile = c.GlobalString(`http-client-ca`)
+	server.ZeroconfMDNS = c.GlobalBool(`zeroconf`)
+	server.ZeroconfEC2Tag = c.GlobalString(`zeroconf-ec2-tag`)
+
+	return server
+}
+
+func startServer(c *cli.Context, checks *reacter.Reacter, handlers *reacter.EventRouter) {
+	addr := c.GlobalString(`http-address`)
+	socket := c.GlobalString(`control-socket`)
+
+	if addr == `` && socket == `` {
+		return
+	}
+
+	server := newServer(c, checks, handlers)
+
+	if addr != `` {
+		log.Infof("Starting HTTP server at %v", addr)
+
+		go func() {
+			if err := server.ListenAndServe(addr); err != nil {
+				log.Fatalf("HTTP server: %v", err)
+			}
+		}()
+	}
+
+	if socket != `` {
+		log.Infof("Listening for control requests at %v", socket)
+
+		go func() {
+			if err := server.ListenAndServeUnix(socket); err != nil {
+				log.Fatalf("Control socket: %v", err)
+			}
+		}()
+	}
+}
+
+// Performs a request against the JSON API of a Reacter HTTP server, decoding the response into out
+// (if given).
+func apiRequest(c *cli.Context, method string, baseURL string, path string, body interface{}, out interface{}) error {
+	var payload io.Reader
+
+	if body != nil {
+		if data, err := json.Marshal(body); err == nil {
+			payload = bytes.NewReader(data)
+		} else {
+			return err
+		}
+	}
+
+	apiURL, socket := apiURL(baseURL, path)
+
+	if req, err := http.NewRequest(method, apiURL, payload); err == nil {
+		req.Header.Set(`Content-Type`, `application/json`)
+
+		if response, err := doRequest(c, req, socket); err == nil {
+			defer response.Body.Close()
+
+			if response.StatusCode >= 400 {
+				var apiErr struct {
+					Error string `json:"error"`
+				}
+
+				if err := json.NewDecoder(response.Body).Decode(&apiErr); err == nil && apiErr.Error != `` {
+					return fmt.Errorf("%s: %s", response.Status, apiErr.Error)
+				}
+
+				return fmt.Errorf("%s", response.Status)
+			} else if out != nil && response.StatusCode != http.StatusNoContent {
+				return json.NewDecoder(response.Body).Decode(out)
+			}
+
+			return nil
+		} else {
+			return err
+		}
+	} else {
+		return err
+	}
+}
+
+// Prints events from the event stream of a Reacter server (filtered by the given query) as they
+// happen.
+func tailEvents(c *cli.Context, baseURL string, query url.Values) error {
+	apiURL, socket := apiURL(baseURL, `/reacter/v1/events/stream?`+query.Encode())
+
+	req, err := http.NewRequest(`GET`, apiURL, nil)
+
+	if err != nil {
+		return err
+	}
+
+	if response, err := doRequest(c, req, socket); err == nil {
+		defer response.Body.Close()
+
+		if response.StatusCode >= 400 {
+			return fmt.Errorf("%s", response.Status)
+		}
+
+		lines := bufio.NewScanner(response.Body)
+		lines.Buffer(make([]byte, 0, 65536), 16*1024*1024)
+
+		for lines.Scan() {
+			if line := lines.Text(); strings.HasPrefix(line, `data: `) {
+				fmt.Println(strings.TrimPrefix(line, `data: `))
+			}
+		}
+
+		return lines.Err()
+	} else {
+		return err
+	}
+}
+
+// Returns the URL of the given API path on a Reacter server, which is either the base URL of its
+// HTTP server or (as "unix:///path/to/socket") its control socket.  For the latter, the path of the
+// socket to connect to is also returned.
+func apiURL(baseURL string, path string) (string, string) {
+	if strings.HasPrefix(baseURL, `unix://`) {
+		return `http://reacter` + path, strings.TrimPrefix(baseURL, `unix://`)
+	} else if !strings.Contains(baseURL, `://`) {
+		baseURL = `http://` + baseURL
+	}
+
+	return strings.TrimSuffix(baseURL, `/`) + path, ``
+}
+
+// Sends a request to a Reacter HTTP server using the credentials, client certificate, and CA
+// given in the global flags, or (if a socket is given) to a Reacter control socket.
+func doRequest(c *cli.Context, req *http.Request, socket string) (*http.Response, error) {
+	if socket != `` {
+		client := &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, `unix`, fileutil.MustExpandUser(socket))
+				},
+			},
+		}
+
+		return client.Do(req)
+	}
+
+	if user := c.GlobalString(`http-user`); user != `` {
+		req.SetBasicAuth(user, c.GlobalString(`http-password`))
+	} else if token := c.GlobalString(`http-token`); token != `` {
+		req.Header.Set(`Authorization`, `Bearer `+token)
+	}
+
+	config := &tls.Config{}
+
+	if caFile := c.GlobalString(`http-client-ca`); caFile != `` {
+		if data, err := ioutil.ReadFile(caFile); err == nil {
+			config.RootCAs = x509.NewCertPool()
+
+			if !config.RootCAs.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("no certificates found in %s", caFile)
+			}
+		} else {
+			return nil, err
+		}
+	}
+
+	if certFile, keyFile := c.GlobalString(`http-cert`), c.GlobalString(`http-key`); certFile != `` && keyFile != `` {
+		if cert, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+			config.Certificates = []tls.Certificate{cert}
+		} else {
+			return nil, err
+		}
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: config,
+		},
+	}
+
+	return client.Do(req)
 }
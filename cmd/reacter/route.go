@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ghetzel/cli"
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/reacter"
+)
+
+// Subcommands that show how check events are routed to handlers.
+func routeCommand() cli.Command {
+	return cli.Command{
+		Name:  `route`,
+		Usage: `Show how check events are routed to handlers`,
+		Subcommands: []cli.Command{
+			{
+				Name:  `explain`,
+				Usage: `Read check events and print, for every handler, whether it would execute and the rule that decided it (without executing anything)`,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  `input, i`,
+						Usage: `Read check events from this source (see "reacter handle --input")`,
+						Value: `stdin://`,
+					},
+					cli.BoolFlag{
+						Name:  `json, j`,
+						Usage: `Print each event's node, check, state, and handler decisions as a line of JSON`,
+					},
+				},
+				Action: func(c *cli.Context) {
+					if source, err := reacter.NewSource(c.String(`input`)); err == nil {
+						if err := explainEvents(newEventRouter(c), source, c.Bool(`json`)); err != nil {
+							log.Fatalf("%v", err)
+						}
+					} else {
+						log.Fatalf("%v", err)
+					}
+				},
+			},
+		},
+	}
+}
+
+// Prints what every handler would do with each event read from the given source.
+func explainEvents(handlers *reacter.EventRouter, source reacter.Source, asJSON bool) error {
+	defer source.Close()
+
+	return handlers.ExplainSource(source, func(event reacter.CheckEvent, decisions []reacter.HandlerDecision) {
+		check := event.Check
+
+		if asJSON {
+			printJSONLine(map[string]interface{}{
+				`node`:     check.NodeName,
+				`check`:    check.Name,
+				`state`:    check.StateString(),
+				`handlers`: decisions,
+			})
+
+			return
+		}
+
+		flags := make([]string, 0)
+
+		if check.StateChanged {
+			flags = append(flags, `changed`)
+		}
+
+		if check.IsFlapping() {
+			flags = append(flags, `flapping`)
+		}
+
+		if check.IsAcknowledged() {
+			flags = append(flags, `acknowledged`)
+		}
+
+		fmt.Printf("%s/%s: %s", check.NodeName, check.Name, check.StateString())
+
+		if len(flags) > 0 {
+			fmt.Printf(" (%s)", strings.Join(flags, `, `))
+		}
+
+		fmt.Println()
+
+		if len(decisions) == 0 {
+			fmt.Printf("  no handlers are defined\n\n")
+			return
+		}
+
+		table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+		for _, decision := range decisions {
+			outcome := `skip`
+
+			if decision.Fires && decision.Grouped {
+				outcome = `group`
+			} else if decision.Fires {
+				outcome = `fire`
+			}
+
+			fmt.Fprintf(table, "  %s\t%s\t%s\t%s\n", decision.Handler, outcome, decision.Rule, decision.Reason)
+		}
+
+		table.Flush()
+		fmt.Println()
+	})
+}
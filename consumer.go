@@ -2,15 +2,76 @@ package reacter
 
 import (
 	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/ghetzel/go-stockutil/log"
 	"github.com/streadway/amqp"
 )
 
 const (
-	DEFAULT_AMQP_PORT  = 5672
-	DEFAULT_QUEUE_NAME = `reacter`
+	DEFAULT_AMQP_PORT     = 5672
+	DEFAULT_QUEUE_NAME    = `reacter`
+	DEFAULT_EXCHANGE_TYPE = `topic`
 )
 
+var DefaultAMQPPrefetch = 10
+var DefaultAMQPReconnectInterval = time.Second
+var DefaultAMQPMaxReconnectInterval = time.Minute
+
+// The subset of an AMQP channel used by consumers and publishers (satisfied by *amqp.Channel.)
+type AMQPChannel interface {
+	Qos(prefetchCount int, prefetchSize int, global bool) error
+	ExchangeDeclare(name string, kind string, durable bool, autoDelete bool, internal bool, noWait bool, args amqp.Table) error
+	QueueBind(name string, key string, exchange string, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable bool, autoDelete bool, exclusive bool, noWait bool, args amqp.Table) (amqp.Queue, error)
+	Consume(queue string, consumer string, autoAck bool, exclusive bool, noLocal bool, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Publish(exchange string, key string, mandatory bool, immediate bool, msg amqp.Publishing) error
+	Close() error
+}
+
+// The subset of an AMQP connection used by consumers and publishers.
+type AMQPConnection interface {
+	Channel() (AMQPChannel, error)
+	Close() error
+}
+
+// Establishes a connection to the AMQP broker at the given URI.  Consumers can be given a
+// different dialer to connect to something other than a real broker (e.g.: an in-process stub.)
+type AMQPDialer func(uri string) (AMQPConnection, error)
+
+var DefaultAMQPDialer AMQPDialer = func(uri string) (AMQPConnection, error) {
+	if conn, err := amqp.Dial(uri); err == nil {
+		return &amqpConnection{conn}, nil
+	} else {
+		return nil, err
+	}
+}
+
+type amqpConnection struct {
+	*amqp.Connection
+}
+
+func (self *amqpConnection) Channel() (AMQPChannel, error) {
+	if channel, err := self.Connection.Channel(); err == nil {
+		return channel, nil
+	} else {
+		return nil, err
+	}
+}
+
+// Returned by message processing functions for messages that can never be processed (e.g.: because
+// they are malformed), so that they are rejected without being retried.
+type PermanentError struct {
+	Err error
+}
+
+func (self PermanentError) Error() string {
+	return self.Err.Error()
+}
+
 type Consumer struct {
 	ID         string
 	Host       string
@@ -22,10 +83,31 @@ type Consumer struct {
 	Durable    bool
 	Autodelete bool
 	Exclusive  bool
-	conn       *amqp.Connection
-	channel    *amqp.Channel
-	queue      amqp.Queue
-	uri        amqp.URI
+	// If set, this exchange is declared and the queue is bound to it with each of the BindingKeys
+	// (or "#", matching everything, if none are given.)  For topic exchanges, binding keys may also
+	// contain glob patterns within words (e.g.: "checks.*.db-*.critical"); the broker delivers
+	// everything matching the word-level pattern, and messages that don't match are discarded here.
+	Exchange     string
+	ExchangeType string
+	BindingKeys  []string
+	// If set, messages that are rejected are routed to this (fanout) exchange, which is declared
+	// along with a queue named DeadLetterQueue (or "<queue>.dead-letter") to retain them.
+	DeadLetterExchange string
+	DeadLetterQueue    string
+	// How many unacknowledged messages the broker will deliver at once (0 for no limit.)
+	Prefetch int
+	// How long to wait before the first attempt to reconnect after losing the connection; the
+	// wait doubles after each failed attempt, up to MaxReconnectInterval.
+	ReconnectInterval    time.Duration
+	MaxReconnectInterval time.Duration
+	Dialer               AMQPDialer
+	conn                 AMQPConnection
+	channel              AMQPChannel
+	queue                amqp.Queue
+	uri                  amqp.URI
+	done                 chan struct{}
+	closed               bool
+	lock                 sync.Mutex
 }
 
 func NewConsumer(uri string) (*Consumer, error) {
@@ -39,6 +121,12 @@ func NewConsumer(uri string) (*Consumer, error) {
 		c.Password = u.Password
 		c.Vhost = u.Vhost
 		c.QueueName = DEFAULT_QUEUE_NAME
+		c.ExchangeType = DEFAULT_EXCHANGE_TYPE
+		c.Prefetch = DefaultAMQPPrefetch
+		c.ReconnectInterval = DefaultAMQPReconnectInterval
+		c.MaxReconnectInterval = DefaultAMQPMaxReconnectInterval
+		c.Dialer = DefaultAMQPDialer
+		c.done = make(chan struct{})
 
 		return c, nil
 	} else {
@@ -46,30 +134,59 @@ func NewConsumer(uri string) (*Consumer, error) {
 	}
 }
 
+// Closes the connection to the broker.  Subscriptions stop, and are not reconnected.
 func (self *Consumer) Close() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
 	if self.conn == nil {
 		return fmt.Errorf("Cannot close, connection does not exist")
 	}
 
+	if !self.closed {
+		self.closed = true
+		close(self.done)
+	}
+
 	return self.conn.Close()
 }
 
+// Connects to the broker, applies the prefetch limit, and declares the queue.
 func (self *Consumer) Connect() error {
-	if conn, err := amqp.Dial(self.uri.String()); err == nil {
-		self.conn = conn
+	self.lock.Lock()
+	defer self.lock.Unlock()
 
-		if channel, err := self.conn.Channel(); err == nil {
-			self.channel = channel
+	if self.closed {
+		return fmt.Errorf("Consumer is closed")
+	}
+
+	//  clean up after a lost connection
+	if self.conn != nil {
+		self.conn.Close()
+		self.conn = nil
+		self.channel = nil
+	}
+
+	if conn, err := self.Dialer(self.uri.String()); err == nil {
+		if channel, err := conn.Channel(); err == nil {
+			if self.Prefetch > 0 {
+				if err := channel.Qos(self.Prefetch, 0, false); err != nil {
+					defer conn.Close()
+					return err
+				}
+			}
 
-			if queue, err := self.channel.QueueDeclare(self.QueueName, self.Durable, self.Autodelete, self.Exclusive, false, nil); err == nil {
+			if queue, err := self.declare(channel); err == nil {
+				self.conn = conn
+				self.channel = channel
 				self.queue = queue
 				return nil
 			} else {
-				defer self.channel.Close()
+				defer conn.Close()
 				return err
 			}
 		} else {
-			defer self.conn.Close()
+			defer conn.Close()
 			return err
 		}
 	} else {
@@ -77,18 +194,166 @@ func (self *Consumer) Connect() error {
 	}
 }
 
+// Declares the queue, and any exchanges it is bound to or dead-letters to.
+func (self *Consumer) declare(channel AMQPChannel) (amqp.Queue, error) {
+	var args amqp.Table
+
+	if self.DeadLetterExchange != `` {
+		deadLetterQueue := self.DeadLetterQueue
+
+		if deadLetterQueue == `` {
+			deadLetterQueue = self.QueueName + `.dead-letter`
+		}
+
+		if err := channel.ExchangeDeclare(self.DeadLetterExchange, `fanout`, true, false, false, false, nil); err != nil {
+			return amqp.Queue{}, fmt.Errorf("declare dead letter exchange %s: %v", self.DeadLetterExchange, err)
+		}
+
+		if _, err := channel.QueueDeclare(deadLetterQueue, true, false, false, false, nil); err != nil {
+			return amqp.Queue{}, fmt.Errorf("declare dead letter queue %s: %v", deadLetterQueue, err)
+		}
+
+		if err := channel.QueueBind(deadLetterQueue, ``, self.DeadLetterExchange, false, nil); err != nil {
+			return amqp.Queue{}, fmt.Errorf("bind dead letter queue %s: %v", deadLetterQueue, err)
+		}
+
+		args = amqp.Table{
+			`x-dead-letter-exchange`: self.DeadLetterExchange,
+		}
+	}
+
+	queue, err := channel.QueueDeclare(self.QueueName, self.Durable, self.Autodelete, self.Exclusive, false, args)
+
+	if err != nil {
+		return queue, err
+	}
+
+	if self.Exchange != `` {
+		kind := self.ExchangeType
+
+		if kind == `` {
+			kind = DEFAULT_EXCHANGE_TYPE
+		}
+
+		//  exchanges are shared with publishers (and other consumers), so they're always durable
+		if err := channel.ExchangeDeclare(self.Exchange, kind, true, false, false, false, nil); err != nil {
+			return queue, fmt.Errorf("declare exchange %s: %v", self.Exchange, err)
+		}
+
+		keys := self.BindingKeys
+
+		if len(keys) == 0 {
+			keys = []string{`#`}
+		}
+
+		bound := make(map[string]bool)
+
+		for _, key := range keys {
+			if kind == `topic` {
+				key = BrokerBindingKey(key)
+			}
+
+			if bound[key] {
+				continue
+			}
+
+			if err := channel.QueueBind(queue.Name, key, self.Exchange, false, nil); err != nil {
+				return queue, fmt.Errorf("bind queue %s to %s with key %q: %v", queue.Name, self.Exchange, key, err)
+			}
+
+			bound[key] = true
+		}
+	}
+
+	return queue, nil
+}
+
+// Returns a channel that receives every message delivered to the queue.  Messages must be
+// acknowledged by the caller.  If the connection is lost, the consumer reconnects (redeclaring the
+// queue) with backoff; the channel is only closed once the consumer is closed.
 func (self *Consumer) SubscribeRaw() (<-chan amqp.Delivery, error) {
-	return self.channel.Consume(self.queue.Name, self.ID, true, self.Exclusive, false, false, nil)
+	deliveries, err := self.consume()
+
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(chan amqp.Delivery)
+
+	go func() {
+		defer close(output)
+
+		for {
+			for delivery := range deliveries {
+				if !self.Accepts(delivery.RoutingKey) {
+					log.Debugf("Discarding message %d: routing key %q matches no binding key", delivery.DeliveryTag, delivery.RoutingKey)
+
+					if err := delivery.Ack(false); err != nil {
+						log.Warningf("Failed to acknowledge message %d: %v", delivery.DeliveryTag, err)
+					}
+
+					continue
+				}
+
+				select {
+				case output <- delivery:
+				case <-self.done:
+					return
+				}
+			}
+
+			//  the broker closed the channel; either we're shutting down or the connection was lost
+			if deliveries = self.reconnect(); deliveries == nil {
+				return
+			}
+		}
+	}()
+
+	return output, nil
+}
+
+// Whether a message with the given routing key should be delivered to subscribers.  This is only
+// ever false for topic exchanges bound with keys the broker can't fully evaluate itself.
+func (self *Consumer) Accepts(routingKey string) bool {
+	if self.Exchange == `` || (self.ExchangeType != `` && self.ExchangeType != `topic`) {
+		return true
+	}
+
+	filtered := false
+
+	for _, key := range self.BindingKeys {
+		if BrokerBindingKey(key) != key {
+			filtered = true
+			break
+		}
+	}
+
+	if !filtered {
+		return true
+	}
+
+	for _, key := range self.BindingKeys {
+		if MatchRoutingKey(key, routingKey) {
+			return true
+		}
+	}
+
+	return false
 }
 
+// Returns a channel that receives the body of every message delivered to the queue.  Messages are
+// acknowledged once they have been received from the channel.
 func (self *Consumer) Subscribe() (<-chan string, error) {
 	output := make(chan string)
 
-	if msgs, err := self.SubscribeRaw(); err == nil {
+	if deliveries, err := self.SubscribeRaw(); err == nil {
 		go func() {
-			for delivery := range msgs {
-				output <- string(delivery.Body[:])
-			}
+			defer close(output)
+
+			self.process(deliveries, func(body []byte) error {
+				output <- string(body[:])
+				return nil
+			})
 		}()
 	} else {
 		return nil, err
@@ -96,3 +361,136 @@ func (self *Consumer) Subscribe() (<-chan string, error) {
 
 	return output, nil
 }
+
+// Calls fn with the body of every message delivered to the queue, acknowledging each message only
+// after fn succeeds.  Messages that fail are requeued to be retried once; messages that fail again
+// (or fail with a PermanentError) are rejected (and dead-lettered, if a DeadLetterExchange is
+// set.)  Blocks until the consumer is closed.
+func (self *Consumer) Process(fn func(body []byte) error) error {
+	if deliveries, err := self.SubscribeRaw(); err == nil {
+		self.process(deliveries, fn)
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (self *Consumer) process(deliveries <-chan amqp.Delivery, fn func(body []byte) error) {
+	for delivery := range deliveries {
+		if err := fn(delivery.Body); err == nil {
+			if err := delivery.Ack(false); err != nil {
+				log.Warningf("Failed to acknowledge message %d: %v", delivery.DeliveryTag, err)
+			}
+		} else {
+			requeue := !delivery.Redelivered
+
+			if _, ok := err.(PermanentError); ok {
+				requeue = false
+			}
+
+			if requeue {
+				log.Warningf("Failed to process message %d, requeueing: %v", delivery.DeliveryTag, err)
+			} else {
+				log.Errorf("Failed to process message %d, rejecting: %v", delivery.DeliveryTag, err)
+			}
+
+			if err := delivery.Nack(false, requeue); err != nil {
+				log.Warningf("Failed to reject message %d: %v", delivery.DeliveryTag, err)
+			}
+		}
+	}
+}
+
+func (self *Consumer) consume() (<-chan amqp.Delivery, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.channel == nil {
+		return nil, fmt.Errorf("Cannot subscribe, not connected")
+	}
+
+	return self.channel.Consume(self.queue.Name, self.ID, false, self.Exclusive, false, false, nil)
+}
+
+// Reconnects and resubscribes, retrying with exponential backoff until either it succeeds or the
+// consumer is closed (in which case nil is returned.)
+func (self *Consumer) reconnect() <-chan amqp.Delivery {
+	interval := self.ReconnectInterval
+
+	for {
+		select {
+		case <-self.done:
+			return nil
+		default:
+		}
+
+		log.Warningf("Lost connection to AMQP broker %s:%d, reconnecting in %v", self.Host, self.Port, interval)
+
+		select {
+		case <-self.done:
+			return nil
+		case <-time.After(interval):
+		}
+
+		if err := self.Connect(); err == nil {
+			if deliveries, err := self.consume(); err == nil {
+				log.Noticef("Reconnected to AMQP broker %s:%d", self.Host, self.Port)
+				return deliveries
+			} else {
+				log.Warningf("Failed to resubscribe to queue %s: %v", self.QueueName, err)
+			}
+		} else {
+			log.Warningf("Failed to reconnect to AMQP broker %s:%d: %v", self.Host, self.Port, err)
+		}
+
+		if interval *= 2; interval > self.MaxReconnectInterval {
+			interval = self.MaxReconnectInterval
+		}
+	}
+}
+
+// Returns the given topic binding key with any words that contain glob patterns (e.g.: "db-*")
+// replaced with "*", so that the broker delivers a superset of the matching messages.
+func BrokerBindingKey(pattern string) string {
+	words := strings.Split(pattern, `.`)
+
+	for i, word := range words {
+		if word != `*` && word != `#` && strings.ContainsAny(word, `*?[`) {
+			words[i] = `*`
+		}
+	}
+
+	return strings.Join(words, `.`)
+}
+
+// Whether the given routing key matches a topic binding key.  As with AMQP, "*" matches exactly one
+// dot-separated word and "#" matches zero or more words; in addition, words may contain glob
+// patterns (e.g.: "db-*" or "web-[0-9]".)
+func MatchRoutingKey(pattern string, routingKey string) bool {
+	return matchWords(strings.Split(pattern, `.`), strings.Split(routingKey, `.`))
+}
+
+func matchWords(patterns []string, words []string) bool {
+	if len(patterns) == 0 {
+		return len(words) == 0
+	}
+
+	switch patterns[0] {
+	case `#`:
+		if matchWords(patterns[1:], words) {
+			return true
+		}
+
+		return len(words) > 0 && matchWords(patterns, words[1:])
+	default:
+		if len(words) == 0 {
+			return false
+		}
+
+		if matched, err := path.Match(patterns[0], words[0]); err != nil || !matched {
+			return false
+		}
+
+		return matchWords(patterns[1:], words[1:])
+	}
+}
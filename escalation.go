@@ -0,0 +1,297 @@
+package reacter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+var DefaultEscalationCheckInterval = time.Second
+
+// An EscalationStep names one or more handlers to execute once a check has remained in a non-OK
+// state for a given amount of time.
+type EscalationStep struct {
+	After    interface{} `json:"after"`
+	Handlers []string    `json:"handlers"`
+}
+
+// An Escalation tracks the progress of a single alerting check through a handler's escalation
+// steps.  Only the check's identity and state are persisted, since its event may contain secrets.
+type Escalation struct {
+	HandlerName string           `json:"handler"`
+	CheckKey    string           `json:"check"`
+	NodeName    string           `json:"node_name"`
+	CheckName   string           `json:"check_name"`
+	State       ObservationState `json:"state"`
+	Timestamp   time.Time        `json:"timestamp"`
+	Since       time.Time        `json:"since"`
+	Step        int              `json:"step"`
+	NextAt      time.Time        `json:"next_at"`
+	Event       CheckEvent       `json:"-"`
+}
+
+func (self *Escalation) ID() string {
+	return self.HandlerName + `/` + self.CheckKey
+}
+
+// Records the latest event for the escalating check.
+func (self *Escalation) setEvent(event CheckEvent) {
+	self.Event = event
+	self.NodeName = event.Check.NodeName
+	self.CheckName = event.Check.Name
+	self.State = event.Check.State
+	self.Timestamp = event.Timestamp
+}
+
+// Rebuilds the event of an escalation that was loaded from disk from its persisted fields.
+func (self *Escalation) restoreEvent() {
+	if self.Event.Check != nil {
+		return
+	}
+
+	check := NewCheck()
+	check.NodeName = self.NodeName
+	check.Name = self.CheckName
+	check.State = self.State
+
+	self.Event = CheckEvent{
+		Timestamp: self.Timestamp,
+		Check:     check,
+	}
+}
+
+// The Escalator schedules and fires escalation steps for handlers that define them, and persists
+// pending escalations so that they survive restarts.
+type Escalator struct {
+	StateFile string
+	router    *EventRouter
+	pending   map[string]*Escalation
+	lock      sync.Mutex
+}
+
+func NewEscalator(router *EventRouter) *Escalator {
+	return &Escalator{
+		StateFile: path.Join(router.CacheDir, `escalations.json`),
+		router:    router,
+		pending:   make(map[string]*Escalation),
+	}
+}
+
+// Loads any escalations that were pending when the router last stopped.
+func (self *Escalator) Load() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if data, err := ioutil.ReadFile(self.StateFile); err == nil {
+		pending := make(map[string]*Escalation)
+
+		if err := json.Unmarshal(data, &pending); err == nil {
+			for id, escalation := range pending {
+				if self.router.Handler(escalation.HandlerName) == nil {
+					log.Warningf("Discarding pending escalation %s: handler no longer exists", id)
+					delete(pending, id)
+				} else {
+					escalation.restoreEvent()
+				}
+			}
+
+			self.pending = pending
+			log.Infof("Loaded %d pending escalation(s) from %s", len(pending), self.StateFile)
+			return nil
+		} else {
+			return fmt.Errorf("Failed to load escalations from %s: %v", self.StateFile, err)
+		}
+	} else if os.IsNotExist(err) {
+		return nil
+	} else {
+		return err
+	}
+}
+
+// Updates escalation tracking for the given handler based on the latest event for a check.
+// Recovered checks cancel any pending escalation (notifying the handlers of any steps that already
+// fired), and a newly-matched alerting check starts one.
+func (self *Escalator) Track(handler *Handler, event CheckEvent, matched bool) {
+	if len(handler.Escalations) == 0 || event.Check == nil {
+		return
+	}
+
+	for _, name := range self.track(handler, event, matched) {
+		if target := self.router.Handler(name); target != nil {
+			self.router.execute(target, event)
+		}
+	}
+}
+
+func (self *Escalator) track(handler *Handler, event CheckEvent, matched bool) []string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	var notify []string
+
+	escalation := &Escalation{
+		HandlerName: handler.Name,
+		CheckKey:    IncidentDedupKey(event.Check),
+	}
+
+	id := escalation.ID()
+
+	if existing, ok := self.pending[id]; ok {
+		if event.Check.IsOK() {
+			log.Infof("Check %s recovered, cancelling escalation for handler '%s'", existing.CheckKey, handler.Name)
+			delete(self.pending, id)
+
+			for i := 0; i < existing.Step && i < len(handler.Escalations); i++ {
+				notify = append(notify, handler.Escalations[i].Handlers...)
+			}
+		} else {
+			existing.setEvent(event)
+		}
+	} else if matched && !event.Check.IsOK() {
+		escalation.Since = event.Timestamp
+
+		if escalation.Since.IsZero() {
+			escalation.Since = time.Now()
+		}
+
+		escalation.setEvent(event)
+		escalation.NextAt = escalation.Since.Add(duration(handler.Escalations[0].After))
+		self.pending[id] = escalation
+
+		log.Debugf("Escalation for %s via handler '%s' will begin at %v", escalation.CheckKey, handler.Name, escalation.NextAt)
+	} else {
+		return nil
+	}
+
+	self.save()
+	return notify
+}
+
+// Cancels all pending escalations for the given check.
+func (self *Escalator) Cancel(nodeName string, checkName string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	key := fmt.Sprintf("%s:%s", nodeName, checkName)
+	cancelled := false
+
+	for id, escalation := range self.pending {
+		if escalation.CheckKey == key {
+			delete(self.pending, id)
+			cancelled = true
+		}
+	}
+
+	if cancelled {
+		log.Infof("Cancelled pending escalations for %s", key)
+		self.save()
+	}
+}
+
+// Returns a copy of every pending escalation, ordered by when their next step is due.
+func (self *Escalator) Pending() []Escalation {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	escalations := make([]Escalation, 0, len(self.pending))
+
+	for _, escalation := range self.pending {
+		escalations = append(escalations, *escalation)
+	}
+
+	sort.Slice(escalations, func(i int, j int) bool {
+		return escalations[i].NextAt.Before(escalations[j].NextAt)
+	})
+
+	return escalations
+}
+
+// Periodically fire any escalation steps that have come due.
+func (self *Escalator) Run() {
+	ticker := time.NewTicker(DefaultEscalationCheckInterval)
+
+	for range ticker.C {
+		self.fireDue(time.Now())
+	}
+}
+
+func (self *Escalator) fireDue(now time.Time) {
+	for _, escalation := range self.Pending() {
+		handler := self.router.Handler(escalation.HandlerName)
+
+		if handler == nil {
+			self.lock.Lock()
+			delete(self.pending, escalation.ID())
+			self.save()
+			self.lock.Unlock()
+			continue
+		} else if escalation.Step >= len(handler.Escalations) || escalation.NextAt.After(now) {
+			//  exhausted escalations are kept until the check recovers so they are not restarted
+			continue
+		} else if acks := self.router.Acks; acks != nil {
+			if ack := acks.Get(escalation.NodeName, escalation.CheckName); ack != nil {
+				log.Infof("Check %s was acknowledged by %s, not escalating", escalation.CheckKey, ack.Author)
+				self.Cancel(escalation.NodeName, escalation.CheckName)
+				continue
+			}
+		}
+
+		step := handler.Escalations[escalation.Step]
+		event := escalation.Event
+		event.EscalationLevel = escalation.Step + 1
+
+		log.Noticef("Check %s has been alerting for %v, escalating to step %d of handler '%s'", escalation.CheckKey, now.Sub(escalation.Since).Round(time.Second), event.EscalationLevel, handler.Name)
+
+		for _, name := range step.Handlers {
+			if target := self.router.Handler(name); target != nil {
+				self.router.execute(target, event)
+			} else {
+				log.Warningf("Handler '%s' escalation step %d refers to unknown handler '%s'", handler.Name, event.EscalationLevel, name)
+			}
+		}
+
+		self.advance(escalation, handler)
+	}
+}
+
+// Moves the pending escalation that the given copy was taken from on to its next step.
+func (self *Escalator) advance(fired Escalation, handler *Handler) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	escalation, ok := self.pending[fired.ID()]
+
+	//  the escalation may have been cancelled (or restarted) while its step was executing
+	if !ok || escalation.Step != fired.Step || !escalation.Since.Equal(fired.Since) {
+		return
+	}
+
+	escalation.Step += 1
+
+	if escalation.Step < len(handler.Escalations) {
+		escalation.NextAt = escalation.Since.Add(duration(handler.Escalations[escalation.Step].After))
+	} else {
+		escalation.NextAt = time.Time{}
+	}
+
+	self.save()
+}
+
+func (self *Escalator) save() {
+	if data, err := json.MarshalIndent(self.pending, ``, `  `); err == nil {
+		if err := os.MkdirAll(path.Dir(self.StateFile), 0755); err != nil {
+			log.Errorf("Failed to save escalations: %v", err)
+		} else if err := ioutil.WriteFile(self.StateFile, data, 0600); err != nil {
+			log.Errorf("Failed to save escalations: %v", err)
+		}
+	} else {
+		log.Errorf("Failed to save escalations: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package reacter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newEscalationTestRouter(t *testing.T) (*EventRouter, *Handler) {
+	dir, err := ioutil.TempDir(``, `reacter-escalation`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := NewEventRouter()
+	router.CacheDir = dir
+	router.Acks = nil
+
+	handler := &Handler{
+		Name: `pager`,
+		Escalations: []EscalationStep{
+			{After: `1m`, Handlers: []string{`manager`}},
+		},
+	}
+
+	router.AddHandler(handler)
+	router.AddHandler(&Handler{
+		Name:    `manager`,
+		Disable: true,
+	})
+
+	return router, handler
+}
+
+func alertingEvent(at time.Time) CheckEvent {
+	check := NewCheck()
+	check.NodeName = `db1`
+	check.Name = `disk`
+	check.State = CriticalState
+	check.Environment = Values{`DB_PASSWORD`: `hunter2`}
+	check.Parameters = map[string]interface{}{`api_token`: `abc123`}
+
+	return CheckEvent{
+		Timestamp: at,
+		Check:     check,
+		Output:    `disk is full`,
+	}
+}
+
+func TestEscalatorPersistsOnlyCheckIdentity(t *testing.T) {
+	router, handler := newEscalationTestRouter(t)
+	defer os.RemoveAll(router.CacheDir)
+
+	escalator := NewEscalator(router)
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	escalator.Track(handler, alertingEvent(at), true)
+
+	data, err := ioutil.ReadFile(escalator.StateFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{`hunter2`, `abc123`, `disk is full`} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("escalation state contains %q: %s", secret, data)
+		}
+	}
+
+	if info, err := os.Stat(escalator.StateFile); err != nil {
+		t.Fatal(err)
+	} else if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("escalation state has mode %o, expected 600", mode)
+	}
+
+	restored := NewEscalator(router)
+
+	if err := restored.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	pending := restored.Pending()
+
+	if len(pending) != 1 {
+		t.Fatalf("expected 1 pending escalation, got %d", len(pending))
+	}
+
+	escalation := pending[0]
+
+	if escalation.Event.Check == nil {
+		t.Fatalf("restored escalation has no event")
+	} else if escalation.Event.Check.NodeName != `db1` || escalation.Event.Check.Name != `disk` || escalation.Event.Check.State != CriticalState {
+		t.Errorf("restored the wrong check: %+v", escalation.Event.Check)
+	} else if !escalation.Event.Timestamp.Equal(at) {
+		t.Errorf("restored timestamp %v, expected %v", escalation.Event.Timestamp, at)
+	} else if !escalation.NextAt.Equal(at.Add(time.Minute)) {
+		t.Errorf("next step at %v, expected %v", escalation.NextAt, at.Add(time.Minute))
+	}
+}
+
+func TestEscalatorFiresDueSteps(t *testing.T) {
+	router, handler := newEscalationTestRouter(t)
+	defer os.RemoveAll(router.CacheDir)
+
+	escalator := NewEscalator(router)
+	at := time.Now().Add(-2 * time.Minute)
+
+	escalator.Track(handler, alertingEvent(at), true)
+
+	escalator.fireDue(at.Add(30 * time.Second))
+
+	if step := escalator.Pending()[0].Step; step != 0 {
+		t.Fatalf("escalated before the step was due (step %d)", step)
+	}
+
+	escalator.fireDue(time.Now())
+
+	if step := escalator.Pending()[0].Step; step != 1 {
+		t.Fatalf("expected step 1 after firing, got %d", step)
+	}
+
+	recovered := alertingEvent(time.Now())
+	recovered.Check.State = SuccessState
+	escalator.Track(handler, recovered, false)
+
+	if n := len(escalator.Pending()); n != 0 {
+		t.Fatalf("expected recovery to cancel the escalation, %d pending", n)
+	}
+
+	if _, err := os.Stat(filepath.Join(router.CacheDir, `escalations.json`)); err != nil {
+		t.Fatal(err)
+	}
+}
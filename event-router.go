@@ -1,13 +1,13 @@
 package reacter
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ghetzel/go-stockutil/executil"
@@ -27,19 +27,45 @@ type EventRouter struct {
 	ConfigFile string
 	ConfigDir  string
 	CacheDir   string
+	Acks       *AckStore
+	Nodes      *NodeRegistry
+	Redactor   *Redactor
+	// Checks that don't specify a freshness_threshold are considered stale after this long.
+	FreshnessThreshold time.Duration
+	escalator          *Escalator
+	aggregator         *Aggregator
+	freshness          *FreshnessTracker
+	dispatch           sync.Mutex
+	lock               sync.Mutex
 }
 
 type HandlerConfig struct {
-	HandlerDefinitions []Handler `json:"handlers"`
+	HandlerDefinitions []Handler    `json:"handlers"`
+	Redact             RedactConfig `json:"redact"`
 }
 
 func NewEventRouter() *EventRouter {
-	return &EventRouter{
+	router := &EventRouter{
 		CacheDir: DefaultCacheDir,
+		Acks:     NewAckStore(DefaultAckFile),
+		Nodes:    NewNodeRegistry(),
+		Redactor: NewRedactor(),
 	}
+
+	router.aggregator = NewAggregator(router)
+	router.freshness = NewFreshnessTracker(router)
+	return router
 }
 
 func (self *EventRouter) AddHandler(handler *Handler) error {
+	if handler.CacheDir == `` {
+		handler.CacheDir = self.CacheDir
+	}
+
+	if handler.redactor == nil {
+		handler.redactor = self.Redactor
+	}
+
 	//  load cache data
 	handler.LoadNodeFile()
 
@@ -58,8 +84,12 @@ func (self *EventRouter) LoadConfig(path string) error {
 			handlerConfigs := HandlerConfig{}
 
 			if err := yaml.Unmarshal(data, &handlerConfigs); err == nil {
-				for _, handler := range handlerConfigs.HandlerDefinitions {
-					if err := self.AddHandler(&handler); err != nil {
+				self.Redactor.Configure(handlerConfigs.Redact)
+
+				for i := range handlerConfigs.HandlerDefinitions {
+					handler := &handlerConfigs.HandlerDefinitions[i]
+
+					if err := self.AddHandler(handler); err != nil {
 						log.Errorf("Error adding handler '%s': %v", handler.Name, err)
 					}
 				}
@@ -114,58 +144,227 @@ func (self *EventRouter) RegenerateCache() {
 	}
 }
 
-func (self *EventRouter) Run(input io.Reader) error {
-	if err := self.ReloadConfig(); err == nil {
-		log.Infof("%d handler(s) registered", len(self.Handlers))
-
-		if len(self.Handlers) > 0 {
-			inputScanner := bufio.NewScanner(input)
-			hasErrored := false
-
-			//  for each line of input...
-			for inputScanner.Scan() {
-				line := inputScanner.Text()
-				done := make(chan bool)
-
-				go func() {
-					var check CheckEvent
-
-					//  load the input line and execute all matching handlers
-					if err := json.Unmarshal([]byte(line[:]), &check); err == nil && check.Check != nil {
-						for _, handler := range self.Handlers {
-							//  check if we should execute then do so
-							if handler.ShouldExec(check.Check) {
-								if err := handler.Execute(check); err != nil {
-									log.Errorf("Error executing handler %s: %v", handler.Name, err)
-									hasErrored = true
-								} else {
-									log.Infof("Executed handler '%s' for check %s/%s", handler.Name, check.Check.NodeName, check.Check.Name)
-								}
-
-								handler.lastFiredAt = time.Now()
-							}
-						}
-					} else {
-						log.Warningf("Failed to parse input line: %v", err)
-					}
+// Returns the handler with the given name, or nil if no such handler exists.
+func (self *EventRouter) Handler(name string) *Handler {
+	for _, handler := range self.Handlers {
+		if handler.Name == name {
+			return handler
+		}
+	}
+
+	return nil
+}
 
-					done <- true
-				}()
+// Evaluates the given event against every handler, executing the ones that match it.
+func (self *EventRouter) Dispatch(event CheckEvent) error {
+	var failed int
 
-				select {
-				case <-done:
-				}
+	//  heartbeats only update the node registry, unless they bring a dead node back to life
+	if event.Heartbeat != nil {
+		if recovered := self.Nodes.Observe(event.Heartbeat); recovered != nil {
+			return self.Dispatch(*recovered)
+		}
+
+		return nil
+	} else if event.Check == nil {
+		return fmt.Errorf("event does not describe a check")
+	}
+
+	self.dispatch.Lock()
+	defer self.dispatch.Unlock()
+
+	//  node liveness is tracked by heartbeats, not freshness
+	if event.Check.Name != NodeAliveCheckName {
+		self.freshness.Observe(event)
+	}
+
+	//  acknowledged checks don't escalate any further
+	if self.Acks != nil && event.Check.Acknowledgement == nil {
+		self.Acks.Observe(event.Check)
+	}
+
+	if event.Check.IsAcknowledged() && self.escalator != nil {
+		self.escalator.Cancel(event.Check.NodeName, event.Check.Name)
+	}
+
+	for _, handler := range self.Handlers {
+		//  check if we should execute then do so
+		matched := handler.ShouldExec(event.Check)
+
+		if matched {
+			if handler.IsGrouped() {
+				self.aggregator.Add(handler, event)
+			} else if err := self.execute(handler, event); err != nil {
+				failed += 1
 			}
+		}
+
+		if self.escalator != nil {
+			self.escalator.Track(handler, event, matched)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d handler(s) failed for check %s/%s", failed, event.Check.NodeName, event.Check.Name)
+	}
+
+	return nil
+}
 
-			if hasErrored {
-				return fmt.Errorf("Encountered one or more errors during handler execution")
+func (self *EventRouter) execute(handler *Handler, event CheckEvent) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	err := handler.Execute(event)
+
+	if err != nil {
+		log.Errorf("Error executing handler %s: %v", handler.Name, err)
+	} else {
+		log.Infof("Executed handler '%s' for check %s/%s", handler.Name, event.Check.NodeName, event.Check.Name)
+	}
+
+	handler.lastFiredAt = time.Now()
+	return err
+}
+
+func (self *EventRouter) startEscalations() {
+	for _, handler := range self.Handlers {
+		if len(handler.Escalations) > 0 {
+			self.escalator = NewEscalator(self)
+
+			if err := self.escalator.Load(); err != nil {
+				log.Warningf("%v", err)
 			}
-		} else {
-			log.Infof("No handlers defined, nothing to do")
+
+			go self.escalator.Run()
+			return
 		}
+	}
+}
 
-		return nil
+// Reads events (one JSON-encoded event per line) from the given reader until it is exhausted.
+func (self *EventRouter) Run(input io.Reader) error {
+	return self.RunSource(NewStreamSource(input, nil))
+}
+
+// Consumes events from the given (connected) AMQP consumer until it is closed.  Each message is
+// acknowledged once every handler that matches it has executed successfully.  Messages whose
+// handlers fail are retried once, then rejected; messages that can't be parsed are rejected
+// immediately (see Consumer.Process.)
+func (self *EventRouter) RunConsumer(consumer *Consumer) error {
+	return self.RunSource(consumer)
+}
+
+// Reads events from the given source and executes all matching handlers, until the source is
+// exhausted or closed.
+func (self *EventRouter) RunSource(source Source) error {
+	if ok, err := self.start(); err != nil {
+		return err
+	} else if ok {
+		//  don't leave any grouped events behind once the input is exhausted
+		defer self.aggregator.Flush()
+
+		return source.Read(self.dispatchJSON)
+	}
+
+	return nil
+}
+
+// Loads the configuration and starts background processing, returning whether there are any
+// handlers to dispatch events to.
+func (self *EventRouter) start() (bool, error) {
+	if err := self.ReloadConfig(); err != nil {
+		return false, err
+	}
+
+	log.Infof("%d handler(s) registered", len(self.Handlers))
+
+	if len(self.Handlers) == 0 {
+		log.Infof("No handlers defined, nothing to do")
+		return false, nil
+	}
+
+	self.startEscalations()
+	go self.watchFreshness()
+	go self.watchNodes()
+
+	return true, nil
+}
+
+// Parses a JSON-encoded event and dispatches it to handlers.
+func (self *EventRouter) dispatchJSON(data []byte) error {
+	if event, err := parseEvent(data); err == nil {
+		return self.Dispatch(event)
 	} else {
 		return err
 	}
 }
+
+// Describes what each handler would do with the given event, and why, without executing anything
+// (not even query commands.)  Handlers that would fire are considered to have fired, so that their
+// cooldowns apply to subsequent events.  Heartbeats aren't handled, so they have no decisions.
+func (self *EventRouter) Explain(event CheckEvent) []HandlerDecision {
+	if event.Check == nil {
+		return nil
+	}
+
+	self.dispatch.Lock()
+	defer self.dispatch.Unlock()
+
+	//  acknowledgements are only looked up: Dispatch would also clear outdated ones from the file
+	if self.Acks != nil && event.Check.Acknowledgement == nil {
+		event.Check.Acknowledgement = self.Acks.Get(event.Check.NodeName, event.Check.Name)
+	}
+
+	decisions := make([]HandlerDecision, 0, len(self.Handlers))
+
+	for _, handler := range self.Handlers {
+		decision := handler.Decide(event.Check, false)
+
+		//  grouped handlers fire once their group is complete, which never happens here
+		if decision.Fires && !decision.Grouped {
+			handler.lastFiredAt = time.Now()
+		}
+
+		decisions = append(decisions, decision)
+	}
+
+	return decisions
+}
+
+// Loads the configuration and reads events from the given source until it is exhausted or closed,
+// calling fn with each check event and what every handler would do with it (see Explain.)
+func (self *EventRouter) ExplainSource(source Source, fn func(event CheckEvent, decisions []HandlerDecision)) error {
+	if err := self.ReloadConfig(); err != nil {
+		return err
+	}
+
+	return source.Read(func(data []byte) error {
+		if event, err := parseEvent(data); err == nil {
+			if event.Check != nil {
+				fn(event, self.Explain(event))
+			}
+
+			return nil
+		} else {
+			return err
+		}
+	})
+}
+
+// Parses a JSON-encoded check event or heartbeat.
+func parseEvent(data []byte) (CheckEvent, error) {
+	var event CheckEvent
+
+	if err := json.Unmarshal(data, &event); err != nil {
+		return event, PermanentError{err}
+	} else if event.Check == nil && event.Heartbeat == nil {
+		return event, PermanentError{fmt.Errorf("not a check event or heartbeat")}
+	} else if event.Check != nil && event.Check.Observations == nil {
+		//  events that didn't come from a reacter check (e.g.: those POSTed by other tools) may not
+		//  have any observations
+		event.Check.Observations = NewObservations()
+	}
+
+	return event, nil
+}
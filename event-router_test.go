@@ -0,0 +1,105 @@
+package reacter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const eventRouterConfig = `handlers:
+- name:    record
+  checks:  [disk]
+  command: ['true']
+- name:    broken
+  checks:  [load]
+  command: ['false']
+`
+
+func TestEventRouterRunConsumer(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `reacter-router`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, `handlers.yml`)
+
+	if err := ioutil.WriteFile(config, []byte(eventRouterConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	event := func(name string) string {
+		check := NewCheck()
+		check.NodeName = `db1`
+		check.Name = name
+		check.State = CriticalState
+
+		data, err := json.Marshal(CheckEvent{Check: check})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(data)
+	}
+
+	disk := event(`disk`)
+	load := event(`load`)
+	unmatched := event(`memory`)
+
+	for _, tt := range []struct {
+		name        string
+		body        string
+		redelivered bool
+		acked       []string
+		requeued    []string
+		rejected    []string
+	}{
+		{`handler succeeded`, disk, false, []string{disk}, nil, nil},
+		{`no matching handlers`, unmatched, false, []string{unmatched}, nil, nil},
+		{`handler failed`, load, false, nil, []string{load}, nil},
+		{`handler failed again`, load, true, nil, nil, []string{load}},
+		{`not an event`, `{"hello": "world"}`, false, nil, nil, []string{`{"hello": "world"}`}},
+		{`not json`, `disk is full`, false, nil, nil, []string{`disk is full`}},
+	} {
+		router := NewEventRouter()
+		router.ConfigFile = config
+		router.CacheDir = dir
+		router.Acks = nil
+
+		broker := newStubBroker()
+		consumer := newStubConsumer(t, broker)
+
+		if err := consumer.Connect(); err != nil {
+			t.Fatal(err)
+		}
+
+		done := make(chan error)
+
+		go func() {
+			done <- router.RunConsumer(consumer)
+		}()
+
+		<-broker.subscribed
+		broker.deliver(tt.body, tt.redelivered)
+		waitFor(t, tt.name+` to be settled`, func() bool {
+			return broker.settled() == 1
+		})
+
+		consumer.Close()
+
+		if err := <-done; err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if !reflect.DeepEqual(broker.acked, tt.acked) || !reflect.DeepEqual(broker.requeued, tt.requeued) || !reflect.DeepEqual(broker.rejected, tt.rejected) {
+			t.Errorf("%s: expected acked=%v requeued=%v rejected=%v, got acked=%v requeued=%v rejected=%v",
+				tt.name, tt.acked, tt.requeued, tt.rejected, broker.acked, broker.requeued, broker.rejected)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package reacter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/reacter/util"
+)
+
+var DefaultFreshnessCheckInterval = time.Second
+
+// Returns whether the check has gone longer than its freshness threshold without a new
+// observation, measuring from the given time if it has never been observed.
+func (self *Check) IsStaleSince(since time.Time) bool {
+	if threshold := duration(self.FreshnessThreshold); threshold > 0 {
+		last := self.LastObservedAt
+
+		if last.IsZero() {
+			last = since
+		}
+
+		return (time.Since(last) > threshold)
+	}
+
+	return false
+}
+
+// Returns a copy of the given check whose state has been set to UNKNOWN because it is stale.
+func staleCheck(check *Check) *Check {
+	stale := *check
+	stale.StateChanged = (check.State != UnknownState)
+	stale.State = UnknownState
+	stale.Stale = true
+
+	return &stale
+}
+
+// Marks the check stale and emits a synthetic UNKNOWN event if it has gone longer than its
+// freshness threshold without a new observation.  Disabled checks never go stale.  This must only
+// be called from the check's monitor (see Check.control.)
+func (self *Check) expireIfStale() error {
+	if !self.Enabled || self.Stale || !self.IsStaleSince(util.StartedAt) {
+		return nil
+	}
+
+	msg := fmt.Sprintf("Check is stale: no results in the last %v", duration(self.FreshnessThreshold))
+
+	self.StateChanged = (self.State != UnknownState)
+	self.State = UnknownState
+	self.Stale = true
+
+	self.push(Observation{
+		Timestamp: time.Now(),
+		State:     UnknownState,
+		Output:    []string{msg},
+	}, nil)
+
+	return nil
+}
+
+// Periodically looks for checks that have not produced an observation within their freshness
+// threshold (e.g.: because the check keeps failing or timing out, or a passive check's results
+// stopped arriving) and emits a synthetic UNKNOWN event for each.
+func (self *Reacter) watchFreshness() {
+	ticker := time.NewTicker(DefaultFreshnessCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var wg sync.WaitGroup
+
+		for _, check := range self.Checks {
+			if duration(check.FreshnessThreshold) <= 0 {
+				continue
+			}
+
+			wg.Add(1)
+
+			//  checks are inspected concurrently so that one whose monitor is busy executing
+			//  doesn't hold up the others
+			go func(check *Check) {
+				defer wg.Done()
+
+				if _, err := check.control(check.expireIfStale, false); err != nil {
+					log.Debugf("Cannot check the freshness of check '%s': %v", check.Name, err)
+				}
+			}(check)
+		}
+
+		wg.Wait()
+	}
+}
+
+type trackedCheck struct {
+	event  CheckEvent
+	seenAt time.Time
+	stale  bool
+}
+
+// A FreshnessTracker remembers the last event received for each remote check so that the
+// EventRouter can raise an alert when a check (or an entire node) goes silent.
+type FreshnessTracker struct {
+	router *EventRouter
+	checks map[string]*trackedCheck
+	lock   sync.Mutex
+}
+
+func NewFreshnessTracker(router *EventRouter) *FreshnessTracker {
+	return &FreshnessTracker{
+		router: router,
+		checks: make(map[string]*trackedCheck),
+	}
+}
+
+// Records the receipt of an event.
+func (self *FreshnessTracker) Observe(event CheckEvent) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.checks[IncidentDedupKey(event.Check)] = &trackedCheck{
+		event:  event,
+		seenAt: time.Now(),
+		stale:  event.Check.Stale,
+	}
+}
+
+// Returns synthetic UNKNOWN events for every check that has gone stale since the last call.
+func (self *FreshnessTracker) Expired() []CheckEvent {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	events := make([]CheckEvent, 0)
+
+	for _, tracked := range self.checks {
+		if tracked.stale {
+			continue
+		}
+
+		threshold := duration(tracked.event.Check.FreshnessThreshold, self.router.FreshnessThreshold)
+
+		if threshold > 0 {
+			if silence := time.Since(tracked.seenAt); silence > threshold {
+				check := tracked.event.Check
+				msg := fmt.Sprintf("No results received for check %s from node %s in the last %v", check.Name, check.NodeName, silence.Round(time.Second))
+
+				tracked.stale = true
+				events = append(events, CheckEvent{
+					Timestamp: time.Now(),
+					Check:     staleCheck(check),
+					Output:    msg,
+				})
+			}
+		}
+	}
+
+	return events
+}
+
+func (self *EventRouter) watchFreshness() {
+	ticker := time.NewTicker(DefaultFreshnessCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, event := range self.freshness.Expired() {
+			log.Warningf("%s", event.Output)
+			self.Dispatch(event)
+		}
+	}
+}
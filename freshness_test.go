@@ -0,0 +1,148 @@
+package reacter
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestFreshnessThresholdRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		threshold interface{}
+		expected  time.Duration
+	}{
+		{`5m`, 5 * time.Minute},
+		{`26h`, 26 * time.Hour},
+		{`1h30m`, 90 * time.Minute},
+		{300, 5 * time.Minute},
+		{nil, time.Minute},
+	} {
+		reacter := NewReacter()
+
+		if err := reacter.AddCheck(CheckConfig{
+			Name:               `test`,
+			Command:            `true`,
+			FreshnessThreshold: tt.threshold,
+		}); err != nil {
+			t.Fatalf("threshold %v: %v", tt.threshold, err)
+		}
+
+		data, err := json.Marshal(CheckEvent{
+			Check: reacter.Checks[0],
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		//  this is how the EventRouter decodes events it receives
+		event, err := parseEvent(data)
+
+		if err != nil {
+			t.Fatalf("threshold %v: %v", tt.threshold, err)
+		}
+
+		router := NewEventRouter()
+		router.FreshnessThreshold = time.Minute
+		tracker := NewFreshnessTracker(router)
+		tracker.Observe(event)
+
+		tracker.checks[IncidentDedupKey(event.Check)].seenAt = time.Now().Add(-tt.expected + time.Second)
+
+		if expired := tracker.Expired(); len(expired) != 0 {
+			t.Errorf("threshold %v: check expired before %v of silence", tt.threshold, tt.expected)
+		}
+
+		tracker.checks[IncidentDedupKey(event.Check)].seenAt = time.Now().Add(-tt.expected - time.Second)
+
+		if expired := tracker.Expired(); len(expired) != 1 {
+			t.Errorf("threshold %v: check did not expire after %v of silence", tt.threshold, tt.expected)
+		} else if check := expired[0].Check; !check.Stale || check.State != UnknownState {
+			t.Errorf("threshold %v: expected a stale unknown check, got %+v", tt.threshold, check)
+		}
+	}
+}
+
+func TestCheckExpiresOnItsMonitor(t *testing.T) {
+	events := make(chan CheckEvent)
+	check := NewCheck()
+	check.Name = `passive`
+	check.Passive = true
+	check.FreshnessThreshold = `1ms`
+	check.LastObservedAt = time.Now().Add(-time.Second)
+
+	go check.Monitor(events)
+	defer func() {
+		check.StopMonitorC <- true
+	}()
+
+	done := make(chan error)
+
+	go func() {
+		_, err := check.control(check.expireIfStale, false)
+		done <- err
+	}()
+
+	select {
+	case event := <-events:
+		if !event.Check.Stale || event.Check.State != UnknownState || !event.Check.StateChanged {
+			t.Errorf("expected a stale unknown event, got %+v", event.Check)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no stale event was emitted")
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	//  a check that is already stale is not expired again
+	if _, err := check.control(check.expireIfStale, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDisabledCheckDoesNotExpire(t *testing.T) {
+	events := make(chan CheckEvent, 1)
+	check := NewCheck()
+	check.Name = `passive`
+	check.Passive = true
+	check.FreshnessThreshold = `1h`
+	check.LastObservedAt = time.Now().Add(-2 * time.Hour)
+
+	go check.Monitor(events)
+	defer func() {
+		check.StopMonitorC <- true
+	}()
+
+	if _, err := check.SetEnabled(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := check.control(check.expireIfStale, false); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-events:
+		t.Fatalf("a disabled check emitted a stale event: %+v", event.Check)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	//  re-enabling the check starts its freshness threshold over
+	if updated, err := check.SetEnabled(true); err != nil {
+		t.Fatal(err)
+	} else if time.Since(updated.LastObservedAt) > time.Minute {
+		t.Errorf("expected the check to be observed as of being enabled, got %v", updated.LastObservedAt)
+	}
+
+	if _, err := check.control(check.expireIfStale, false); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-events:
+		t.Fatalf("a re-enabled check expired immediately: %+v", event.Check)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -1,8 +1,8 @@
 package reacter
 
 import (
+	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os/exec"
 	"path"
@@ -21,26 +21,54 @@ var DefaultHandleExecTimeout = 6 * time.Second
 var DefaultHandleQueryExecTimeout = 3 * time.Second
 
 type Handler struct {
-	Name               string            `json:"name"`
-	QueryCommand       interface{}       `json:"query,omitempty"`
-	NodeFile           string            `json:"nodefile,omitempty"`
-	NodeFileAutoreload bool              `json:"nodefile_autoreload,omitempty"`
-	NodeNames          []string          `json:"node_names,omitempty"`
-	SkipOK             bool              `json:"skip_ok"`
-	CheckNames         []string          `json:"checks,omitempty"`
-	States             []int             `json:"states,omitempty"`
-	SkipFlapping       bool              `json:"skip_flapping"`
-	OnlyChanges        bool              `json:"only_changes"`
-	Command            interface{}       `json:"command,omitempty"`
-	Environment        map[string]string `json:"environment,omitempty"`
-	Parameters         map[string]string `json:"parameters,omitempty"`
-	Directory          string            `json:"directory,omitempty"`
-	Disable            bool              `json:"disable,omitempty"`
-	Timeout            interface{}       `json:"timeout,omitempty"`
-	Cooldown           interface{}       `json:"cooldown,omitempty"`
-	QueryTimeout       interface{}       `json:"query_timeout,omitempty"`
-	CacheDir           string            `json:"-"`
+	Name               string           `json:"name"`
+	QueryCommand       interface{}      `json:"query,omitempty"`
+	NodeFile           string           `json:"nodefile,omitempty"`
+	NodeFileAutoreload bool             `json:"nodefile_autoreload,omitempty"`
+	NodeNames          []string         `json:"node_names,omitempty"`
+	SkipOK             bool             `json:"skip_ok"`
+	CheckNames         []string         `json:"checks,omitempty"`
+	States             []int            `json:"states,omitempty"`
+	SkipFlapping       bool             `json:"skip_flapping"`
+	SkipAcknowledged   bool             `json:"skip_acknowledged"`
+	OnlyChanges        bool             `json:"only_changes"`
+	Command            interface{}      `json:"command,omitempty"`
+	Environment        Values           `json:"environment,omitempty"`
+	Parameters         Values           `json:"parameters,omitempty"`
+	Redact             []string         `json:"redact,omitempty"`
+	Directory          string           `json:"directory,omitempty"`
+	Disable            bool             `json:"disable,omitempty"`
+	Timeout            interface{}      `json:"timeout,omitempty"`
+	Cooldown           interface{}      `json:"cooldown,omitempty"`
+	QueryTimeout       interface{}      `json:"query_timeout,omitempty"`
+	Incident           *IncidentConfig  `json:"incident,omitempty"`
+	Escalations        []EscalationStep `json:"escalate,omitempty"`
+	OnlyEscalation     bool             `json:"only_escalation,omitempty"`
+	GroupBy            interface{}      `json:"group_by,omitempty"`
+	GroupWait          interface{}      `json:"group_wait,omitempty"`
+	CacheDir           string           `json:"-"`
 	lastFiredAt        time.Time
+	redactor           *Redactor
+}
+
+// Returns the handler's command and the given environment as they should appear in logs, with the
+// values of sensitive environment variables and parameters replaced.
+func (self *Handler) redacted(env []string) (interface{}, []string) {
+	redactor := self.redactor
+
+	if redactor == nil {
+		redactor = NewRedactor()
+	}
+
+	secrets := append(
+		redactor.secrets(self.Environment, self.Redact...),
+		redactor.secrets(self.Parameters, self.Redact...)...,
+	)
+
+	//  values read from files or the environment are always treated as secrets
+	extra := append(append(append([]string{}, self.Redact...), self.Environment.References()...), self.Parameters.References()...)
+
+	return redactor.Command(self.Command, secrets...), redactor.Environ(env, extra...)
 }
 
 func (self *Handler) cmdline(command interface{}) ([]string, error) {
@@ -116,37 +144,75 @@ func (self *Handler) ExecuteNodeQuery() ([]string, error) {
 	return rv, nil
 }
 
+// A HandlerDecision describes whether a handler executes for a check, and the rule that decided it.
+type HandlerDecision struct {
+	Handler string `json:"handler"`
+	Fires   bool   `json:"fires"`
+	Grouped bool   `json:"grouped,omitempty"`
+	Rule    string `json:"rule"`
+	Reason  string `json:"reason"`
+}
+
 func (self *Handler) ShouldExec(check *Check) bool {
+	decision := self.Decide(check, true)
+
+	//  disabled handlers are skipped silently
+	if !decision.Fires && decision.Rule != `disable` {
+		log.Debugf("Skipping handler '%s' because %s", self.Name, decision.Reason)
+	}
+
+	return decision.Fires
+}
+
+// Evaluates the handler's rules against the given check (in order, stopping at the first one that
+// rejects it), and returns the outcome.  Each rule is named after the option that configures it.
+// The query command is only executed if query is true; otherwise, the nodes it returned last (or
+// those in the node file) are used.
+func (self *Handler) Decide(check *Check, query bool) HandlerDecision {
+	skip := func(rule string, format string, args ...interface{}) HandlerDecision {
+		return HandlerDecision{
+			Handler: self.Name,
+			Rule:    rule,
+			Reason:  fmt.Sprintf(format, args...),
+		}
+	}
+
 	//  if we're disabled, don't execute
 	if self.Disable {
-		return false
+		return skip(`disable`, "it is disabled")
+	}
+
+	//  handlers that are only used as escalation steps are never matched directly
+	if self.OnlyEscalation {
+		return skip(`only_escalation`, "it only executes as an escalation step")
 	}
 
 	if cooldown := duration(self.Cooldown); cooldown > 0 {
 		if !self.lastFiredAt.IsZero() {
 			if since := time.Since(self.lastFiredAt); since < cooldown {
-				log.Debugf("Skipping handler '%s' because it is in a cooldown period (%v < %v)", self.Name, since, cooldown)
-				return false
+				return skip(`cooldown`, "it is in a cooldown period (%v < %v)", since, cooldown)
 			}
 		}
 	}
 
 	//  check if we should handle this check if it's flapping
 	if self.SkipFlapping && check.IsFlapping() {
-		log.Debugf("Skipping handler '%s' because it doesn't handle flapping but this check is flapping", self.Name)
-		return false
+		return skip(`skip_flapping`, "it doesn't handle flapping but this check is flapping")
+	}
+
+	//  check if we should handle this check if someone has acknowledged it
+	if self.SkipAcknowledged && check.IsAcknowledged() {
+		return skip(`skip_acknowledged`, "the check was acknowledged by %s", check.Acknowledgement.Author)
 	}
 
 	//  check if we should handle this check only when its state changes
 	if self.OnlyChanges && !check.StateChanged {
-		log.Debugf("Skipping handler '%s' because it only handles state changes and this check has not changed", self.Name)
-		return false
+		return skip(`only_changes`, "it only handles state changes and this check has not changed")
 	}
 
 	// check if the observation is in an OK state, but we're only supposed to fire on non-OK states
 	if self.SkipOK && check.IsOK() {
-		log.Debugf("Skipping handler '%s' because the check is okay", self.Name)
-		return false
+		return skip(`skip_ok`, "the check is okay")
 	}
 
 	//  check if we're supposed to re-read the NodeFile each time, and if so do it
@@ -154,6 +220,8 @@ func (self *Handler) ShouldExec(check *Check) bool {
 		self.LoadNodeFile()
 	}
 
+	var unqueried bool
+
 	//  only execute the query command now if we didn't name a cachefile to load the output of
 	//  said command from
 	//
@@ -161,7 +229,9 @@ func (self *Handler) ShouldExec(check *Check) bool {
 	//  event we process, instead relying on an external process to populate the data
 	//
 	if len(self.NodeFile) == 0 {
-		if nodes, err := self.ExecuteNodeQuery(); err == nil {
+		if !query {
+			unqueried = !typeutil.IsZero(self.QueryCommand)
+		} else if nodes, err := self.ExecuteNodeQuery(); err == nil {
 			self.NodeNames = nodes
 		} else {
 			log.Warningf("%v", err)
@@ -178,8 +248,7 @@ func (self *Handler) ShouldExec(check *Check) bool {
 			}
 		}
 		if !idMatched {
-			log.Debugf("Skipping handler '%s' because node '%s' is not in the list of nodes to handle", self.Name, check.NodeName)
-			return false
+			return skip(`node_names`, "node '%s' is not in the list of nodes to handle", check.NodeName)
 		}
 	}
 
@@ -198,24 +267,57 @@ func (self *Handler) ShouldExec(check *Check) bool {
 	}
 
 	if !checkMatched {
-		log.Debugf("Skipping handler '%s' because check '%s' is not in the list of checks to handle", self.Name, check.Name)
-		return false
+		return skip(`checks`, "check '%s' is not in the list of checks to handle", check.Name)
 	}
 
-	//  TODO: check if we should handle this check's state
-	//
+	//  check if we should handle this check's state
+	if len(self.States) > 0 && !sliceutil.Contains(self.States, int(check.State)) {
+		return skip(`states`, "the check's state (%s) is not in the list of states to handle", check.StateString())
+	}
 
 	//  we're here, we should execute now
-	return true
+	decision := HandlerDecision{
+		Handler: self.Name,
+		Fires:   true,
+		Grouped: self.IsGrouped(),
+		Rule:    `match`,
+		Reason:  "every rule matched",
+	}
+
+	if unqueried {
+		decision.Reason += " (the query command was not executed, so nodes were not checked)"
+	}
+
+	return decision
 }
 
 func (self *Handler) Execute(event CheckEvent) error {
 	if !self.Disable {
-		if !typeutil.IsZero(self.Command) {
-			done := make(chan bool)
+		if self.Incident != nil {
+			return self.Incident.Send(self, event)
+		} else if !typeutil.IsZero(self.Command) {
+			//  references to secrets are resolved on every execution, so changes to them take effect
+			//  without reloading
+			environment, err := self.Environment.Resolve()
+
+			if err != nil {
+				return fmt.Errorf("Handler '%s' failed to resolve its environment: %v", self.Name, err)
+			}
+
+			parameters, err := self.Parameters.Resolve()
+
+			if err != nil {
+				return fmt.Errorf("Handler '%s' failed to resolve its parameters: %v", self.Name, err)
+			}
+
+			//  buffered so that a command that outlives the timeout doesn't block forever
+			done := make(chan error, 1)
 
 			go func() {
-				log.Debugf("Executing handler '%s': %s", self.Name, self.Command)
+				var failure error
+
+				command, _ := self.redacted(nil)
+				log.Debugf("Executing handler '%s': %v", self.Name, command)
 
 				if args, err := self.cmdline(self.Command); err == nil {
 					cmd := exec.Command(args[0], args[1:]...)
@@ -228,7 +330,7 @@ func (self *Handler) Execute(event CheckEvent) error {
 					}
 
 					//  pass in environment variables
-					for k, v := range self.Environment {
+					for k, v := range environment {
 						//  cannot set environment variables that start with "REACTER_"
 						if !strings.HasPrefix(strings.ToUpper(k), `REACTER_`) {
 							cmd.Env = append(cmd.Env, k+`=`+v)
@@ -236,7 +338,7 @@ func (self *Handler) Execute(event CheckEvent) error {
 					}
 
 					//  make parameters available as environment variables with predictable names
-					for k, v := range self.Parameters {
+					for k, v := range parameters {
 						cmd.Env = append(cmd.Env, `REACTER_PARAM_`+strings.ToUpper(k)+`=`+v)
 					}
 
@@ -254,6 +356,14 @@ func (self *Handler) Execute(event CheckEvent) error {
 						cmd.Env = append(cmd.Env, `REACTER_STATE_FLAPPING=0`)
 					}
 
+					if event.Check.IsAcknowledged() {
+						cmd.Env = append(cmd.Env, `REACTER_STATE_ACKNOWLEDGED=1`)
+						cmd.Env = append(cmd.Env, `REACTER_ACK_AUTHOR=`+event.Check.Acknowledgement.Author)
+						cmd.Env = append(cmd.Env, `REACTER_ACK_COMMENT=`+event.Check.Acknowledgement.Comment)
+					} else {
+						cmd.Env = append(cmd.Env, `REACTER_STATE_ACKNOWLEDGED=0`)
+					}
+
 					if event.Check.HardState {
 						cmd.Env = append(cmd.Env, `REACTER_STATE_HARD=1`)
 					} else {
@@ -269,14 +379,39 @@ func (self *Handler) Execute(event CheckEvent) error {
 					cmd.Env = append(cmd.Env, `REACTER_EPOCH_MS=`+strconv.Itoa(int(event.Timestamp.UnixNano())/1000000))
 					cmd.Env = append(cmd.Env, `REACTER_HANDLER=`+self.Name)
 
+					if event.Group != nil {
+						cmd.Env = append(cmd.Env, `REACTER_GROUP_KEY=`+event.Group.Key)
+						cmd.Env = append(cmd.Env, `REACTER_GROUP_SIZE=`+strconv.Itoa(len(event.Group.Members)))
+					}
+
+					if event.EscalationLevel > 0 {
+						cmd.Env = append(cmd.Env, `REACTER_ESCALATION_LEVEL=`+strconv.Itoa(event.EscalationLevel))
+					}
+
 					//  -------------------------------------------------------------
 
+					if _, env := self.redacted(cmd.Env); len(env) > 0 {
+						log.Debugf("Handler '%s' environment: %s", self.Name, strings.Join(env, ` `))
+					}
+
+					input := []byte(event.Output)
+
+					//  grouped handlers receive every member event as a JSON array instead of the
+					//  group's summary
+					if event.Group != nil {
+						if data, err := json.Marshal(event.Group.Members); err == nil {
+							input = data
+						} else {
+							log.Errorf("Handler '%s' failed to encode group %q: %v", self.Name, event.Group.Key, err)
+						}
+					}
+
 					//  setup STDIN pipe and write check event data to it
 					if stdin, err := cmd.StdinPipe(); err == nil {
 
 						//  start command and write raw data to its standard input
 						if err := cmd.Start(); err == nil {
-							io.WriteString(stdin, event.Output)
+							stdin.Write(input)
 							stdin.Close()
 						} else {
 							log.Errorf("Handler '%s' failed to execute: %v", self.Name, err)
@@ -287,27 +422,34 @@ func (self *Handler) Execute(event CheckEvent) error {
 							log.Debugf("Handler '%s' executed successfully", self.Name)
 						} else {
 							log.Errorf("Handler '%s' failed during execution: %v", self.Name, err)
+							failure = err
 						}
 					} else {
 						log.Errorf("Handler '%s' failed setting up command: %v", self.Name, err)
+						failure = err
 					}
 				} else {
 					log.Warningf("Invalid command: %v", err)
+					failure = err
 				}
 
-				done <- true
+				done <- failure
 			}()
 
 			//  wait for the command to complete or the Timeout, whichever comes first
 			select {
-			case <-done:
+			case err := <-done:
 				log.Debugf("Handler '%s' execution complete", self.Name)
+
+				if err != nil {
+					return fmt.Errorf("Handler '%s' failed: %v", self.Name, err)
+				}
 			case <-time.After(duration(self.Timeout, DefaultHandleExecTimeout)):
 				return fmt.Errorf("Handler '%s' timed out after %v waiting for the handler command to execute", self.Name, duration(self.Timeout))
 			}
 		} else {
 			self.Disable = true
-			return fmt.Errorf("Cannot execute handler '%s': command not specified; disabling handler", self.Name)
+			return fmt.Errorf("Cannot execute handler '%s': neither a command nor an incident endpoint was specified; disabling handler", self.Name)
 		}
 	}
 
@@ -0,0 +1,129 @@
+package reacter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHandlerDecide(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		handler Handler
+		check   func(check *Check)
+		rule    string
+		fires   bool
+		grouped bool
+	}{
+		{
+			name:  `no rules`,
+			rule:  `match`,
+			fires: true,
+		}, {
+			name:    `disabled`,
+			handler: Handler{Disable: true, SkipOK: true},
+			rule:    `disable`,
+		}, {
+			name:    `only escalation`,
+			handler: Handler{OnlyEscalation: true},
+			rule:    `only_escalation`,
+		}, {
+			name:    `cooldown`,
+			handler: Handler{Cooldown: `1m`, lastFiredAt: time.Now()},
+			rule:    `cooldown`,
+		}, {
+			name:    `cooldown expired`,
+			handler: Handler{Cooldown: `1m`, lastFiredAt: time.Now().Add(-2 * time.Minute)},
+			rule:    `match`,
+			fires:   true,
+		}, {
+			name:    `flapping`,
+			handler: Handler{SkipFlapping: true},
+			check: func(check *Check) {
+				check.Observations.Flapping = true
+			},
+			rule: `skip_flapping`,
+		}, {
+			name:    `acknowledged`,
+			handler: Handler{SkipAcknowledged: true},
+			check: func(check *Check) {
+				check.Acknowledgement = &Acknowledgement{Author: `ops`}
+			},
+			rule: `skip_acknowledged`,
+		}, {
+			name:    `acknowledgement expired`,
+			handler: Handler{SkipAcknowledged: true},
+			check: func(check *Check) {
+				expired := time.Now().Add(-time.Minute)
+				check.Acknowledgement = &Acknowledgement{Author: `ops`, ExpiresAt: &expired}
+			},
+			rule:  `match`,
+			fires: true,
+		}, {
+			name:    `unchanged`,
+			handler: Handler{OnlyChanges: true},
+			check: func(check *Check) {
+				check.StateChanged = false
+			},
+			rule: `only_changes`,
+		}, {
+			name:    `ok`,
+			handler: Handler{SkipOK: true},
+			rule:    `skip_ok`,
+		}, {
+			name:    `not ok`,
+			handler: Handler{SkipOK: true},
+			check: func(check *Check) {
+				check.State = CriticalState
+			},
+			rule:  `match`,
+			fires: true,
+		}, {
+			name:    `other node`,
+			handler: Handler{NodeNames: []string{`db2`}},
+			rule:    `node_names`,
+		}, {
+			name:    `listed node`,
+			handler: Handler{NodeNames: []string{`db2`, `db1`}},
+			rule:    `match`,
+			fires:   true,
+		}, {
+			name:    `other check`,
+			handler: Handler{CheckNames: []string{`disk`}},
+			rule:    `checks`,
+		}, {
+			name:    `other state`,
+			handler: Handler{States: []int{int(WarningState), int(CriticalState)}},
+			rule:    `states`,
+		}, {
+			name:    `first rejecting rule decides`,
+			handler: Handler{SkipOK: true, CheckNames: []string{`disk`}, States: []int{int(CriticalState)}},
+			rule:    `skip_ok`,
+		}, {
+			name:    `grouped`,
+			handler: Handler{GroupBy: `node`, GroupWait: `30s`},
+			rule:    `match`,
+			fires:   true,
+			grouped: true,
+		},
+	} {
+		check := NewCheck()
+		check.NodeName = `db1`
+		check.Name = `replication_lag`
+
+		if tt.check != nil {
+			tt.check(check)
+		}
+
+		handler := tt.handler
+		handler.Name = `test`
+		decision := handler.Decide(check, false)
+
+		if decision.Rule != tt.rule || decision.Fires != tt.fires || decision.Grouped != tt.grouped {
+			t.Errorf("%s: expected rule %q (fires: %v, grouped: %v), got %+v", tt.name, tt.rule, tt.fires, tt.grouped, decision)
+		}
+
+		if decision.Handler != `test` || decision.Reason == `` {
+			t.Errorf("%s: expected the handler and a reason, got %+v", tt.name, decision)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package reacter
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/reacter/util"
+)
+
+// Heartbeats are opt-in, since they are events without a check that existing consumers of the
+// event stream wouldn't expect.
+var DefaultHeartbeatInterval time.Duration
+var DefaultMissedHeartbeats = 3
+var DefaultNodeCheckInterval = time.Second
+
+// The name of the built-in check raised by the EventRouter when a node stops sending heartbeats.
+const NodeAliveCheckName = `reacter_node_alive`
+
+// A Heartbeat is periodically emitted by every node running checks to announce that it is still
+// alive, even if none of its checks have changed state.
+type Heartbeat struct {
+	NodeName  string                 `json:"node"`
+	Version   string                 `json:"version"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Interval  int                    `json:"interval"`
+	Checks    int                    `json:"checks"`
+	StartedAt time.Time              `json:"started_at"`
+}
+
+// Returns a heartbeat describing this node.
+func (self *Reacter) Heartbeat() *Heartbeat {
+	return &Heartbeat{
+		NodeName:  self.NodeName,
+		Version:   util.ApplicationVersion,
+		Metadata:  self.Metadata,
+		Interval:  int(self.HeartbeatInterval / time.Second),
+		Checks:    len(self.Checks),
+		StartedAt: util.StartedAt,
+	}
+}
+
+func (self *Reacter) emitHeartbeats() {
+	if self.HeartbeatInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(self.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		self.Events <- CheckEvent{
+			Timestamp: time.Now(),
+			Heartbeat: self.Heartbeat(),
+		}
+
+		<-ticker.C
+	}
+}
+
+// A Node is the EventRouter's record of a node it has received heartbeats from.
+type Node struct {
+	Name        string                 `json:"name"`
+	Version     string                 `json:"version"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Interval    int                    `json:"interval"`
+	Checks      int                    `json:"checks"`
+	Alive       bool                   `json:"alive"`
+	StartedAt   time.Time              `json:"started_at"`
+	FirstSeenAt time.Time              `json:"first_seen_at"`
+	LastSeenAt  time.Time              `json:"last_seen_at"`
+}
+
+// Returns how long the node may go without sending a heartbeat before it is considered dead.
+func (self *Node) Deadline(missed int) time.Duration {
+	interval := time.Duration(self.Interval) * time.Second
+
+	//  intervals are reported in whole seconds, so heartbeats sent more often than that report 0
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	return interval * time.Duration(missed)
+}
+
+// Returns a synthetic check event describing whether the node is alive.
+func (self *Node) Event(missed int) CheckEvent {
+	check := NewCheck()
+	check.NodeName = self.Name
+	check.Name = NodeAliveCheckName
+	check.StateChanged = true
+	check.LastObservedAt = self.LastSeenAt
+
+	for k, v := range self.Metadata {
+		check.Parameters[k] = v
+	}
+
+	check.Parameters[`version`] = self.Version
+
+	var output string
+
+	if self.Alive {
+		check.State = SuccessState
+		output = fmt.Sprintf("Node %s is alive", self.Name)
+	} else {
+		check.State = CriticalState
+		output = fmt.Sprintf(
+			"Node %s missed %d heartbeat(s); last seen %v ago",
+			self.Name,
+			missed,
+			time.Since(self.LastSeenAt).Round(time.Second),
+		)
+	}
+
+	return CheckEvent{
+		Timestamp: time.Now(),
+		Check:     check,
+		Observation: &Observation{
+			Timestamp: time.Now(),
+			State:     check.State,
+			Output:    []string{output},
+		},
+		Output: output,
+	}
+}
+
+// A NodeRegistry tracks every node the EventRouter has received heartbeats from and raises a
+// reacter_node_alive event whenever one of them misses too many heartbeats (and again when it
+// comes back.)
+type NodeRegistry struct {
+	MissedHeartbeats int
+	nodes            map[string]*Node
+	lock             sync.Mutex
+}
+
+func NewNodeRegistry() *NodeRegistry {
+	return &NodeRegistry{
+		MissedHeartbeats: DefaultMissedHeartbeats,
+		nodes:            make(map[string]*Node),
+	}
+}
+
+// Records the receipt of a heartbeat.  If the node had previously been declared dead, an event
+// announcing its recovery is returned.
+func (self *NodeRegistry) Observe(heartbeat *Heartbeat) *CheckEvent {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if heartbeat.NodeName == `` {
+		return nil
+	}
+
+	now := time.Now()
+	node, ok := self.nodes[heartbeat.NodeName]
+
+	if !ok {
+		log.Infof("Node %s registered (version %s)", heartbeat.NodeName, heartbeat.Version)
+
+		node = &Node{
+			Name:        heartbeat.NodeName,
+			Alive:       true,
+			FirstSeenAt: now,
+		}
+
+		self.nodes[node.Name] = node
+	}
+
+	node.Version = heartbeat.Version
+	node.Metadata = heartbeat.Metadata
+	node.Interval = heartbeat.Interval
+	node.Checks = heartbeat.Checks
+	node.StartedAt = heartbeat.StartedAt
+	node.LastSeenAt = now
+
+	if !node.Alive {
+		node.Alive = true
+		log.Noticef("Node %s is alive again", node.Name)
+
+		event := node.Event(self.MissedHeartbeats)
+		return &event
+	}
+
+	return nil
+}
+
+// Returns all known nodes, sorted by name.
+func (self *NodeRegistry) List() []Node {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	nodes := make([]Node, 0, len(self.nodes))
+
+	for _, node := range self.nodes {
+		nodes = append(nodes, *node)
+	}
+
+	sort.Slice(nodes, func(i int, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+
+	return nodes
+}
+
+// Returns an event for every node that has missed too many heartbeats since the last call.
+func (self *NodeRegistry) Expired() []CheckEvent {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	events := make([]CheckEvent, 0)
+
+	for _, node := range self.nodes {
+		if node.Alive && time.Since(node.LastSeenAt) > node.Deadline(self.MissedHeartbeats) {
+			node.Alive = false
+			events = append(events, node.Event(self.MissedHeartbeats))
+		}
+	}
+
+	return events
+}
+
+func (self *EventRouter) watchNodes() {
+	ticker := time.NewTicker(DefaultNodeCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, event := range self.Nodes.Expired() {
+			log.Errorf("%s", event.Output)
+			self.Dispatch(event)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package reacter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeartbeatsAreOptIn(t *testing.T) {
+	reacter := NewReacter()
+
+	if reacter.HeartbeatInterval != 0 {
+		t.Fatalf("expected heartbeats to be disabled by default, got an interval of %v", reacter.HeartbeatInterval)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		//  Events is unbuffered, so a heartbeat would block this
+		reacter.emitHeartbeats()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case event := <-reacter.Events:
+		t.Fatalf("a heartbeat was emitted with an interval of 0: %+v", event.Heartbeat)
+	case <-time.After(time.Second):
+		t.Fatal("emitHeartbeats did not return")
+	}
+}
+
+func TestEmitHeartbeats(t *testing.T) {
+	reacter := NewReacter()
+	reacter.NodeName = `db1`
+	reacter.HeartbeatInterval = 10 * time.Millisecond
+	reacter.Metadata[`role`] = `db`
+
+	go reacter.emitHeartbeats()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-reacter.Events:
+			if event.Check != nil || event.Heartbeat == nil {
+				t.Fatalf("expected a heartbeat without a check, got %+v", event)
+			} else if hb := event.Heartbeat; hb.NodeName != `db1` || hb.Metadata[`role`] != `db` || event.Timestamp.IsZero() {
+				t.Errorf("unexpected heartbeat %+v", hb)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("heartbeat %d was not emitted", i+1)
+		}
+	}
+}
+
+func TestNodeDeadline(t *testing.T) {
+	for _, tt := range []struct {
+		interval int
+		missed   int
+		expected time.Duration
+	}{
+		{30, 3, 90 * time.Second},
+		{30, 1, 30 * time.Second},
+		{0, 3, 3 * time.Second},
+	} {
+		node := &Node{Interval: tt.interval}
+
+		if deadline := node.Deadline(tt.missed); deadline != tt.expected {
+			t.Errorf("interval %d, %d missed: expected %v, got %v", tt.interval, tt.missed, tt.expected, deadline)
+		}
+	}
+}
+
+func TestNodeRegistry(t *testing.T) {
+	registry := NewNodeRegistry()
+	heartbeat := &Heartbeat{
+		NodeName: `db1`,
+		Version:  `1.1.0`,
+		Interval: 30,
+	}
+
+	if event := registry.Observe(&Heartbeat{}); event != nil {
+		t.Errorf("expected heartbeats without a node name to be ignored, got %+v", event)
+	}
+
+	if event := registry.Observe(heartbeat); event != nil {
+		t.Errorf("expected no event for a new node, got %+v", event.Check)
+	}
+
+	if expired := registry.Expired(); len(expired) != 0 {
+		t.Errorf("expected a node that just sent a heartbeat to be alive, got %d event(s)", len(expired))
+	}
+
+	registry.nodes[`db1`].LastSeenAt = time.Now().Add(-91 * time.Second)
+
+	if expired := registry.Expired(); len(expired) != 1 {
+		t.Fatalf("expected a node that missed 3 heartbeats to expire, got %d event(s)", len(expired))
+	} else if check := expired[0].Check; check.Name != NodeAliveCheckName || check.NodeName != `db1` || check.State != CriticalState {
+		t.Errorf("expected a critical %s event for db1, got %+v", NodeAliveCheckName, check)
+	}
+
+	if expired := registry.Expired(); len(expired) != 0 {
+		t.Errorf("expected a dead node to be reported once, got %d more event(s)", len(expired))
+	}
+
+	if event := registry.Observe(heartbeat); event == nil {
+		t.Error("expected an event when the node came back")
+	} else if event.Check.State != SuccessState {
+		t.Errorf("expected an okay event when the node came back, got %+v", event.Check)
+	}
+
+	if nodes := registry.List(); len(nodes) != 1 || !nodes[0].Alive || nodes[0].Version != `1.1.0` {
+		t.Errorf("expected db1 to be listed as alive, got %+v", nodes)
+	}
+}
@@ -0,0 +1,91 @@
+package reacter
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+var DefaultHistorySize = 100
+
+// A HistoryEntry is a single past result of a check.
+type HistoryEntry struct {
+	Timestamp       time.Time              `json:"timestamp"`
+	State           ObservationState       `json:"state"`
+	StateName       string                 `json:"state_name"`
+	Output          string                 `json:"output,omitempty"`
+	Error           bool                   `json:"error,omitempty"`
+	PerformanceData map[string]Measurement `json:"perfdata,omitempty"`
+}
+
+// A History retains the most recent results of a check.  Unlike Observations (which only keep
+// enough results for rise/fall and flap detection), the size of a check's history is
+// configurable.
+type History struct {
+	Size    int `json:"size"`
+	entries []HistoryEntry
+	lock    sync.Mutex
+}
+
+func NewHistory(size int) *History {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+
+	return &History{
+		Size:    size,
+		entries: make([]HistoryEntry, 0),
+	}
+}
+
+// Records the result described by the given event.
+func (self *History) Push(event CheckEvent) {
+	entry := HistoryEntry{
+		Timestamp: event.Timestamp,
+		Output:    event.Output,
+		Error:     event.Error,
+	}
+
+	if event.Observation != nil {
+		entry.State = event.Observation.State
+		entry.Output = strings.Join(event.Observation.Output, "\n")
+
+		if len(event.Observation.PerformanceData) > 0 {
+			entry.PerformanceData = event.Observation.PerformanceData
+		}
+	} else {
+		entry.State = UnknownState
+	}
+
+	entry.StateName = entry.State.String()
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if len(self.entries) >= self.Size {
+		self.entries = self.entries[len(self.entries)-self.Size+1:]
+	}
+
+	self.entries = append(self.entries, entry)
+}
+
+// Returns up to limit of the most recent entries (all of them if limit <= 0) that occurred after
+// the given time, oldest first.
+func (self *History) Entries(since time.Time, limit int) []HistoryEntry {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	entries := make([]HistoryEntry, 0, len(self.entries))
+
+	for _, entry := range self.entries {
+		if entry.Timestamp.After(since) {
+			entries = append(entries, entry)
+		}
+	}
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	return entries
+}
@@ -0,0 +1,93 @@
+package reacter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHistoryEntries(t *testing.T) {
+	start := time.Now()
+	history := NewHistory(5)
+
+	//  seven results are pushed, so only the last five are retained
+	for i := 1; i <= 7; i++ {
+		history.Push(CheckEvent{
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Observation: &Observation{
+				State:  ObservationState(i % 3),
+				Output: []string{fmt.Sprintf("result %d", i)},
+			},
+		})
+	}
+
+	for _, tt := range []struct {
+		name     string
+		since    time.Time
+		limit    int
+		expected []int
+	}{
+		{`everything retained`, time.Time{}, 0, []int{3, 4, 5, 6, 7}},
+		{`limited to the most recent`, time.Time{}, 2, []int{6, 7}},
+		{`limit larger than the history`, time.Time{}, 10, []int{3, 4, 5, 6, 7}},
+		{`since`, start.Add(5 * time.Second), 0, []int{6, 7}},
+		{`since and limit`, start.Add(3 * time.Second), 1, []int{7}},
+		{`since the last result`, start.Add(7 * time.Second), 0, []int{}},
+	} {
+		entries := history.Entries(tt.since, tt.limit)
+		results := make([]int, len(entries))
+
+		for i, entry := range entries {
+			fmt.Sscanf(entry.Output, "result %d", &results[i])
+		}
+
+		if fmt.Sprint(results) != fmt.Sprint(tt.expected) {
+			t.Errorf("%s: expected results %v, got %v", tt.name, tt.expected, results)
+		}
+	}
+}
+
+func TestHistoryPush(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		event  CheckEvent
+		state  ObservationState
+		output string
+	}{
+		{
+			name: `observation`,
+			event: CheckEvent{
+				Timestamp: time.Now(),
+				Output:    `ignored`,
+				Observation: &Observation{
+					State:  WarningState,
+					Output: []string{`line 1`, `line 2`},
+				},
+			},
+			state:  WarningState,
+			output: "line 1\nline 2",
+		}, {
+			name: `failed to execute`,
+			event: CheckEvent{
+				Timestamp: time.Now(),
+				Output:    `timed out`,
+				Error:     true,
+			},
+			state:  UnknownState,
+			output: `timed out`,
+		},
+	} {
+		history := NewHistory(0)
+		history.Push(tt.event)
+
+		if history.Size != DefaultHistorySize {
+			t.Errorf("%s: expected the default size, got %d", tt.name, history.Size)
+		}
+
+		if entries := history.Entries(time.Time{}, 0); len(entries) != 1 {
+			t.Errorf("%s: expected 1 entry, got %d", tt.name, len(entries))
+		} else if entry := entries[0]; entry.State != tt.state || entry.StateName != tt.state.String() || entry.Output != tt.output || entry.Error != tt.event.Error {
+			t.Errorf("%s: unexpected entry %+v", tt.name, entry)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package reacter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+var DefaultIncidentURL = `https://events.pagerduty.com/v2/enqueue`
+var MaxIncidentSummaryLength = 1024
+
+const (
+	IncidentTrigger     = `trigger`
+	IncidentAcknowledge = `acknowledge`
+	IncidentResolve     = `resolve`
+)
+
+// An IncidentConfig turns a handler into a built-in incident handler that sends PagerDuty Events v2
+// (or compatible) trigger, acknowledge, and resolve events instead of executing a command.
+type IncidentConfig struct {
+	URL        string `json:"url,omitempty"`
+	RoutingKey string `json:"routing_key"`
+	Source     string `json:"source,omitempty"`
+	Component  string `json:"component,omitempty"`
+	Class      string `json:"class,omitempty"`
+	StateFile  string `json:"state_file,omitempty"`
+	state      *incidentState
+	stateOnce  sync.Once
+}
+
+// The body of an event sent to the incident endpoint.
+type IncidentEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Client      string           `json:"client,omitempty"`
+	Payload     *IncidentPayload `json:"payload,omitempty"`
+}
+
+type IncidentPayload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Timestamp     string                 `json:"timestamp,omitempty"`
+	Component     string                 `json:"component,omitempty"`
+	Class         string                 `json:"class,omitempty"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
+
+// An Incident is the local record of an incident this handler has opened.
+type Incident struct {
+	DedupKey   string           `json:"dedup_key"`
+	NodeName   string           `json:"node_name"`
+	CheckName  string           `json:"check_name"`
+	State      ObservationState `json:"state"`
+	OpenedAt   time.Time        `json:"opened_at"`
+	LastSentAt time.Time        `json:"last_sent_at"`
+}
+
+type incidentState struct {
+	filename  string
+	incidents map[string]*Incident
+	lock      sync.Mutex
+}
+
+// Returns the deduplication key used to correlate all incident events for a given check.
+func IncidentDedupKey(check *Check) string {
+	return fmt.Sprintf("%s:%s", check.NodeName, check.Name)
+}
+
+func incidentSeverity(state ObservationState) string {
+	switch state {
+	case WarningState:
+		return `warning`
+	case CriticalState:
+		return `critical`
+	default:
+		return `error`
+	}
+}
+
+// Sends the incident event appropriate for the given check event: non-OK states trigger (or
+// re-trigger) an incident, and OK states resolve it, but only if this handler opened it.
+func (self *IncidentConfig) Send(handler *Handler, event CheckEvent) error {
+	if self.RoutingKey == `` {
+		return fmt.Errorf("Handler '%s' is missing an incident routing key", handler.Name)
+	}
+
+	state := self.loadState(handler)
+	key := IncidentDedupKey(event.Check)
+
+	//  grouped events open a single incident for the whole group
+	if event.Group != nil {
+		key = fmt.Sprintf("group:%s:%s", handler.Name, event.Group.Key)
+	}
+
+	if event.Check.IsOK() {
+		if incident := state.get(key); incident != nil {
+			if err := self.post(handler, &IncidentEvent{
+				RoutingKey:  self.RoutingKey,
+				EventAction: IncidentResolve,
+				DedupKey:    key,
+			}); err == nil {
+				log.Infof("Handler '%s' resolved incident %s", handler.Name, key)
+				return state.remove(key)
+			} else {
+				return err
+			}
+		} else {
+			log.Debugf("Handler '%s' has no open incident for %s, not resolving", handler.Name, key)
+			return nil
+		}
+	}
+
+	if err := self.post(handler, &IncidentEvent{
+		RoutingKey:  self.RoutingKey,
+		EventAction: IncidentTrigger,
+		DedupKey:    key,
+		Client:      `reacter`,
+		Payload:     self.payload(event),
+	}); err == nil {
+		now := time.Now()
+		incident := state.get(key)
+
+		if incident == nil {
+			incident = &Incident{
+				DedupKey:  key,
+				NodeName:  event.Check.NodeName,
+				CheckName: event.Check.Name,
+				OpenedAt:  now,
+			}
+
+			log.Infof("Handler '%s' triggered incident %s", handler.Name, key)
+		}
+
+		incident.State = event.Check.State
+		incident.LastSentAt = now
+
+		return state.put(incident)
+	} else {
+		return err
+	}
+}
+
+// Acknowledges the incident for the given check, if this handler opened one.
+func (self *IncidentConfig) Acknowledge(handler *Handler, check *Check) error {
+	key := IncidentDedupKey(check)
+
+	if self.loadState(handler).get(key) == nil {
+		return nil
+	}
+
+	return self.post(handler, &IncidentEvent{
+		RoutingKey:  self.RoutingKey,
+		EventAction: IncidentAcknowledge,
+		DedupKey:    key,
+	})
+}
+
+// Returns copies of all incidents this handler currently has open.
+func (self *IncidentConfig) Open(handler *Handler) []*Incident {
+	state := self.loadState(handler)
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	incidents := make([]*Incident, 0, len(state.incidents))
+
+	for _, incident := range state.incidents {
+		copied := *incident
+		incidents = append(incidents, &copied)
+	}
+
+	return incidents
+}
+
+func (self *IncidentConfig) payload(event CheckEvent) *IncidentPayload {
+	check := event.Check
+	summary := fmt.Sprintf("%s on %s is %s", check.Name, check.NodeName, check.StateString())
+
+	if event.Output != `` {
+		summary += `: ` + strings.Replace(event.Output, "\n", ` `, -1)
+	}
+
+	if len(summary) > MaxIncidentSummaryLength {
+		summary = summary[:MaxIncidentSummaryLength]
+	}
+
+	details := map[string]interface{}{
+		`node`:     check.NodeName,
+		`check`:    check.Name,
+		`state`:    check.StateString(),
+		`state_id`: int(check.State),
+		`flapping`: check.IsFlapping(),
+		`output`:   event.Output,
+	}
+
+	if event.Observation != nil && len(event.Observation.PerformanceData) > 0 {
+		details[`perfdata`] = event.Observation.PerformanceData
+	}
+
+	if event.Group != nil {
+		summary = fmt.Sprintf("%d check(s) in group %q; worst: %s", len(event.Group.Members), event.Group.Key, summary)
+
+		if len(summary) > MaxIncidentSummaryLength {
+			summary = summary[:MaxIncidentSummaryLength]
+		}
+
+		details[`group`] = event.Group.Key
+		details[`members`] = event.Group.Members
+	}
+
+	source := self.Source
+
+	if source == `` {
+		source = check.NodeName
+	}
+
+	timestamp := event.Timestamp
+
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	return &IncidentPayload{
+		Summary:       summary,
+		Source:        source,
+		Severity:      incidentSeverity(check.State),
+		Timestamp:     timestamp.Format(time.RFC3339),
+		Component:     self.Component,
+		Class:         self.Class,
+		CustomDetails: details,
+	}
+}
+
+func (self *IncidentConfig) post(handler *Handler, incidentEvent *IncidentEvent) error {
+	url := self.URL
+
+	if url == `` {
+		url = DefaultIncidentURL
+	}
+
+	//  the routing key may refer to a secret stored elsewhere (e.g.: "${env:PAGERDUTY_ROUTING_KEY}")
+	if key, err := ResolveValue(incidentEvent.RoutingKey); err == nil {
+		incidentEvent.RoutingKey = key
+	} else {
+		return fmt.Errorf("Handler '%s' failed to resolve its incident routing key: %v", handler.Name, err)
+	}
+
+	if body, err := json.Marshal(incidentEvent); err == nil {
+		client := &http.Client{
+			Timeout: duration(handler.Timeout, DefaultHandleExecTimeout),
+		}
+
+		log.Debugf("Handler '%s' sending %s event for %s to %s", handler.Name, incidentEvent.EventAction, incidentEvent.DedupKey, url)
+
+		if response, err := client.Post(url, `application/json`, bytes.NewReader(body)); err == nil {
+			defer response.Body.Close()
+
+			if response.StatusCode >= 400 {
+				msg, _ := ioutil.ReadAll(response.Body)
+				return fmt.Errorf("Handler '%s' incident endpoint returned %s: %s", handler.Name, response.Status, strings.TrimSpace(string(msg)))
+			}
+
+			return nil
+		} else {
+			return fmt.Errorf("Handler '%s' failed to send incident event: %v", handler.Name, err)
+		}
+	} else {
+		return err
+	}
+}
+
+// Returns the incidents this handler has open, loading them the first time (which may be from
+// several goroutines at once, e.g.: escalations and group flushes.)
+func (self *IncidentConfig) loadState(handler *Handler) *incidentState {
+	self.stateOnce.Do(func() {
+		filename := self.StateFile
+
+		if filename == `` {
+			filename = path.Join(handler.CacheDir, handler.Name+`.incidents.json`)
+		}
+
+		self.state = &incidentState{
+			filename:  fileutil.MustExpandUser(filename),
+			incidents: make(map[string]*Incident),
+		}
+
+		if data, err := ioutil.ReadFile(self.state.filename); err == nil {
+			if err := json.Unmarshal(data, &self.state.incidents); err != nil {
+				log.Warningf("Failed to load incident state from %s: %v", self.state.filename, err)
+			}
+		} else if !os.IsNotExist(err) {
+			log.Warningf("Failed to read incident state from %s: %v", self.state.filename, err)
+		}
+	})
+
+	return self.state
+}
+
+// Returns a copy of the incident with the given key, or nil if there is none.
+func (self *incidentState) get(key string) *Incident {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if incident, ok := self.incidents[key]; ok {
+		copied := *incident
+		return &copied
+	}
+
+	return nil
+}
+
+func (self *incidentState) put(incident *Incident) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.incidents[incident.DedupKey] = incident
+	return self.save()
+}
+
+func (self *incidentState) remove(key string) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	delete(self.incidents, key)
+	return self.save()
+}
+
+func (self *incidentState) save() error {
+	if data, err := json.MarshalIndent(self.incidents, ``, `  `); err == nil {
+		if dir := path.Dir(self.filename); dir != `` {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+		}
+
+		return ioutil.WriteFile(self.filename, data, 0644)
+	} else {
+		return err
+	}
+}
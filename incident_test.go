@@ -0,0 +1,170 @@
+package reacter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type incidentEndpoint struct {
+	events []IncidentEvent
+	lock   sync.Mutex
+}
+
+func (self *incidentEndpoint) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var event IncidentEvent
+
+	if err := json.NewDecoder(req.Body).Decode(&event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.events = append(self.events, event)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (self *incidentEndpoint) actions() []string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	actions := make([]string, len(self.events))
+
+	for i, event := range self.events {
+		actions[i] = event.EventAction + ` ` + event.DedupKey
+	}
+
+	return actions
+}
+
+func incidentEvent(node string, state ObservationState) CheckEvent {
+	check := NewCheck()
+	check.NodeName = node
+	check.Name = `disk`
+	check.State = state
+
+	return CheckEvent{
+		Check:  check,
+		Output: `disk is ` + check.StateString(),
+	}
+}
+
+func TestIncidentStatePersistence(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `reacter-incidents`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	endpoint := &incidentEndpoint{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	stateFile := filepath.Join(dir, `pager.incidents.json`)
+	handler := func() *Handler {
+		return &Handler{
+			Name:     `pager`,
+			CacheDir: dir,
+			Incident: &IncidentConfig{
+				URL:        server.URL,
+				RoutingKey: `abc123`,
+			},
+		}
+	}
+
+	key := IncidentDedupKey(incidentEvent(`db1`, CriticalState).Check)
+	first := handler()
+
+	for _, tt := range []struct {
+		handler *Handler
+		event   CheckEvent
+		action  string
+		open    int
+	}{
+		//  okay checks without an incident are left alone
+		{first, incidentEvent(`db1`, SuccessState), ``, 0},
+		{first, incidentEvent(`db1`, CriticalState), `trigger`, 1},
+		{first, incidentEvent(`db1`, WarningState), `trigger`, 1},
+		//  a new handler (e.g.: after a restart) picks up the incidents the last one opened
+		{handler(), incidentEvent(`db1`, SuccessState), `resolve`, 0},
+		{handler(), incidentEvent(`db1`, SuccessState), ``, 0},
+	} {
+		before := len(endpoint.actions())
+
+		if err := tt.handler.Execute(tt.event); err != nil {
+			t.Fatal(err)
+		}
+
+		actions := endpoint.actions()[before:]
+
+		if tt.action == `` && len(actions) != 0 {
+			t.Errorf("%s: expected nothing to be sent, got %v", tt.event.Output, actions)
+		} else if tt.action != `` && (len(actions) != 1 || actions[0] != tt.action+` `+key) {
+			t.Errorf("%s: expected %s %s, got %v", tt.event.Output, tt.action, key, actions)
+		}
+
+		if open := tt.handler.Incident.Open(tt.handler); len(open) != tt.open {
+			t.Errorf("%s: expected %d open incident(s), got %d", tt.event.Output, tt.open, len(open))
+		} else if tt.open > 0 && open[0].State != tt.event.Check.State {
+			t.Errorf("%s: expected the incident to be in state %d, got %d", tt.event.Output, tt.event.Check.State, open[0].State)
+		}
+	}
+
+	if _, err := os.Stat(stateFile); err != nil {
+		t.Errorf("expected incident state to be saved to %s: %v", stateFile, err)
+	}
+}
+
+func TestIncidentConcurrentSend(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `reacter-incidents`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	endpoint := &incidentEndpoint{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	handler := &Handler{
+		Name:     `pager`,
+		CacheDir: dir,
+		Incident: &IncidentConfig{
+			URL:        server.URL,
+			RoutingKey: `abc123`,
+		},
+	}
+
+	var wg sync.WaitGroup
+
+	//  escalations and group flushes send incident events from their own goroutines
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			if err := handler.Incident.Send(handler, incidentEvent(fmt.Sprintf("db%d", i), CriticalState)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if open := handler.Incident.Open(handler); len(open) != 8 {
+		t.Errorf("expected 8 open incidents, got %d", len(open))
+	}
+}
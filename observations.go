@@ -1,7 +1,10 @@
 package reacter
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/ghetzel/go-stockutil/log"
@@ -21,6 +24,43 @@ type Observation struct {
 	PerformanceData map[string]Measurement `json:"measurements,omitempty"`
 }
 
+// Creates an observation from a Nagios-style exit status and output.  Each line of output may
+// contain performance data after a "|" character.
+func NewObservation(exitStatus int, output []byte) Observation {
+	observation := Observation{
+		Timestamp:       time.Now(),
+		PerformanceData: make(map[string]Measurement),
+	}
+
+	observation.SetState(exitStatus)
+
+	//  add STDOUT lines
+	outputScanner := bufio.NewScanner(bytes.NewReader(output))
+
+	for outputScanner.Scan() {
+		line := outputScanner.Text()
+		parts := strings.SplitN(line, `|`, 2)
+
+		observation.Output = append(observation.Output, strings.TrimSpace(parts[0]))
+
+		if len(parts) > 1 {
+			for _, measurement := range strings.Split(strings.TrimSpace(parts[1]), ` `) {
+				kv := strings.SplitN(measurement, `=`, 2)
+				if len(kv) == 2 {
+					values := strings.Split(kv[1], `;`)
+					if len(values) >= 5 {
+						m := Measurement{}
+						m.SetValues(values[0], values[1], values[2], values[3], values[4])
+						observation.PerformanceData[kv[0]] = m
+					}
+				}
+			}
+		}
+	}
+
+	return observation
+}
+
 func (self *Observation) SetState(state int) {
 	switch state {
 	case 0:
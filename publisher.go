@@ -0,0 +1,204 @@
+package reacter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/streadway/amqp"
+)
+
+const DEFAULT_EXCHANGE_NAME = `reacter`
+
+// A Publisher sends check events to an AMQP exchange, routed by node, check, and state so that
+// consumers can bind to just the events they care about.
+type Publisher struct {
+	Host         string
+	Port         int
+	Vhost        string
+	Exchange     string
+	ExchangeType string
+	// How long to wait before the first attempt to reconnect after a failed publish; the wait
+	// doubles after each failed attempt, up to MaxReconnectInterval.
+	ReconnectInterval    time.Duration
+	MaxReconnectInterval time.Duration
+	Dialer               AMQPDialer
+	conn                 AMQPConnection
+	channel              AMQPChannel
+	uri                  amqp.URI
+	done                 chan struct{}
+	closed               bool
+	lock                 sync.Mutex
+}
+
+func NewPublisher(uri string) (*Publisher, error) {
+	p := new(Publisher)
+
+	if u, err := amqp.ParseURI(uri); err == nil {
+		p.uri = u
+		p.Host = u.Host
+		p.Port = u.Port
+		p.Vhost = u.Vhost
+		p.Exchange = DEFAULT_EXCHANGE_NAME
+		p.ExchangeType = DEFAULT_EXCHANGE_TYPE
+		p.ReconnectInterval = DefaultAMQPReconnectInterval
+		p.MaxReconnectInterval = DefaultAMQPMaxReconnectInterval
+		p.Dialer = DefaultAMQPDialer
+		p.done = make(chan struct{})
+
+		return p, nil
+	} else {
+		return nil, err
+	}
+}
+
+// Returns the routing key an event is published with: "checks.<node>.<check>.<state>" for check
+// events (e.g.: "checks.db-01.postgres.critical"), and "heartbeats.<node>" for heartbeats.  Dots
+// within names are replaced with underscores so that each name is a single word.
+func EventRoutingKey(event CheckEvent) string {
+	if event.Heartbeat != nil {
+		return `heartbeats.` + routingWord(event.Heartbeat.NodeName)
+	} else if event.Check != nil {
+		return strings.Join([]string{
+			`checks`,
+			routingWord(event.Check.NodeName),
+			routingWord(event.Check.Name),
+			event.Check.StateString(),
+		}, `.`)
+	}
+
+	return `checks`
+}
+
+func routingWord(name string) string {
+	if name == `` {
+		return `unknown`
+	}
+
+	return strings.Replace(name, `.`, `_`, -1)
+}
+
+// Closes the connection to the broker.  Publishes that are waiting to reconnect are abandoned.
+func (self *Publisher) Close() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if !self.closed {
+		self.closed = true
+		close(self.done)
+	}
+
+	if self.conn == nil {
+		return nil
+	}
+
+	return self.conn.Close()
+}
+
+// Connects to the broker and declares the exchange.
+func (self *Publisher) Connect() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.closed {
+		return fmt.Errorf("Publisher is closed")
+	} else if self.Exchange == `` {
+		return fmt.Errorf("Publisher requires an exchange")
+	}
+
+	if self.conn != nil {
+		self.conn.Close()
+		self.conn = nil
+		self.channel = nil
+	}
+
+	kind := self.ExchangeType
+
+	if kind == `` {
+		kind = DEFAULT_EXCHANGE_TYPE
+	}
+
+	if conn, err := self.Dialer(self.uri.String()); err == nil {
+		if channel, err := conn.Channel(); err == nil {
+			//  declared the same way consumers declare it, so whichever comes first wins
+			if err := channel.ExchangeDeclare(self.Exchange, kind, true, false, false, false, nil); err == nil {
+				self.conn = conn
+				self.channel = channel
+				return nil
+			} else {
+				defer conn.Close()
+				return fmt.Errorf("declare exchange %s: %v", self.Exchange, err)
+			}
+		} else {
+			defer conn.Close()
+			return err
+		}
+	} else {
+		return err
+	}
+}
+
+// Publishes the given event, routed by its node, check, and state.
+func (self *Publisher) Publish(event CheckEvent) error {
+	if data, err := json.Marshal(event); err == nil {
+		return self.PublishRaw(EventRoutingKey(event), data, event.Timestamp)
+	} else {
+		return err
+	}
+}
+
+// Publishes an already-serialized event with the given routing key.  If publishing fails (e.g.:
+// because the connection was lost), the publisher reconnects with backoff and tries again until it
+// succeeds or the publisher is closed.
+func (self *Publisher) PublishRaw(routingKey string, body []byte, timestamp time.Time) error {
+	message := amqp.Publishing{
+		ContentType:  `application/json`,
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    timestamp,
+		Body:         body,
+	}
+
+	interval := self.ReconnectInterval
+
+	for {
+		err := self.publish(routingKey, message)
+
+		if err == nil {
+			return nil
+		}
+
+		log.Warningf("Failed to publish to AMQP broker %s:%d, reconnecting in %v: %v", self.Host, self.Port, interval, err)
+
+		select {
+		case <-self.done:
+			return fmt.Errorf("Publisher is closed")
+		case <-time.After(interval):
+		}
+
+		if err := self.Connect(); err == nil {
+			log.Noticef("Reconnected to AMQP broker %s:%d", self.Host, self.Port)
+		} else {
+			log.Warningf("Failed to reconnect to AMQP broker %s:%d: %v", self.Host, self.Port, err)
+		}
+
+		if interval *= 2; interval > self.MaxReconnectInterval {
+			interval = self.MaxReconnectInterval
+		}
+	}
+}
+
+func (self *Publisher) publish(routingKey string, message amqp.Publishing) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.closed {
+		return fmt.Errorf("Publisher is closed")
+	} else if self.channel == nil {
+		return fmt.Errorf("Cannot publish, not connected")
+	}
+
+	return self.channel.Publish(self.Exchange, routingKey, false, false, message)
+}
@@ -3,7 +3,6 @@ package reacter
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
 	"sync"
@@ -22,33 +21,64 @@ var DefaultConfigFile = executil.RootOrString(`/etc/reacter.yml`, `~/.config/rea
 var DefaultConfigDir = executil.RootOrString(`/etc/reacter/conf.d`, `~/.config/reacter.d`)
 
 type Reacter struct {
-	NodeName         string             `json:"name"`
-	Peers            []*netutil.Service `json:"peers"`
-	Checks           []*Check           `json:"-"`
-	Events           chan CheckEvent    `json:"-"`
-	ConfigFile       string             `json:"-"`
-	ConfigDir        string             `json:"-"`
-	PrintJson        bool               `json:"-"`
-	WriteJson        io.Writer          `json:"-"`
-	OnlyPrintChanges bool               `json:"-"`
-	SuppressFlapping bool               `json:"-"`
-	checkset         sync.Map
+	NodeName          string                 `json:"name"`
+	Metadata          map[string]interface{} `json:"metadata,omitempty"`
+	Peers             []*netutil.Service     `json:"peers"`
+	Checks            []*Check               `json:"-"`
+	Events            chan CheckEvent        `json:"-"`
+	ConfigFile        string                 `json:"-"`
+	ConfigDir         string                 `json:"-"`
+	PrintJson         bool                   `json:"-"`
+	Sinks             []Sink                 `json:"-"`
+	OnlyPrintChanges  bool                   `json:"-"`
+	SuppressFlapping  bool                   `json:"-"`
+	Acks              *AckStore              `json:"-"`
+	HeartbeatInterval time.Duration          `json:"-"`
+	Redactor          *Redactor              `json:"-"`
+	checkset          sync.Map
+	subscribers       sync.Map
 }
 
 type Config struct {
-	ChecksDefinitions []Check `json:"checks"`
+	ChecksDefinitions []CheckConfig          `json:"checks"`
+	Metadata          map[string]interface{} `json:"metadata"`
+	Redact            RedactConfig           `json:"redact"`
+}
+
+// A CheckConfig is the definition of a check as it appears in a configuration file.
+type CheckConfig struct {
+	Name               string                 `json:"name"`
+	Command            interface{}            `json:"command"`
+	Timeout            interface{}            `json:"timeout"`
+	Enabled            *bool                  `json:"enabled,omitempty"`
+	Parameters         map[string]interface{} `json:"parameters"`
+	Environment        Values                 `json:"environment"`
+	Redact             []string               `json:"redact,omitempty"`
+	Directory          string                 `json:"directory,omitempty"`
+	Interval           interface{}            `json:"interval"`
+	FlapThresholdHigh  float64                `json:"flap_threshold_high"`
+	FlapThresholdLow   float64                `json:"flap_threshold_low"`
+	Rise               int                    `json:"rise"`
+	Fall               int                    `json:"fall"`
+	Passive            bool                   `json:"passive,omitempty"`
+	FreshnessThreshold interface{}            `json:"freshness_threshold,omitempty"`
+	HistorySize        int                    `json:"history_size,omitempty"`
 }
 
 func NewReacter() *Reacter {
 	return &Reacter{
-		ConfigFile: DefaultConfigFile,
-		ConfigDir:  DefaultConfigDir,
-		Checks:     make([]*Check, 0),
-		Events:     make(chan CheckEvent),
+		ConfigFile:        DefaultConfigFile,
+		ConfigDir:         DefaultConfigDir,
+		Checks:            make([]*Check, 0),
+		Events:            make(chan CheckEvent),
+		Acks:              NewAckStore(DefaultAckFile),
+		Metadata:          make(map[string]interface{}),
+		HeartbeatInterval: DefaultHeartbeatInterval,
+		Redactor:          NewRedactor(),
 	}
 }
 
-func (self *Reacter) AddCheck(checkConfig Check) error {
+func (self *Reacter) AddCheck(checkConfig CheckConfig) error {
 	check := NewCheck()
 
 	if checkConfig.Directory != `` {
@@ -63,7 +93,9 @@ func (self *Reacter) AddCheck(checkConfig Check) error {
 		}
 	}
 
-	if d := duration(checkConfig.Interval); d > 0 {
+	if d, err := parseDuration(checkConfig.Interval); err != nil {
+		return fmt.Errorf("Invalid interval: %v", err)
+	} else if d > 0 {
 		check.Interval = d
 	} else if d < 0 {
 		return fmt.Errorf("Cannot specify a negative interval (%v)", d)
@@ -89,10 +121,44 @@ func (self *Reacter) AddCheck(checkConfig Check) error {
 	check.Environment = checkConfig.Environment
 	check.Parameters = checkConfig.Parameters
 
-	if d := duration(checkConfig.Timeout); d > 0 {
+	for k, v := range check.Parameters {
+		if value, err := NormalizeValue(v); err == nil {
+			check.Parameters[k] = value
+		} else {
+			return fmt.Errorf("Invalid parameter '%s': %v", k, err)
+		}
+	}
+	check.Redact = checkConfig.Redact
+	check.redactor = self.Redactor
+	check.Passive = checkConfig.Passive
+
+	//  checks are enabled unless they say otherwise
+	if checkConfig.Enabled != nil {
+		check.Enabled = *checkConfig.Enabled
+	}
+
+	if d, err := parseDuration(checkConfig.FreshnessThreshold); err != nil {
+		return fmt.Errorf("Invalid freshness threshold: %v", err)
+	} else if d > 0 {
+		//  stored as a string so that it survives being sent to handlers in events
+		check.FreshnessThreshold = d.String()
+	} else if d < 0 {
+		return fmt.Errorf("Cannot specify a negative freshness threshold (%v)", d)
+	}
+
+	if d, err := parseDuration(checkConfig.Timeout); err != nil {
+		return fmt.Errorf("Invalid timeout: %v", err)
+	} else if d > 0 {
 		check.Timeout = d
 	}
 
+	if checkConfig.HistorySize > 0 {
+		check.HistorySize = checkConfig.HistorySize
+		check.History = NewHistory(checkConfig.HistorySize)
+	} else if checkConfig.HistorySize < 0 {
+		return fmt.Errorf("Cannot specify a negative history size (%d)", checkConfig.HistorySize)
+	}
+
 	if checkConfig.Rise > 0 {
 		check.Rise = checkConfig.Rise
 	}
@@ -126,6 +192,12 @@ func (self *Reacter) LoadConfig(path string) error {
 		if data, err := ioutil.ReadAll(file); err == nil {
 			checkConfigs := Config{}
 			if err := yaml.Unmarshal(data, &checkConfigs); err == nil {
+				for k, v := range checkConfigs.Metadata {
+					self.Metadata[k] = v
+				}
+
+				self.Redactor.Configure(checkConfigs.Redact)
+
 				for _, checkConfig := range checkConfigs.ChecksDefinitions {
 					if err := self.AddCheck(checkConfig); err != nil {
 						log.Errorf("Error adding check '%s': %v", checkConfig.Name, err)
@@ -148,59 +220,158 @@ func (self *Reacter) StartEventProcessing() {
 	for {
 		select {
 		case event := <-self.Events:
-			self.checkset.Store(event.Check.ID(), event)
-
-			var suffix string
-			if event.Check.IsFlapping() {
-				suffix = ` [FLAPPING]`
+			//  heartbeats are always emitted, regardless of state change or flapping settings
+			if event.Heartbeat != nil {
+				log.Debugf("Emitting heartbeat for node %s", event.Heartbeat.NodeName)
+				self.emit(event)
+				self.publish(event)
+				continue
 			}
 
-			if !event.Error {
-				var out string
-
-				if event.Output != `` {
-					out = `: ` + event.Output
-				}
-
-				switch event.Check.State {
-				case SuccessState:
-					log.Noticef("%s is healthy%s%s", event.Check.Name, suffix, out)
-				case WarningState:
-					log.Warningf("%s is in a warning state%s%s", event.Check.Name, suffix, out)
-				default:
-					log.Errorf("%s is in a critical state%s%s", event.Check.Name, suffix, out)
-				}
-			} else {
-				log.Errorf("Check '%s' encountered an error during execution: %v", event.Check.Name, event.Output)
-
-				//  put a few things into the check state because it failed too quickly to do that itself
-				if event.Check.State != 128 {
-					event.Check.StateChanged = true
-				}
-
-				event.Check.State = 128
+			if self.Acks != nil {
+				self.Acks.Observe(event.Check)
 			}
 
+			self.checkset.Store(event.Check.ID(), event)
+			self.logEvent(event)
+
 			//  serialize check and print as JSON
-			if self.PrintJson || self.WriteJson != nil {
+			if self.PrintJson || len(self.Sinks) > 0 {
 				//  ...either always, or only when the state has changed from its previous value
 				if !self.OnlyPrintChanges || event.Check.StateChanged {
 					//  ...either always, or only when the check is NOT flapping
 					if !self.SuppressFlapping || !event.Check.IsFlapping() {
-						if data, err := json.Marshal(event); err == nil {
-							if self.PrintJson {
-								fmt.Printf("%s\n", string(data))
-							}
-
-							if self.WriteJson != nil {
-								fmt.Fprintf(self.WriteJson, "%s\n", string(data))
-							}
-						}
+						self.emit(self.Redactor.Event(event))
 					}
 				}
 			}
+
+			self.publish(event)
+		}
+	}
+}
+
+// Logs the outcome of a check event, marking checks that failed to execute as such.
+func (self *Reacter) logEvent(event CheckEvent) {
+	var suffix string
+	if event.Check.IsFlapping() {
+		suffix = ` [FLAPPING]`
+	}
+
+	if event.Check.IsAcknowledged() {
+		suffix += ` [ACKNOWLEDGED]`
+	}
+
+	if !event.Error {
+		var out string
+
+		if event.Output != `` {
+			out = `: ` + event.Output
+		}
+
+		switch event.Check.State {
+		case SuccessState:
+			log.Noticef("%s is healthy%s%s", event.Check.Name, suffix, out)
+		case WarningState:
+			log.Warningf("%s is in a warning state%s%s", event.Check.Name, suffix, out)
+		default:
+			log.Errorf("%s is in a critical state%s%s", event.Check.Name, suffix, out)
+		}
+	} else {
+		log.Errorf("Check '%s' encountered an error during execution: %v", event.Check.Name, event.Output)
+
+		//  put a few things into the check state because it failed too quickly to do that itself
+		if event.Check.State != 128 {
+			event.Check.StateChanged = true
+		}
+
+		event.Check.State = 128
+	}
+}
+
+// Adds a sink that every emitted event will be written to.
+func (self *Reacter) AddSink(sink Sink) {
+	self.Sinks = append(self.Sinks, sink)
+}
+
+// serialize the event and print it as JSON, then write it to every sink
+func (self *Reacter) emit(event CheckEvent) {
+	if self.PrintJson {
+		if data, err := json.Marshal(event); err == nil {
+			fmt.Printf("%s\n", string(data))
+		}
+	}
+
+	for _, sink := range self.Sinks {
+		if err := sink.Write(event); err != nil {
+			log.Warningf("Failed to write event to %T: %v", sink, err)
+		}
+	}
+}
+
+// Returns the check with the given name or ID, or nil if no such check exists.
+func (self *Reacter) Check(nameOrID string) *Check {
+	for _, check := range self.Checks {
+		if check.Name == nameOrID || check.ID() == nameOrID {
+			return check
+		}
+	}
+
+	return nil
+}
+
+// Records an acknowledgement for one of this node's checks, or (if the node name refers to
+// another node) for a remote one.
+func (self *Reacter) Acknowledge(ack *Acknowledgement) error {
+	if self.Acks == nil {
+		return fmt.Errorf("Acknowledgements are not enabled")
+	}
+
+	if ack.NodeName == `` {
+		ack.NodeName = self.NodeName
+	}
+
+	if ack.NodeName == self.NodeName {
+		if check := self.Check(ack.CheckName); check != nil {
+			if check.IsOK() {
+				return fmt.Errorf("Check '%s' is not alerting", check.Name)
+			}
+
+			ack.CheckName = check.Name
+			ack.State = check.State
+
+			if err := self.Acks.Acknowledge(ack); err == nil {
+				check.Acknowledgement = ack
+				return nil
+			} else {
+				return err
+			}
+		} else {
+			return fmt.Errorf("No such check '%s'", ack.CheckName)
+		}
+	}
+
+	return self.Acks.Acknowledge(ack)
+}
+
+// Removes the acknowledgement for the given check.
+func (self *Reacter) Unacknowledge(nodeName string, checkName string) error {
+	if self.Acks == nil {
+		return fmt.Errorf("Acknowledgements are not enabled")
+	}
+
+	if nodeName == `` {
+		nodeName = self.NodeName
+	}
+
+	if nodeName == self.NodeName {
+		if check := self.Check(checkName); check != nil {
+			check.Acknowledgement = nil
+			checkName = check.Name
 		}
 	}
+
+	return self.Acks.Remove(nodeName, checkName)
 }
 
 func (self *Reacter) Run() error {
@@ -214,6 +385,9 @@ func (self *Reacter) Run() error {
 				go check.Monitor(self.Events)
 			}
 
+			go self.watchFreshness()
+			go self.emitHeartbeats()
+
 			self.StartEventProcessing()
 		} else {
 			return fmt.Errorf("No checks defined, nothing to do")
@@ -225,30 +399,127 @@ func (self *Reacter) Run() error {
 	}
 }
 
-func duration(in interface{}, fallback ...time.Duration) time.Duration {
-	var fb time.Duration
+// Loads the configuration and executes the named checks (or every enabled check that isn't
+// passive) exactly once and in parallel, then logs and emits their results.  Rise and fall
+// thresholds don't apply to a single execution, so each check takes on the state of its only
+// observation.
+func (self *Reacter) RunOnce(names ...string) ([]CheckEvent, error) {
+	if err := self.ReloadConfig(); err != nil {
+		return nil, err
+	}
 
-	if len(fallback) > 0 {
-		fb = fallback[0]
+	checks := make([]*Check, 0)
+
+	if len(names) > 0 {
+		for _, name := range names {
+			if check := self.Check(name); check == nil {
+				return nil, fmt.Errorf("No such check '%s'", name)
+			} else if check.Passive {
+				return nil, fmt.Errorf("Cannot execute check '%s': check is passive", check.Name)
+			} else {
+				checks = append(checks, check)
+			}
+		}
+	} else {
+		for _, check := range self.Checks {
+			//  disabled checks only run when they're named explicitly
+			if !check.Passive && check.Enabled {
+				checks = append(checks, check)
+			}
+		}
 	}
 
-	if dd, ok := in.(time.Duration); ok {
-		if dd == 0 {
-			return fb
-		} else {
-			return dd
+	if len(checks) == 0 {
+		return nil, fmt.Errorf("No checks defined, nothing to do")
+	}
+
+	log.Infof("Executing %d checks once", len(checks))
+
+	events := make([]CheckEvent, len(checks))
+
+	var wg sync.WaitGroup
+
+	for i, check := range checks {
+		wg.Add(1)
+
+		go func(i int, check *Check) {
+			defer wg.Done()
+
+			check.Rise = 1
+			check.Fall = 1
+
+			//  disabled checks are only in the list if they were named, in which case they run
+			events[i] = check.newEvent(check.execute())
+		}(i, check)
+	}
+
+	wg.Wait()
+
+	for _, event := range events {
+		self.logEvent(event)
+		self.emit(self.Redactor.Event(event))
+	}
+
+	return events, nil
+}
+
+// Returns the worst state of the checks in the given events, where checks that failed to execute
+// are in an unknown state.
+func WorstState(events []CheckEvent) ObservationState {
+	worst := ObservationState(SuccessState)
+
+	for _, event := range events {
+		if event.Check == nil {
+			continue
+		}
+
+		state := event.Check.State
+
+		if event.Error || state > UnknownState {
+			state = UnknownState
+		}
+
+		if state > worst {
+			worst = state
 		}
-	} else if in == nil {
-		return fb
+	}
+
+	return worst
+}
+
+// Parses a duration given either as a string (e.g.: "30s") or as a number of seconds (if less than
+// 1000) or milliseconds (if less than 1000000).  Empty values are zero.
+func parseDuration(in interface{}) (time.Duration, error) {
+	if dd, ok := in.(time.Duration); ok {
+		return dd, nil
+	} else if typeutil.IsEmpty(in) {
+		return 0, nil
 	} else if d, err := timeutil.ParseDuration(typeutil.String(in)); err == nil {
-		return d
+		return d, nil
+	} else if !typeutil.IsNumeric(in) {
+		return 0, fmt.Errorf("invalid duration %q", typeutil.String(in))
 	} else if v := typeutil.Int(in); v == 0 {
-		return fb
+		return 0, nil
 	} else if time.Duration(v) < time.Microsecond {
-		return time.Second * time.Duration(v)
+		return time.Second * time.Duration(v), nil
 	} else if time.Duration(v) < time.Millisecond {
-		return time.Millisecond * time.Duration(v)
+		return time.Millisecond * time.Duration(v), nil
 	} else {
-		panic("invalid interval: " + err.Error())
+		return 0, fmt.Errorf("invalid duration %d: too large to be a number of seconds or milliseconds (use a unit, e.g.: \"30m\")", typeutil.Int(in))
 	}
 }
+
+// Returns the given duration (see parseDuration), or the fallback if it is empty or invalid.
+func duration(in interface{}, fallback ...time.Duration) time.Duration {
+	var fb time.Duration
+
+	if len(fallback) > 0 {
+		fb = fallback[0]
+	}
+
+	if d, err := parseDuration(in); err == nil && d != 0 {
+		return d
+	}
+
+	return fb
+}
@@ -0,0 +1,165 @@
+package reacter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+func TestMain(m *testing.M) {
+	//  the logger is set up on first use, which races if that first use is from concurrent
+	//  goroutines (e.g.: the monitors of several checks)
+	log.SetLevel(log.LogLevel)
+	os.Exit(m.Run())
+}
+
+func TestWorstState(t *testing.T) {
+	event := func(state ObservationState, failed bool) CheckEvent {
+		check := NewCheck()
+		check.State = state
+
+		return CheckEvent{
+			Check: check,
+			Error: failed,
+		}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		events   []CheckEvent
+		expected ObservationState
+	}{
+		{`no events`, nil, SuccessState},
+		{`all ok`, []CheckEvent{event(SuccessState, false), event(SuccessState, false)}, SuccessState},
+		{`warning`, []CheckEvent{event(SuccessState, false), event(WarningState, false)}, WarningState},
+		{`critical outranks warning`, []CheckEvent{event(CriticalState, false), event(WarningState, false)}, CriticalState},
+		{`unknown outranks critical`, []CheckEvent{event(CriticalState, false), event(UnknownState, false)}, UnknownState},
+		{`failed to execute`, []CheckEvent{event(SuccessState, true)}, UnknownState},
+		{`exit status above unknown`, []CheckEvent{event(ObservationState(42), false)}, UnknownState},
+		{`events without checks`, []CheckEvent{{}, event(WarningState, false)}, WarningState},
+	} {
+		if worst := WorstState(tt.events); worst != tt.expected {
+			t.Errorf("%s: expected state %d, got %d", tt.name, tt.expected, worst)
+		}
+	}
+}
+
+const runOnceConfig = `checks:
+- name:    enabled
+  command: ['true']
+- name:    disabled
+  command: ['sh', '-c', 'exit 2']
+  enabled: false
+- name:    passive
+  passive: true
+`
+
+func TestRunOnce(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `reacter-once`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, `reacter.yml`)
+
+	if err := ioutil.WriteFile(config, []byte(runOnceConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		names  []string
+		states map[string]ObservationState
+		worst  ObservationState
+		fails  bool
+	}{
+		{`all checks`, nil, map[string]ObservationState{`enabled`: SuccessState}, SuccessState, false},
+		{`named enabled check`, []string{`enabled`}, map[string]ObservationState{`enabled`: SuccessState}, SuccessState, false},
+		{`named disabled check`, []string{`disabled`}, map[string]ObservationState{`disabled`: CriticalState}, CriticalState, false},
+		{`named checks`, []string{`disabled`, `enabled`}, map[string]ObservationState{`enabled`: SuccessState, `disabled`: CriticalState}, CriticalState, false},
+		{`named passive check`, []string{`passive`}, nil, 0, true},
+		{`unknown check`, []string{`missing`}, nil, 0, true},
+	} {
+		reacter := NewReacter()
+		reacter.ConfigFile = config
+		reacter.ConfigDir = ``
+
+		events, err := reacter.RunOnce(tt.names...)
+
+		if tt.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+
+			continue
+		} else if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if check := reacter.Check(`disabled`); check == nil || check.Enabled {
+			t.Errorf("%s: expected the check to be loaded disabled", tt.name)
+		}
+
+		states := make(map[string]ObservationState)
+
+		for _, event := range events {
+			if event.Error {
+				t.Errorf("%s: check '%s' failed to execute: %s", tt.name, event.Check.Name, event.Output)
+			}
+
+			states[event.Check.Name] = event.Check.State
+		}
+
+		if !reflect.DeepEqual(states, tt.states) {
+			t.Errorf("%s: expected states %v, got %v", tt.name, tt.states, states)
+		}
+
+		if worst := WorstState(events); worst != tt.worst {
+			t.Errorf("%s: expected the worst state to be %d, got %d", tt.name, tt.worst, worst)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for _, tt := range []struct {
+		in       interface{}
+		expected time.Duration
+		fails    bool
+	}{
+		{nil, 0, false},
+		{``, 0, false},
+		{0, 0, false},
+		{`0`, 0, false},
+		{`30s`, 30 * time.Second, false},
+		{`1h30m`, 90 * time.Minute, false},
+		{`26h`, 26 * time.Hour, false},
+		{90 * time.Second, 90 * time.Second, false},
+		{300, 5 * time.Minute, false},
+		{`300`, 5 * time.Minute, false},
+		{999, 999 * time.Second, false},
+		{1500, 1500 * time.Millisecond, false},
+		{999999, 999999 * time.Millisecond, false},
+		{1000000, 0, true},
+		{`soon`, 0, true},
+	} {
+		d, err := parseDuration(tt.in)
+
+		if tt.fails {
+			if err == nil {
+				t.Errorf("%v: expected an error, got %v", tt.in, d)
+			}
+		} else if err != nil {
+			t.Errorf("%v: %v", tt.in, err)
+		} else if d != tt.expected {
+			t.Errorf("%v: expected %v, got %v", tt.in, tt.expected, d)
+		}
+	}
+}
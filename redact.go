@@ -0,0 +1,233 @@
+package reacter
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/ghetzel/go-stockutil/sliceutil"
+	"github.com/ghetzel/go-stockutil/stringutil"
+	"github.com/ghetzel/go-stockutil/typeutil"
+)
+
+var RedactedPlaceholder = `********`
+
+// Check parameters and environment variables whose names match any of these (case-insensitive)
+// patterns have their values redacted from emitted events and API responses.  Short words like
+// "key" and "auth" are anchored so that names like "monkey" and "author" aren't redacted.
+var DefaultRedactPatterns = []string{
+	`*password*`,
+	`*passwd*`,
+	`*secret*`,
+	`*token*`,
+	`*credential*`,
+	`key`,
+	`apikey`,
+	`*_key`,
+	`*-key`,
+	`*_auth`,
+	`authorization`,
+}
+
+// Configures redaction globally, under the "redact" key of a configuration file.
+type RedactConfig struct {
+	// Additional patterns matching the names of sensitive parameters and environment variables.
+	Patterns []string `json:"patterns,omitempty"`
+	// Leave check environments out of emitted events and API responses entirely.
+	OmitEnvironment bool `json:"omit_environment,omitempty"`
+}
+
+// A Redactor removes sensitive values from checks before they are exposed outside of the process.
+type Redactor struct {
+	Patterns        []string
+	OmitEnvironment bool
+}
+
+func NewRedactor(patterns ...string) *Redactor {
+	if len(patterns) == 0 {
+		patterns = DefaultRedactPatterns
+	}
+
+	return &Redactor{
+		Patterns: append([]string{}, patterns...),
+	}
+}
+
+// Merges the given configuration into this redactor.  Patterns it already has are not added
+// again, so configuration can be reloaded.
+func (self *Redactor) Configure(config RedactConfig) {
+	for _, pattern := range config.Patterns {
+		if !sliceutil.ContainsString(self.Patterns, pattern) {
+			self.Patterns = append(self.Patterns, pattern)
+		}
+	}
+
+	if config.OmitEnvironment {
+		self.OmitEnvironment = true
+	}
+}
+
+// Whether the value of the given parameter or environment variable should be redacted, either
+// because it matches a global pattern or one of the given additional names or patterns (e.g.: a
+// check's "redact" list.)
+func (self *Redactor) IsSensitive(key string, extra ...string) bool {
+	key = strings.ToLower(key)
+
+	for _, patterns := range [][]string{self.Patterns, extra} {
+		for _, pattern := range patterns {
+			if matched, err := filepath.Match(strings.ToLower(pattern), key); err == nil && matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Returns a copy of the given map with the values of all sensitive keys replaced.
+func (self *Redactor) Map(values map[string]string, extra ...string) map[string]string {
+	if values == nil {
+		return nil
+	}
+
+	redacted := make(map[string]string, len(values))
+
+	for k, v := range values {
+		if self.IsSensitive(k, extra...) {
+			redacted[k] = RedactedPlaceholder
+		} else {
+			redacted[k] = v
+		}
+	}
+
+	return redacted
+}
+
+// Replaces every occurrence of the given secret values in a string.
+func (self *Redactor) String(value string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != `` {
+			value = strings.Replace(value, secret, RedactedPlaceholder, -1)
+		}
+	}
+
+	return value
+}
+
+// Returns the values of all sensitive keys in the given map.
+func (self *Redactor) secrets(values map[string]string, extra ...string) []string {
+	secrets := make([]string, 0)
+
+	for k, v := range values {
+		if self.IsSensitive(k, extra...) {
+			secrets = append(secrets, v)
+		}
+	}
+
+	return sliceutil.CompactString(secrets)
+}
+
+// Returns the values of the check's sensitive parameters and environment variables.
+func (self *Redactor) checkSecrets(check *Check) []string {
+	params := make(map[string]string, len(check.Parameters))
+
+	for k, v := range check.Parameters {
+		params[k] = typeutil.String(v)
+	}
+
+	return append(self.secrets(params, check.Redact...), self.secrets(check.Environment, check.Redact...)...)
+}
+
+// Returns the given command (a string or list of arguments) with every occurrence of the given
+// secret values replaced.
+func (self *Redactor) Command(command interface{}, secrets ...string) interface{} {
+	if len(secrets) == 0 || command == nil {
+		return command
+	} else if typeutil.IsArray(command) {
+		args := sliceutil.Stringify(command)
+
+		for i, arg := range args {
+			args[i] = self.String(arg, secrets...)
+		}
+
+		return args
+	} else {
+		return self.String(typeutil.String(command), secrets...)
+	}
+}
+
+// Returns the command of the given check, with any sensitive values that appear in it replaced.
+func (self *Redactor) CheckCommand(check *Check) interface{} {
+	if self == nil {
+		return check.Command
+	}
+
+	return self.Command(check.Command, self.checkSecrets(check)...)
+}
+
+// Returns the given list of KEY=VALUE environment variables with the values of sensitive variables
+// replaced.  Parameters passed to handlers as REACTER_PARAM_<NAME> are matched by their name.
+func (self *Redactor) Environ(env []string, extra ...string) []string {
+	redacted := make([]string, len(env))
+
+	for i, pair := range env {
+		k, v := stringutil.SplitPair(pair, `=`)
+
+		if self.IsSensitive(k, extra...) || self.IsSensitive(strings.TrimPrefix(k, `REACTER_PARAM_`), extra...) {
+			v = RedactedPlaceholder
+		}
+
+		redacted[i] = k + `=` + v
+	}
+
+	return redacted
+}
+
+// Returns a copy of the given check with the values of all sensitive parameters and environment
+// variables replaced (including where they appear in its command.)  The original check is not
+// modified.
+func (self *Redactor) Check(check *Check) *Check {
+	if self == nil || check == nil {
+		return check
+	}
+
+	redacted := *check
+	redacted.Command = self.CheckCommand(check)
+
+	if check.Parameters != nil {
+		redacted.Parameters = make(map[string]interface{}, len(check.Parameters))
+
+		for k, v := range check.Parameters {
+			if self.IsSensitive(k, check.Redact...) {
+				redacted.Parameters[k] = RedactedPlaceholder
+			} else {
+				redacted.Parameters[k] = v
+			}
+		}
+	}
+
+	if self.OmitEnvironment {
+		redacted.Environment = nil
+	} else {
+		redacted.Environment = self.Map(check.Environment, check.Redact...)
+	}
+
+	return &redacted
+}
+
+// Returns a copy of the given event whose check has been redacted.
+func (self *Redactor) Event(event CheckEvent) CheckEvent {
+	event.Check = self.Check(event.Check)
+
+	if event.Group != nil {
+		group := *event.Group
+		group.Members = make([]CheckEvent, len(event.Group.Members))
+
+		for i, member := range event.Group.Members {
+			group.Members[i] = self.Event(member)
+		}
+
+		event.Group = &group
+	}
+
+	return event
+}
@@ -0,0 +1,122 @@
+package reacter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactorIsSensitive(t *testing.T) {
+	redactor := NewRedactor()
+
+	for _, tt := range []struct {
+		key       string
+		extra     []string
+		sensitive bool
+	}{
+		{`password`, nil, true},
+		{`DB_PASSWORD`, nil, true},
+		{`passwd`, nil, true},
+		{`client_secret`, nil, true},
+		{`AWS_SECRET_ACCESS_KEY`, nil, true},
+		{`api_token`, nil, true},
+		{`GITHUB_TOKEN`, nil, true},
+		{`credentials`, nil, true},
+		{`key`, nil, true},
+		{`apikey`, nil, true},
+		{`api_key`, nil, true},
+		{`API-KEY`, nil, true},
+		{`private_key`, nil, true},
+		{`basic_auth`, nil, true},
+		{`Authorization`, nil, true},
+		{`author`, nil, false},
+		{`monkey`, nil, false},
+		{`keyboard_layout`, nil, false},
+		{`key_id`, nil, false},
+		{`oauth_client`, nil, false},
+		{`region`, nil, false},
+		{`HOME`, nil, false},
+		{`bearer`, []string{`bearer`}, true},
+		{`dsn`, []string{`*_dsn`}, false},
+		{`db_dsn`, []string{`*_dsn`}, true},
+	} {
+		if sensitive := redactor.IsSensitive(tt.key, tt.extra...); sensitive != tt.sensitive {
+			t.Errorf("%s (extra %v): expected sensitive=%v", tt.key, tt.extra, tt.sensitive)
+		}
+	}
+}
+
+func TestRedactorCheck(t *testing.T) {
+	redactor := NewRedactor()
+	check := NewCheck()
+	check.Command = []string{`check_http`, `-k`, `Authorization: Bearer abc123`, `--user`, `author`}
+	check.Parameters = map[string]interface{}{
+		`bearer`: `abc123`,
+		`author`: `someone`,
+	}
+	check.Environment = Values{
+		`DB_PASSWORD`: `hunter2`,
+		`HOME_DIR`:    `/tmp`,
+	}
+	check.Redact = []string{`bearer`}
+
+	redacted := redactor.Check(check)
+
+	for _, tt := range []struct {
+		name     string
+		actual   interface{}
+		expected interface{}
+	}{
+		{`command`, redacted.Command, []string{`check_http`, `-k`, `Authorization: Bearer ********`, `--user`, `author`}},
+		{`parameters`, redacted.Parameters, map[string]interface{}{`bearer`: `********`, `author`: `someone`}},
+		{`environment`, redacted.Environment, Values{`DB_PASSWORD`: `********`, `HOME_DIR`: `/tmp`}},
+		{`original parameters`, check.Parameters[`bearer`], `abc123`},
+		{`original environment`, check.Environment[`DB_PASSWORD`], `hunter2`},
+	} {
+		if !reflect.DeepEqual(tt.actual, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, tt.actual)
+		}
+	}
+
+	redactor.Configure(RedactConfig{
+		OmitEnvironment: true,
+	})
+
+	if redacted := redactor.Check(check); redacted.Environment != nil {
+		t.Errorf("expected the environment to be omitted, got %v", redacted.Environment)
+	}
+}
+
+func TestRedactorEnviron(t *testing.T) {
+	redactor := NewRedactor()
+
+	for _, tt := range []struct {
+		env      []string
+		extra    []string
+		expected []string
+	}{
+		{[]string{`API_TOKEN=abc`, `USER=me`}, nil, []string{`API_TOKEN=********`, `USER=me`}},
+		{[]string{`REACTER_PARAM_PASSWORD=abc`}, nil, []string{`REACTER_PARAM_PASSWORD=********`}},
+		{[]string{`REACTER_PARAM_BEARER=abc`}, []string{`bearer`}, []string{`REACTER_PARAM_BEARER=********`}},
+		{[]string{`REACTER_CHECK_NAME=monkey`}, nil, []string{`REACTER_CHECK_NAME=monkey`}},
+	} {
+		if actual := redactor.Environ(tt.env, tt.extra...); !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%v: expected %v, got %v", tt.env, tt.expected, actual)
+		}
+	}
+}
+
+func TestRedactorConfigure(t *testing.T) {
+	redactor := NewRedactor()
+
+	//  the same file is loaded on every reload, alongside others
+	for i := 0; i < 3; i++ {
+		redactor.Configure(RedactConfig{Patterns: []string{`*_pin`, `*password*`}})
+		redactor.Configure(RedactConfig{Patterns: []string{`session`}})
+	}
+
+	expected := append(append([]string{}, DefaultRedactPatterns...), `*_pin`, `session`)
+
+	if !reflect.DeepEqual(redactor.Patterns, expected) {
+		t.Errorf("expected patterns %v, got %v", expected, redactor.Patterns)
+	}
+}
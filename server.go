@@ -3,19 +3,25 @@ package reacter
 //go:generate esc -o static.go -pkg reacter -modtime 1500000000 -prefix ui ui
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/ghetzel/diecast"
+	"github.com/ghetzel/go-stockutil/executil"
+	"github.com/ghetzel/go-stockutil/fileutil"
 	"github.com/ghetzel/go-stockutil/httputil"
 	"github.com/ghetzel/go-stockutil/log"
-	"github.com/ghetzel/go-stockutil/maputil"
 	"github.com/ghetzel/go-stockutil/netutil"
 	"github.com/ghetzel/go-stockutil/stringutil"
+	"github.com/ghetzel/go-stockutil/timeutil"
 	"github.com/ghetzel/go-stockutil/typeutil"
 	"github.com/husobee/vestigo"
 	"github.com/urfave/negroni"
@@ -23,24 +29,36 @@ import (
 
 var ZeroconfInstanceName = `reacter`
 
+// Where "reacter ctl" looks for the control socket if none is given.
+var DefaultControlSocket = executil.RootOrString(`/run/reacter/control.sock`, `~/.cache/reacter/control.sock`)
+
 type Server struct {
 	ZeroconfMDNS     bool
 	ZeroconfEC2Tag   string
 	PathPrefix       string
+	Token            string
+	Username         string
+	Password         string
+	CertFile         string
+	KeyFile          string
+	ClientCAFile     string
+	Router           *EventRouter
 	reacter          *Reacter
+	cluster          *Cluster
 	ec2CheckInterval time.Duration
 }
 
 func NewServer(reacter *Reacter) *Server {
 	return &Server{
 		reacter:          reacter,
+		cluster:          NewCluster(reacter),
 		ec2CheckInterval: 60 * time.Second,
 	}
 }
 
 func (self *Server) ListenAndServe(address string) error {
 	server := negroni.New()
-	router := vestigo.NewRouter()
+	router := self.apiRouter()
 	ui := diecast.NewServer(func() interface{} {
 		if dir := os.Getenv(`UI`); dir != `` {
 			return dir
@@ -51,14 +69,6 @@ func (self *Server) ListenAndServe(address string) error {
 
 	ui.RoutePrefix = strings.TrimSuffix(self.PathPrefix, `/`)
 
-	router.Get(`/reacter/v1/node`, func(w http.ResponseWriter, req *http.Request) {
-		httputil.RespondJSON(w, self.reacter)
-	})
-
-	router.Get(`/reacter/v1/checks`, func(w http.ResponseWriter, req *http.Request) {
-		httputil.RespondJSON(w, maputil.M(&self.reacter.checkset).MapNative())
-	})
-
 	vestigo.CustomNotFoundHandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		ui.ServeHTTP(w, req)
 	})
@@ -72,11 +82,419 @@ func (self *Server) ListenAndServe(address string) error {
 		}
 	}
 
+	if err := self.configurePeers(ui, address); err != nil {
+		return err
+	}
+
+	server.UseFunc(self.authenticate)
 	server.UseHandler(router)
-	server.Run(address)
+
+	if tlsConfig, err := self.serverTLSConfig(); err == nil {
+		httpServer := &http.Server{
+			Addr:      address,
+			Handler:   server,
+			TLSConfig: tlsConfig,
+		}
+
+		if self.TLSEnabled() {
+			return httpServer.ListenAndServeTLS(self.CertFile, self.KeyFile)
+		} else if tlsConfig.ClientCAs != nil {
+			return fmt.Errorf("A certificate and key are required to verify client certificates")
+		} else {
+			return httpServer.ListenAndServe()
+		}
+	} else {
+		return err
+	}
+}
+
+// Returns a router serving the JSON API, which is served over HTTP (along with the web interface)
+// and on the control socket.
+func (self *Server) apiRouter() *vestigo.Router {
+	router := vestigo.NewRouter()
+
+	router.Get(`/reacter/v1/node`, func(w http.ResponseWriter, req *http.Request) {
+		httputil.RespondJSON(w, self.reacter)
+	})
+
+	router.Get(`/reacter/v1/checks`, func(w http.ResponseWriter, req *http.Request) {
+		checks := make(map[string]CheckEvent)
+
+		self.reacter.checkset.Range(func(key interface{}, value interface{}) bool {
+			if event, ok := value.(CheckEvent); ok {
+				checks[typeutil.String(key)] = self.reacter.Redactor.Event(event)
+			}
+
+			return true
+		})
+
+		httputil.RespondJSON(w, checks)
+	})
+
+	router.Get(`/reacter/v1/cluster`, func(w http.ResponseWriter, req *http.Request) {
+		status := self.cluster.Status()
+
+		//  the checks of every peer are only included if asked for
+		if !typeutil.Bool(req.URL.Query().Get(`checks`)) {
+			summary := *status
+			summary.Peers = make([]*PeerStatus, len(status.Peers))
+
+			for i, peer := range status.Peers {
+				p := *peer
+				p.Checks = nil
+				summary.Peers[i] = &p
+			}
+
+			status = &summary
+		}
+
+		httputil.RespondJSON(w, status)
+	})
+
+	router.Get(`/reacter/v1/events/stream`, self.streamEvents)
+
+	//  events POSTed here (e.g.: by another node's HTTP sink) are dispatched to handlers
+	router.Post(`/reacter/v1/events`, self.authorized(func(w http.ResponseWriter, req *http.Request) {
+		if self.Router == nil {
+			httputil.RespondJSON(w, fmt.Errorf("Events can only be received when handling events"), http.StatusNotFound)
+			return
+		}
+
+		if status, err := ReadEvents(req, self.Router.dispatchJSON); err == nil {
+			w.WriteHeader(status)
+		} else {
+			httputil.RespondJSON(w, err, status)
+		}
+	}))
+
+	//  the web interface fetches the checks of other peers through these, so that requests to
+	//  peers are made with this server's certificate and credentials
+	router.Get(`/reacter/v1/peers/:peer/checks/:name`, func(w http.ResponseWriter, req *http.Request) {
+		self.proxyPeer(w, req, `/reacter/v1/checks/`+url.PathEscape(vestigo.Param(req, `name`)))
+	})
+
+	router.Get(`/reacter/v1/peers/:peer/checks/:name/history`, func(w http.ResponseWriter, req *http.Request) {
+		self.proxyPeer(w, req, `/reacter/v1/checks/`+url.PathEscape(vestigo.Param(req, `name`))+`/history`)
+	})
+
+	router.Get(`/reacter/v1/peers/:peer/events/stream`, self.proxyPeerStream)
+
+	router.Get(`/reacter/v1/nodes`, func(w http.ResponseWriter, req *http.Request) {
+		if self.Router != nil {
+			httputil.RespondJSON(w, self.Router.Nodes.List())
+		} else {
+			httputil.RespondJSON(w, fmt.Errorf("The node registry is only available when handling events"), http.StatusNotFound)
+		}
+	})
+
+	router.Get(`/reacter/v1/checks/:name`, func(w http.ResponseWriter, req *http.Request) {
+		if check := self.reacter.Check(vestigo.Param(req, `name`)); check != nil {
+			httputil.RespondJSON(w, self.reacter.Redactor.Check(check))
+		} else {
+			httputil.RespondJSON(w, fmt.Errorf("No such check"), http.StatusNotFound)
+		}
+	})
+
+	router.Get(`/reacter/v1/checks/:name/history`, func(w http.ResponseWriter, req *http.Request) {
+		if check := self.reacter.Check(vestigo.Param(req, `name`)); check != nil {
+			var since time.Time
+			limit := int(typeutil.Int(req.URL.Query().Get(`limit`)))
+
+			//  since is either a duration ("1h" means "in the last hour") or an RFC3339 timestamp
+			if s := req.URL.Query().Get(`since`); s != `` {
+				if d, err := timeutil.ParseDuration(s); err == nil {
+					since = time.Now().Add(-d)
+				} else if t, err := time.Parse(time.RFC3339, s); err == nil {
+					since = t
+				} else {
+					httputil.RespondJSON(w, fmt.Errorf("Invalid 'since' value %q", s), http.StatusBadRequest)
+					return
+				}
+			}
+
+			if check.History != nil {
+				httputil.RespondJSON(w, check.History.Entries(since, limit))
+			} else {
+				httputil.RespondJSON(w, []HistoryEntry{})
+			}
+		} else {
+			httputil.RespondJSON(w, fmt.Errorf("No such check"), http.StatusNotFound)
+		}
+	})
+
+	router.Post(`/reacter/v1/checks/:name/run`, self.authorized(func(w http.ResponseWriter, req *http.Request) {
+		self.updateCheck(w, req, http.StatusAccepted, func(check *Check) (*Check, error) {
+			return check.RunNow()
+		})
+	}))
+
+	router.Put(`/reacter/v1/checks/:name/enable`, self.authorized(func(w http.ResponseWriter, req *http.Request) {
+		self.updateCheck(w, req, http.StatusOK, func(check *Check) (*Check, error) {
+			return check.SetEnabled(true)
+		})
+	}))
+
+	router.Put(`/reacter/v1/checks/:name/disable`, self.authorized(func(w http.ResponseWriter, req *http.Request) {
+		self.updateCheck(w, req, http.StatusOK, func(check *Check) (*Check, error) {
+			return check.SetEnabled(false)
+		})
+	}))
+
+	router.Put(`/reacter/v1/checks/:name/interval`, self.authorized(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Interval interface{} `json:"interval"`
+		}
+
+		if err := httputil.ParseJSONRequest(req, &body); err == nil {
+			var interval time.Duration
+
+			//  intervals are either a duration string ("30s") or a number of seconds
+			if typeutil.IsNumeric(body.Interval) {
+				interval = time.Duration(typeutil.Float(body.Interval) * float64(time.Second))
+			} else if d, err := timeutil.ParseDuration(typeutil.String(body.Interval)); err == nil {
+				interval = d
+			} else {
+				httputil.RespondJSON(w, err, http.StatusBadRequest)
+				return
+			}
+
+			self.updateCheck(w, req, http.StatusOK, func(check *Check) (*Check, error) {
+				return check.SetInterval(interval)
+			})
+		} else {
+			httputil.RespondJSON(w, err, http.StatusBadRequest)
+		}
+	}))
+
+	router.Post(`/reacter/v1/checks/:name/results`, self.authorized(func(w http.ResponseWriter, req *http.Request) {
+		if check := self.reacter.Check(vestigo.Param(req, `name`)); check != nil {
+			var result CheckResult
+
+			if err := httputil.ParseJSONRequest(req, &result); err == nil {
+				if err := check.Submit(result); err == nil {
+					httputil.RespondJSON(w, nil, http.StatusAccepted)
+				} else {
+					httputil.RespondJSON(w, err, http.StatusServiceUnavailable)
+				}
+			} else {
+				httputil.RespondJSON(w, err, http.StatusBadRequest)
+			}
+		} else {
+			httputil.RespondJSON(w, fmt.Errorf("No such check"), http.StatusNotFound)
+		}
+	}))
+
+	router.Get(`/reacter/v1/acks`, func(w http.ResponseWriter, req *http.Request) {
+		if self.reacter.Acks != nil {
+			httputil.RespondJSON(w, self.reacter.Acks.List())
+		} else {
+			httputil.RespondJSON(w, []*Acknowledgement{})
+		}
+	})
+
+	router.Post(`/reacter/v1/acks`, self.authorized(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Acknowledgement
+			Expires string `json:"expires,omitempty"`
+		}
+
+		if err := httputil.ParseJSONRequest(req, &body); err == nil {
+			ack := body.Acknowledgement
+			ack.CreatedAt = time.Now()
+
+			if body.Expires != `` {
+				if d, err := timeutil.ParseDuration(body.Expires); err == nil {
+					expiresAt := ack.CreatedAt.Add(d)
+					ack.ExpiresAt = &expiresAt
+				} else {
+					httputil.RespondJSON(w, err, http.StatusBadRequest)
+					return
+				}
+			}
+
+			if ack.Author == `` {
+				ack.Author = `anonymous`
+			}
+
+			if err := self.reacter.Acknowledge(&ack); err == nil {
+				httputil.RespondJSON(w, &ack, http.StatusCreated)
+			} else {
+				httputil.RespondJSON(w, err, http.StatusBadRequest)
+			}
+		} else {
+			httputil.RespondJSON(w, err, http.StatusBadRequest)
+		}
+	}))
+
+	router.Delete(`/reacter/v1/acks/:node/:check`, self.authorized(func(w http.ResponseWriter, req *http.Request) {
+		node := vestigo.Param(req, `node`)
+		check := vestigo.Param(req, `check`)
+
+		if node == `` || check == `` {
+			httputil.RespondJSON(w, fmt.Errorf("Must specify both a node and a check"), http.StatusBadRequest)
+		} else if self.reacter.Acks == nil {
+			httputil.RespondJSON(w, fmt.Errorf("Acknowledgements are not enabled"), http.StatusNotFound)
+		} else if err := self.reacter.Unacknowledge(node, check); err == nil {
+			httputil.RespondJSON(w, nil)
+		} else if err == ErrNotAcknowledged {
+			httputil.RespondJSON(w, err, http.StatusNotFound)
+		} else {
+			httputil.RespondJSON(w, err)
+		}
+	}))
+
+	return router
+}
+
+// Serves the JSON API (but not the web interface) on a unix socket, so that local tools (e.g.:
+// "reacter ctl") can use it without a TCP port being opened.  Access is controlled by the socket's
+// permissions, so requests made through it don't need to present credentials.
+func (self *Server) ListenAndServeUnix(path string) error {
+	path = fileutil.MustExpandUser(path)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if listener, err := listenUnix(path, 0660); err == nil {
+		router := self.apiRouter()
+
+		return http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			router.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), localRequestKey, true)))
+		}))
+	} else {
+		return err
+	}
+}
+
+// Configures how requests to peers (including those the web interface makes to this server) are
+// made, so that they use TLS and authenticate themselves when this server requires it.
+func (self *Server) configurePeers(ui *diecast.Server, address string) error {
+	if tlsConfig, err := self.peerTLSConfig(); err == nil {
+		transport := &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		}
+
+		self.cluster.Client = &http.Client{
+			Transport: transport,
+		}
+
+		self.cluster.Header = self.peerHeaders()
+
+		//  bindings inherit the client's credentials, but present this server's certificate
+		//  (diecast only overrides the verification settings of this config)
+		diecast.BindingClient.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig.Clone(),
+		}
+	} else {
+		return err
+	}
+
+	if self.TLSEnabled() {
+		self.cluster.Scheme = `https`
+
+		host, port, _ := net.SplitHostPort(address)
+
+		if host == `` || host == `0.0.0.0` || host == `::` {
+			host = `127.0.0.1`
+		}
+
+		ui.BindingPrefix = `https://` + net.JoinHostPort(host, port)
+
+		//  without a CA to verify it against, the (probably self-signed) certificate is trusted
+		//  for requests the web interface makes to this server
+		if self.ClientCAFile != `` {
+			ui.TrustedRootPEMs = []string{self.ClientCAFile}
+		} else {
+			diecast.AllowInsecureLoopbackBindings = true
+		}
+	}
+
 	return nil
 }
 
+// Relays a GET request for the given path to the peer named in the request.
+func (self *Server) proxyPeer(w http.ResponseWriter, req *http.Request, path string) {
+	if query := req.URL.RawQuery; query != `` {
+		path += `?` + query
+	}
+
+	if response, err := self.cluster.Get(vestigo.Param(req, `peer`), path); err == nil {
+		defer response.Body.Close()
+
+		w.Header().Set(`Content-Type`, response.Header.Get(`Content-Type`))
+		w.WriteHeader(response.StatusCode)
+		io.Copy(w, response.Body)
+	} else if self.cluster.IsPeer(vestigo.Param(req, `peer`)) {
+		httputil.RespondJSON(w, err, http.StatusBadGateway)
+	} else {
+		httputil.RespondJSON(w, err, http.StatusNotFound)
+	}
+}
+
+// Relays the event stream of the peer named in the request until the client disconnects.
+func (self *Server) proxyPeerStream(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		http.Error(w, `Streaming is not supported`, http.StatusInternalServerError)
+		return
+	}
+
+	path := `/reacter/v1/events/stream`
+
+	if query := req.URL.RawQuery; query != `` {
+		path += `?` + query
+	}
+
+	if response, err := self.cluster.Stream(req.Context(), vestigo.Param(req, `peer`), path); err == nil {
+		defer response.Body.Close()
+
+		w.Header().Set(`Content-Type`, response.Header.Get(`Content-Type`))
+		w.Header().Set(`Cache-Control`, `no-cache`)
+		w.WriteHeader(response.StatusCode)
+		flusher.Flush()
+
+		buf := make([]byte, 4096)
+
+		for {
+			n, err := response.Body.Read(buf)
+
+			if n > 0 {
+				if _, werr := w.Write(buf[:n]); werr != nil {
+					return
+				}
+
+				flusher.Flush()
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	} else if self.cluster.IsPeer(vestigo.Param(req, `peer`)) {
+		httputil.RespondJSON(w, err, http.StatusBadGateway)
+	} else {
+		httputil.RespondJSON(w, err, http.StatusNotFound)
+	}
+}
+
+// Applies a change to the named check and responds with the copy of the check that the change
+// returned (the check itself may already be changing again on its monitor.)
+func (self *Server) updateCheck(w http.ResponseWriter, req *http.Request, status int, fn func(check *Check) (*Check, error)) {
+	if check := self.reacter.Check(vestigo.Param(req, `name`)); check != nil {
+		if updated, err := fn(check); err == nil {
+			httputil.RespondJSON(w, self.reacter.Redactor.Check(updated), status)
+		} else {
+			httputil.RespondJSON(w, err, http.StatusConflict)
+		}
+	} else {
+		httputil.RespondJSON(w, fmt.Errorf("No such check"), http.StatusNotFound)
+	}
+}
+
 func (self *Server) startZeroconf(port int) {
 	var ec2lastChecked time.Time
 
@@ -0,0 +1,369 @@
+package reacter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/netutil"
+)
+
+func TestServerRemoveAcknowledgement(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `reacter-server`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	reacter := NewReacter()
+	reacter.NodeName = `web1`
+	reacter.Acks = NewAckStore(filepath.Join(dir, `acks.json`))
+
+	if err := reacter.Acks.Acknowledge(&Acknowledgement{
+		NodeName:  `db1`,
+		CheckName: `disk`,
+		Author:    `someone`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	router := NewServer(reacter).apiRouter()
+
+	for _, tt := range []struct {
+		path   string
+		status int
+	}{
+		{`/reacter/v1/acks/db1/disk`, http.StatusNoContent},
+		{`/reacter/v1/acks/db1/disk`, http.StatusNotFound},
+		{`/reacter/v1/acks/db1/load`, http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(`DELETE`, tt.path, nil))
+
+		if w.Code != tt.status {
+			t.Errorf("DELETE %s: expected %d, got %d: %s", tt.path, tt.status, w.Code, w.Body.String())
+		}
+	}
+
+	reacter.Acks = nil
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(`DELETE`, `/reacter/v1/acks/db1/disk`, nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("DELETE without an acknowledgement store: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestServerUpdateCheck(t *testing.T) {
+	reacter := NewReacter()
+	reacter.NodeName = `web1`
+
+	if err := reacter.AddCheck(CheckConfig{
+		Name:     `test`,
+		Command:  []string{`true`},
+		Interval: `1h`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	check := reacter.Checks[0]
+	events := make(chan CheckEvent)
+	stop := make(chan bool)
+
+	defer close(stop)
+
+	go check.Monitor(events)
+	go func() {
+		for {
+			select {
+			case <-events:
+			case <-stop:
+				check.StopMonitorC <- true
+				return
+			}
+		}
+	}()
+
+	router := NewServer(reacter).apiRouter()
+
+	for _, tt := range []struct {
+		method  string
+		path    string
+		body    string
+		status  int
+		enabled bool
+	}{
+		{`POST`, `/reacter/v1/checks/test/run`, ``, http.StatusAccepted, true},
+		{`PUT`, `/reacter/v1/checks/test/disable`, ``, http.StatusOK, false},
+		{`POST`, `/reacter/v1/checks/test/run`, ``, http.StatusConflict, false},
+		{`PUT`, `/reacter/v1/checks/test/enable`, ``, http.StatusOK, true},
+		{`PUT`, `/reacter/v1/checks/test/interval`, `{"interval": "5m"}`, http.StatusOK, true},
+		{`PUT`, `/reacter/v1/checks/test/interval`, `{"interval": -1}`, http.StatusConflict, true},
+		{`POST`, `/reacter/v1/checks/test/run`, ``, http.StatusAccepted, true},
+		{`POST`, `/reacter/v1/checks/missing/run`, ``, http.StatusNotFound, true},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected %d, got %d: %s", tt.method, tt.path, tt.status, w.Code, w.Body.String())
+		} else if w.Code < 400 {
+			var updated Check
+
+			if err := json.Unmarshal(w.Body.Bytes(), &updated); err != nil {
+				t.Errorf("%s %s: %v", tt.method, tt.path, err)
+			} else if updated.Enabled != tt.enabled {
+				t.Errorf("%s %s: expected enabled=%v in the response", tt.method, tt.path, tt.enabled)
+			}
+		}
+	}
+}
+
+func TestServerProxyPeerStream(t *testing.T) {
+	peer := NewReacter()
+	peer.NodeName = `db1`
+	upstream := httptest.NewServer(NewServer(peer).apiRouter())
+	defer upstream.Close()
+
+	local := NewReacter()
+	local.Peers = []*netutil.Service{{
+		Address: strings.TrimPrefix(upstream.URL, `http://`),
+	}}
+
+	proxy := httptest.NewServer(NewServer(local).apiRouter())
+	defer proxy.Close()
+
+	if response, err := http.Get(proxy.URL + `/reacter/v1/peers/elsewhere:1234/events/stream`); err != nil {
+		t.Fatal(err)
+	} else if response.Body.Close(); response.StatusCode != http.StatusNotFound {
+		t.Errorf("streaming from an unknown peer: expected %d, got %d", http.StatusNotFound, response.StatusCode)
+	}
+
+	response, err := http.Get(proxy.URL + `/reacter/v1/peers/` + strings.Replace(local.Peers[0].Address, `:`, `%3A`, -1) + `/events/stream?check=disk`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, response.StatusCode)
+	} else if header := response.Header.Get(`Access-Control-Allow-Origin`); header != `` {
+		t.Errorf("the event stream should not allow cross-origin requests, got %q", header)
+	}
+
+	//  wait for the proxied request to subscribe before publishing
+	for subscribed := false; !subscribed; time.Sleep(10 * time.Millisecond) {
+		peer.subscribers.Range(func(key interface{}, value interface{}) bool {
+			subscribed = true
+			return false
+		})
+	}
+
+	for _, name := range []string{`load`, `disk`} {
+		check := NewCheck()
+		check.NodeName = `db1`
+		check.Name = name
+		peer.publish(CheckEvent{
+			Check: check,
+		})
+	}
+
+	lines := bufio.NewScanner(response.Body)
+
+	for lines.Scan() {
+		if line := lines.Text(); strings.HasPrefix(line, `data: `) {
+			var event CheckEvent
+
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, `data: `)), &event); err != nil {
+				t.Fatal(err)
+			} else if event.Check == nil || event.Check.Name != `disk` {
+				t.Fatalf("expected only the disk check to be streamed, got %+v", event.Check)
+			}
+
+			return
+		}
+	}
+
+	t.Fatalf("the stream ended without an event: %v", lines.Err())
+}
+
+func TestServerSubmitResult(t *testing.T) {
+	reacter := NewReacter()
+	reacter.NodeName = `web1`
+
+	if err := reacter.AddCheck(CheckConfig{
+		Name:    `backup`,
+		Passive: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	check := reacter.Checks[0]
+	events := make(chan CheckEvent, 1)
+
+	go check.Monitor(events)
+	defer func() {
+		check.StopMonitorC <- true
+	}()
+
+	router := NewServer(reacter).apiRouter()
+
+	for _, tt := range []struct {
+		method string
+		path   string
+		body   string
+		status int
+		state  ObservationState
+		output string
+		value  float64
+	}{
+		{`POST`, `/reacter/v1/checks/backup/results`, `{"status": 0, "output": "OK: backed up", "perfdata": "size=42;50;60;0;100"}`, http.StatusAccepted, SuccessState, `OK: backed up`, 42},
+		{`POST`, `/reacter/v1/checks/backup/results`, `{"status": 2, "output": "CRITICAL: no space left"}`, http.StatusAccepted, CriticalState, `CRITICAL: no space left`, 0},
+		{`POST`, `/reacter/v1/checks/backup/results`, `not json`, http.StatusBadRequest, 0, ``, 0},
+		{`POST`, `/reacter/v1/checks/missing/results`, `{"status": 0}`, http.StatusNotFound, 0, ``, 0},
+		{`PUT`, `/reacter/v1/checks/backup/disable`, ``, http.StatusOK, 0, ``, 0},
+		{`POST`, `/reacter/v1/checks/backup/results`, `{"status": 0}`, http.StatusServiceUnavailable, 0, ``, 0},
+		{`PUT`, `/reacter/v1/checks/backup/enable`, ``, http.StatusOK, 0, ``, 0},
+		{`POST`, `/reacter/v1/checks/backup/results`, `{"status": 1, "output": "WARNING: slow"}`, http.StatusAccepted, WarningState, `WARNING: slow`, 0},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected %d, got %d: %s", tt.method, tt.path, tt.status, w.Code, w.Body.String())
+		}
+
+		if tt.method != `POST` || w.Code != http.StatusAccepted {
+			select {
+			case event := <-events:
+				t.Errorf("%s %s: expected no event, got %+v", tt.method, tt.path, event)
+			default:
+			}
+
+			continue
+		}
+
+		select {
+		case event := <-events:
+			if event.Error || event.Observation == nil {
+				t.Errorf("%s %s: expected an observation, got %+v", tt.method, tt.path, event)
+			} else if event.Observation.State != tt.state || event.Output != tt.output {
+				t.Errorf("%s %s: expected state %d (%q), got %d (%q)", tt.method, tt.path, tt.state, tt.output, event.Observation.State, event.Output)
+			} else if tt.value != 0 && event.Observation.PerformanceData[`size`].Value != tt.value {
+				t.Errorf("%s %s: expected size=%v, got %+v", tt.method, tt.path, tt.value, event.Observation.PerformanceData)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s %s: timed out waiting for an event", tt.method, tt.path)
+		}
+	}
+}
+
+func TestServerListenAndServeUnix(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `reacter-server`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	reacter := NewReacter()
+	reacter.NodeName = `web1`
+
+	if err := reacter.AddCheck(CheckConfig{
+		Name:     `test`,
+		Command:  []string{`true`},
+		Interval: `1h`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	check := reacter.Checks[0]
+	events := make(chan CheckEvent, 8)
+
+	go check.Monitor(events)
+	defer func() {
+		check.StopMonitorC <- true
+	}()
+
+	server := NewServer(reacter)
+	server.Username = `ops`
+	server.Password = `hunter2`
+	server.Token = `s3cr3t`
+
+	path := filepath.Join(dir, `run`, `reacter.sock`)
+	served := make(chan error, 1)
+
+	go func() {
+		served <- server.ListenAndServeUnix(path)
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, `unix`, path)
+			},
+		},
+	}
+
+	waitFor(t, `the control socket`, func() bool {
+		select {
+		case err := <-served:
+			t.Fatal(err)
+		default:
+		}
+
+		if conn, err := net.Dial(`unix`, path); err == nil {
+			conn.Close()
+			return true
+		}
+
+		return false
+	})
+
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if mode := info.Mode().Perm(); mode != 0660 {
+		t.Errorf("expected the control socket to have mode 0660, got %o", mode)
+	}
+
+	for _, tt := range []struct {
+		method string
+		path   string
+		status int
+	}{
+		{`GET`, `/reacter/v1/node`, http.StatusOK},
+		{`PUT`, `/reacter/v1/checks/test/disable`, http.StatusOK},
+		{`PUT`, `/reacter/v1/checks/test/enable`, http.StatusOK},
+		{`POST`, `/reacter/v1/checks/missing/run`, http.StatusNotFound},
+	} {
+		req, err := http.NewRequest(tt.method, `http://reacter`+tt.path, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if response, err := client.Do(req); err != nil {
+			t.Errorf("%s %s: %v", tt.method, tt.path, err)
+		} else if response.Body.Close(); response.StatusCode != tt.status {
+			t.Errorf("%s %s: expected %d without credentials, got %d", tt.method, tt.path, tt.status, response.StatusCode)
+		}
+	}
+
+	if err := server.ListenAndServeUnix(path); err == nil {
+		t.Errorf("expected listening on a control socket in use to fail")
+	}
+}
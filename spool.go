@@ -0,0 +1,530 @@
+package reacter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+var DefaultSpoolSegmentSize int64 = 1024 * 1024
+var DefaultSpoolMaxSize int64 = 256 * 1024 * 1024
+var DefaultSpoolMaxAge = 24 * time.Hour
+var DefaultSpoolRetryInterval = time.Second
+var DefaultSpoolMaxRetryInterval = time.Minute
+
+// How often a waiting reader checks for expired segments.
+var SpoolExpireInterval = time.Minute
+
+const spoolSegmentExt = `.segment`
+const spoolCursorFile = `cursor`
+
+// A Spool is a disk-backed queue of serialized events.  Events are appended to segment files (one
+// event per line), which are rotated once they reach SegmentSize bytes.  Events are read back in
+// the order they were written, and the position of the last event that was successfully delivered
+// is kept in a cursor file, so delivery resumes where it left off after a restart.  Whole segments
+// are discarded once they've been read, or (even if they haven't) once the spool grows beyond
+// MaxSize bytes or the segment is older than MaxAge.
+type Spool struct {
+	Dir         string
+	SegmentSize int64
+	MaxSize     int64
+	MaxAge      time.Duration
+	segments    []int64
+	sizes       map[int64]int64
+	writer      *os.File
+	readFile    *os.File
+	readBuf     *bufio.Reader
+	read        spoolPosition
+	pending     spoolPosition
+	cursor      spoolPosition
+	notify      chan struct{}
+	lock        sync.Mutex
+}
+
+type spoolPosition struct {
+	Segment int64 `json:"segment"`
+	Offset  int64 `json:"offset"`
+}
+
+// Opens (creating, if necessary) the spool in the given directory.
+func OpenSpool(dir string) (*Spool, error) {
+	spool := &Spool{
+		Dir:         fileutil.MustExpandUser(dir),
+		SegmentSize: DefaultSpoolSegmentSize,
+		MaxSize:     DefaultSpoolMaxSize,
+		MaxAge:      DefaultSpoolMaxAge,
+		sizes:       make(map[int64]int64),
+		notify:      make(chan struct{}, 1),
+	}
+
+	if err := os.MkdirAll(spool.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	if matches, err := filepath.Glob(filepath.Join(spool.Dir, `*`+spoolSegmentExt)); err == nil {
+		for _, path := range matches {
+			if seq, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(path), spoolSegmentExt), 10, 64); err == nil {
+				if stat, err := os.Stat(path); err == nil {
+					spool.segments = append(spool.segments, seq)
+					spool.sizes[seq] = stat.Size()
+				}
+			}
+		}
+	} else {
+		return nil, err
+	}
+
+	sort.Slice(spool.segments, func(i int, j int) bool {
+		return spool.segments[i] < spool.segments[j]
+	})
+
+	if data, err := ioutil.ReadFile(filepath.Join(spool.Dir, spoolCursorFile)); err == nil {
+		if err := json.Unmarshal(data, &spool.cursor); err != nil {
+			return nil, fmt.Errorf("invalid spool cursor: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	//  segments before the cursor have already been delivered
+	for len(spool.segments) > 0 && spool.segments[0] < spool.cursor.Segment {
+		spool.remove(spool.segments[0])
+	}
+
+	if len(spool.segments) == 0 {
+		spool.cursor = spoolPosition{}
+	} else if spool.cursor.Segment != spool.segments[0] {
+		spool.cursor = spoolPosition{
+			Segment: spool.segments[0],
+		}
+	}
+
+	spool.read = spool.cursor
+	spool.pending = spool.cursor
+
+	if n := spool.Size(); n > 0 {
+		log.Noticef("Spool %s holds %d byte(s) in %d segment(s)", spool.Dir, n, len(spool.segments))
+	}
+
+	return spool, nil
+}
+
+// Returns the total size of all segments, in bytes.
+func (self *Spool) Size() int64 {
+	var total int64
+
+	for _, size := range self.sizes {
+		total += size
+	}
+
+	return total
+}
+
+// Appends a serialized event to the spool.
+func (self *Spool) Append(data []byte) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if err := self.rotate(); err != nil {
+		return err
+	}
+
+	current := self.segments[len(self.segments)-1]
+
+	if n, err := self.writer.Write(append(data, '\n')); err == nil {
+		self.sizes[current] += int64(n)
+	} else {
+		return err
+	}
+
+	self.expire()
+
+	select {
+	case self.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Returns the next unread event, blocking until one is available or done is closed (in which case
+// io.EOF is returned.)  The event isn't considered delivered until Commit is called; until then, it
+// is read again after a restart.
+func (self *Spool) Next(done <-chan struct{}) ([]byte, error) {
+	ticker := time.NewTicker(SpoolExpireInterval)
+	defer ticker.Stop()
+
+	for {
+		if data, err := self.next(); err != nil || data != nil {
+			return data, err
+		}
+
+		select {
+		case <-self.notify:
+		case <-ticker.C:
+			self.lock.Lock()
+			self.expire()
+			self.lock.Unlock()
+		case <-done:
+			return nil, io.EOF
+		}
+	}
+}
+
+// Records that every event returned by Next so far has been delivered.
+func (self *Spool) Commit() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.pending == self.cursor {
+		return nil
+	}
+
+	self.cursor = self.pending
+
+	//  segments before the cursor have been read in full
+	for len(self.segments) > 0 && self.segments[0] < self.cursor.Segment {
+		self.remove(self.segments[0])
+	}
+
+	return self.saveCursor()
+}
+
+// Closes the spool's files.  Events that haven't been committed are read again when the spool is
+// reopened.
+func (self *Spool) Close() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.readFile != nil {
+		self.readFile.Close()
+		self.readFile = nil
+	}
+
+	if self.writer != nil {
+		err := self.writer.Close()
+		self.writer = nil
+		return err
+	}
+
+	return nil
+}
+
+func (self *Spool) next() ([]byte, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	for len(self.segments) > 0 {
+		//  the segment being read was discarded (because the spool was full or it expired)
+		if self.read.Segment < self.segments[0] {
+			self.read = spoolPosition{
+				Segment: self.segments[0],
+			}
+		}
+
+		if self.readFile == nil {
+			if file, err := os.Open(self.segmentPath(self.read.Segment)); err == nil {
+				if _, err := file.Seek(self.read.Offset, io.SeekStart); err != nil {
+					file.Close()
+					return nil, err
+				}
+
+				self.readFile = file
+				self.readBuf = bufio.NewReader(file)
+			} else {
+				return nil, err
+			}
+		}
+
+		if line, err := self.readBuf.ReadBytes('\n'); err == nil {
+			self.read.Offset += int64(len(line))
+			self.pending = self.read
+			return line[:len(line)-1], nil
+		} else if err != io.EOF {
+			return nil, err
+		} else if len(line) > 0 {
+			//  a partially-written line; read it again once it's complete
+			self.closeReader()
+		}
+
+		if self.read.Segment == self.segments[len(self.segments)-1] {
+			//  caught up with the writer; the reader is reopened once more is appended
+			self.closeReader()
+			return nil, nil
+		}
+
+		//  move on to the next segment
+		self.closeReader()
+
+		for _, seq := range self.segments {
+			if seq > self.read.Segment {
+				self.read = spoolPosition{
+					Segment: seq,
+				}
+
+				break
+			}
+		}
+
+		self.pending = self.read
+	}
+
+	return nil, nil
+}
+
+func (self *Spool) closeReader() {
+	if self.readFile != nil {
+		self.readFile.Close()
+		self.readFile = nil
+		self.readBuf = nil
+	}
+}
+
+// Starts a new segment if there isn't one being written, or the current one is full.
+func (self *Spool) rotate() error {
+	if self.writer != nil {
+		current := self.segments[len(self.segments)-1]
+
+		if self.SegmentSize <= 0 || self.sizes[current] < self.SegmentSize {
+			return nil
+		}
+
+		self.writer.Close()
+		self.writer = nil
+	} else if len(self.segments) > 0 {
+		//  continue appending to the newest segment left by a previous process, if it has room
+		current := self.segments[len(self.segments)-1]
+
+		if self.SegmentSize <= 0 || self.sizes[current] < self.SegmentSize {
+			if file, err := os.OpenFile(self.segmentPath(current), os.O_WRONLY|os.O_APPEND, 0600); err == nil {
+				self.writer = file
+				return nil
+			}
+		}
+	}
+
+	//  segments are named so that they sort in the order they were created
+	seq := time.Now().UnixNano()
+
+	if n := len(self.segments); n > 0 && seq <= self.segments[n-1] {
+		seq = self.segments[n-1] + 1
+	}
+
+	if file, err := os.OpenFile(self.segmentPath(seq), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0600); err == nil {
+		self.writer = file
+		self.segments = append(self.segments, seq)
+		self.sizes[seq] = 0
+
+		if len(self.segments) == 1 && self.cursor.Segment < seq {
+			self.cursor = spoolPosition{
+				Segment: seq,
+			}
+
+			self.pending = self.cursor
+			self.read = self.cursor
+		}
+
+		return nil
+	} else {
+		return err
+	}
+}
+
+// Discards the oldest segments (other than the one being written) while the spool is over its size
+// limit or they are older than its age limit.
+func (self *Spool) expire() {
+	for len(self.segments) > 1 {
+		oldest := self.segments[0]
+		reason := ``
+
+		if self.MaxSize > 0 && self.Size() > self.MaxSize {
+			reason = fmt.Sprintf("the spool is larger than %d bytes", self.MaxSize)
+		} else if self.MaxAge > 0 {
+			if stat, err := os.Stat(self.segmentPath(oldest)); err == nil && time.Since(stat.ModTime()) > self.MaxAge {
+				reason = fmt.Sprintf("it is older than %v", self.MaxAge)
+			}
+		}
+
+		if reason == `` {
+			return
+		}
+
+		if oldest >= self.cursor.Segment {
+			log.Errorf("Discarding undelivered events in spool segment %d because %s", oldest, reason)
+		}
+
+		if self.read.Segment == oldest {
+			self.closeReader()
+		}
+
+		self.remove(oldest)
+
+		if self.cursor.Segment <= oldest {
+			self.cursor = spoolPosition{
+				Segment: self.segments[0],
+			}
+
+			self.saveCursor()
+		}
+	}
+}
+
+func (self *Spool) remove(seq int64) {
+	if err := os.Remove(self.segmentPath(seq)); err != nil && !os.IsNotExist(err) {
+		log.Warningf("Failed to remove spool segment %d: %v", seq, err)
+	}
+
+	delete(self.sizes, seq)
+
+	for i, s := range self.segments {
+		if s == seq {
+			self.segments = append(self.segments[:i], self.segments[i+1:]...)
+			break
+		}
+	}
+}
+
+func (self *Spool) segmentPath(seq int64) string {
+	return filepath.Join(self.Dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+// Saves the cursor, writing it to a temporary file first so that a crash never leaves a partial
+// cursor behind.
+func (self *Spool) saveCursor() error {
+	if data, err := json.Marshal(self.cursor); err == nil {
+		path := filepath.Join(self.Dir, spoolCursorFile)
+
+		if err := ioutil.WriteFile(path+`.tmp`, data, 0600); err != nil {
+			return err
+		}
+
+		return os.Rename(path+`.tmp`, path)
+	} else {
+		return err
+	}
+}
+
+// A SpooledSink writes events to a spool, and delivers them to another sink in the background, so
+// that writing an event never waits for the other sink.  If the sink fails, delivery is retried (in
+// order) with exponential backoff.
+type SpooledSink struct {
+	Sink             Sink
+	Spool            *Spool
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	done             chan struct{}
+	stopped          chan struct{}
+	once             sync.Once
+}
+
+// Starts delivering events from the spool to the given sink.
+func NewSpooledSink(sink Sink, spool *Spool) *SpooledSink {
+	spooled := &SpooledSink{
+		Sink:             sink,
+		Spool:            spool,
+		RetryInterval:    DefaultSpoolRetryInterval,
+		MaxRetryInterval: DefaultSpoolMaxRetryInterval,
+		done:             make(chan struct{}),
+		stopped:          make(chan struct{}),
+	}
+
+	go spooled.run()
+
+	return spooled
+}
+
+func (self *SpooledSink) Write(event CheckEvent) error {
+	if data, err := json.Marshal(event); err == nil {
+		return self.Spool.Append(data)
+	} else {
+		return err
+	}
+}
+
+// Stops delivering events (those not yet delivered remain in the spool), and closes the sink and
+// the spool.
+func (self *SpooledSink) Close() error {
+	self.once.Do(func() {
+		close(self.done)
+	})
+
+	//  the sink is closed first, since closing it is what interrupts a write that is blocked (e.g.:
+	//  a publisher waiting for an unreachable broker); the interrupted event stays in the spool
+	err := self.Sink.Close()
+
+	<-self.stopped
+
+	if serr := self.Spool.Close(); err == nil {
+		err = serr
+	}
+
+	return err
+}
+
+func (self *SpooledSink) run() {
+	defer close(self.stopped)
+
+	for {
+		data, err := self.Spool.Next(self.done)
+
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			log.Errorf("Failed to read from spool %s: %v", self.Spool.Dir, err)
+
+			select {
+			case <-self.done:
+				return
+			case <-time.After(self.RetryInterval):
+				continue
+			}
+		}
+
+		var event CheckEvent
+
+		if err := json.Unmarshal(data, &event); err != nil {
+			log.Errorf("Discarding invalid event in spool %s: %v", self.Spool.Dir, err)
+		} else if !self.deliver(event) {
+			return
+		}
+
+		if err := self.Spool.Commit(); err != nil {
+			log.Warningf("Failed to save spool cursor: %v", err)
+		}
+	}
+}
+
+// Writes the event to the sink, retrying until it succeeds (returning true) or the sink is closed.
+func (self *SpooledSink) deliver(event CheckEvent) bool {
+	interval := self.RetryInterval
+
+	for {
+		if err := self.Sink.Write(event); err == nil {
+			return true
+		} else {
+			log.Warningf("Failed to write event to %T, retrying in %v: %v", self.Sink, interval, err)
+		}
+
+		select {
+		case <-self.done:
+			return false
+		case <-time.After(interval):
+		}
+
+		if interval *= 2; interval > self.MaxRetryInterval {
+			interval = self.MaxRetryInterval
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package reacter
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func tempSpool(t *testing.T) (string, *Spool) {
+	dir, err := ioutil.TempDir(``, `reacter-spool`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spool, err := OpenSpool(dir)
+
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return dir, spool
+}
+
+func reopenSpool(t *testing.T, spool *Spool) *Spool {
+	if err := spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenSpool(spool.Dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopened.SegmentSize = spool.SegmentSize
+	return reopened
+}
+
+// reads up to n events (or every available event if n < 0) without waiting for more
+func readSpool(t *testing.T, spool *Spool, n int) []string {
+	done := make(chan struct{})
+	close(done)
+
+	events := make([]string, 0)
+
+	for n < 0 || len(events) < n {
+		if data, err := spool.Next(done); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		} else {
+			events = append(events, string(data))
+		}
+	}
+
+	return events
+}
+
+func appendSpool(t *testing.T, spool *Spool, events ...string) {
+	for _, event := range events {
+		if err := spool.Append([]byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+	events := []string{`{"n":1}`, `{"n":2}`, `{"n":3}`, `{"n":4}`, `{"n":5}`}
+
+	for _, tt := range []struct {
+		name      string
+		read      int
+		commit    bool
+		remaining []string
+	}{
+		{`nothing read`, 0, false, events},
+		{`read without committing`, 3, false, events},
+		{`read and committed`, 3, true, events[3:]},
+		{`everything committed`, 5, true, []string{}},
+	} {
+		for _, segmentSize := range []int64{0, 16} {
+			dir, spool := tempSpool(t)
+			spool.SegmentSize = segmentSize
+			appendSpool(t, spool, events...)
+
+			if read := readSpool(t, spool, tt.read); !reflect.DeepEqual(read, events[:tt.read]) {
+				t.Errorf("%s (segment size %d): expected %v in order, got %v", tt.name, segmentSize, events[:tt.read], read)
+			}
+
+			if tt.commit {
+				if err := spool.Commit(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			spool = reopenSpool(t, spool)
+
+			if remaining := readSpool(t, spool, -1); !reflect.DeepEqual(remaining, tt.remaining) {
+				t.Errorf("%s (segment size %d): expected %v after reopening, got %v", tt.name, segmentSize, tt.remaining, remaining)
+			}
+
+			spool.Close()
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+func TestSpoolSegmentRotation(t *testing.T) {
+	dir, spool := tempSpool(t)
+	defer os.RemoveAll(dir)
+	defer spool.Close()
+
+	//  each event is 8 bytes with its newline, so segments hold two events
+	spool.SegmentSize = 16
+	appendSpool(t, spool, `{"n":1}`, `{"n":2}`, `{"n":3}`, `{"n":4}`, `{"n":5}`)
+
+	segments := func() int {
+		matches, _ := filepath.Glob(filepath.Join(dir, `*`+spoolSegmentExt))
+		return len(matches)
+	}
+
+	if n := segments(); n != 3 {
+		t.Fatalf("expected 3 segments, got %d", n)
+	}
+
+	for _, tt := range []struct {
+		read     int
+		segments int
+	}{
+		{1, 3},
+		{2, 2},
+		{1, 2},
+		{1, 1},
+		{1, 1},
+	} {
+		readSpool(t, spool, tt.read)
+
+		if err := spool.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := segments(); n != tt.segments {
+			t.Errorf("expected %d segment(s) after reading %d more event(s), got %d", tt.segments, tt.read, n)
+		}
+	}
+
+	//  appending continues in the newest segment
+	appendSpool(t, spool, `{"n":6}`)
+
+	if events := readSpool(t, spool, -1); !reflect.DeepEqual(events, []string{`{"n":6}`}) {
+		t.Errorf("expected only the new event, got %v", events)
+	}
+}
+
+func TestSpoolExpiry(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		configure func(spool *Spool)
+		remaining []string
+	}{
+		{
+			name: `size`,
+			configure: func(spool *Spool) {
+				spool.MaxSize = 24
+			},
+			remaining: []string{`{"n":5}`, `{"n":6}`, `{"n":7}`},
+		}, {
+			name: `age`,
+			configure: func(spool *Spool) {
+				spool.MaxAge = time.Hour
+				old := time.Now().Add(-2 * time.Hour)
+
+				os.Chtimes(spool.segmentPath(spool.segments[0]), old, old)
+			},
+			remaining: []string{`{"n":3}`, `{"n":4}`, `{"n":5}`, `{"n":6}`, `{"n":7}`},
+		}, {
+			name:      `no limits`,
+			configure: func(spool *Spool) {},
+			remaining: []string{`{"n":1}`, `{"n":2}`, `{"n":3}`, `{"n":4}`, `{"n":5}`, `{"n":6}`, `{"n":7}`},
+		},
+	} {
+		dir, spool := tempSpool(t)
+		spool.SegmentSize = 16
+		spool.MaxSize = 0
+		spool.MaxAge = 0
+
+		appendSpool(t, spool, `{"n":1}`, `{"n":2}`, `{"n":3}`, `{"n":4}`, `{"n":5}`, `{"n":6}`)
+		tt.configure(spool)
+		appendSpool(t, spool, `{"n":7}`)
+
+		if remaining := readSpool(t, spool, -1); !reflect.DeepEqual(remaining, tt.remaining) {
+			t.Errorf("%s: expected %v to remain, got %v", tt.name, tt.remaining, remaining)
+		}
+
+		spool.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// a sink whose writes block until it is closed, like a publisher waiting for an unreachable broker
+type blockingSink struct {
+	closed chan struct{}
+}
+
+func (self *blockingSink) Write(event CheckEvent) error {
+	<-self.closed
+	return fmt.Errorf("sink is closed")
+}
+
+func (self *blockingSink) Close() error {
+	close(self.closed)
+	return nil
+}
+
+func TestSpooledSinkCloseInterruptsBlockedWrite(t *testing.T) {
+	dir, spool := tempSpool(t)
+	defer os.RemoveAll(dir)
+
+	sink := NewSpooledSink(&blockingSink{
+		closed: make(chan struct{}),
+	}, spool)
+
+	check := NewCheck()
+	check.Name = `test`
+
+	if err := sink.Write(CheckEvent{Check: check}); err != nil {
+		t.Fatal(err)
+	}
+
+	//  give the delivery goroutine time to block writing the event
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan error)
+
+	go func() {
+		closed <- sink.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close deadlocked waiting for a blocked write")
+	}
+
+	reopened, err := OpenSpool(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer reopened.Close()
+
+	if events := readSpool(t, reopened, -1); len(events) != 1 {
+		t.Errorf("expected the undelivered event to remain in the spool, got %d event(s)", len(events))
+	}
+}
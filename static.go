@@ -192,18 +192,41 @@ var _escData = map[string]*_escFile{
 
 	"/_checks.html": {
 		local:   "ui/_checks.html",
-		size:    1469,
+		size:    2737,
 		modtime: 1500000000,
 		compressed: `
-H4sIAAAAAAAC/5RUwY6bMBC95ytGaKW0VcGJ1F4Qm0P3uNX20EMPVbU49mywQgzrMZtGiH+vbEwTSDbt
-ckDYnvfezLwxcRzP1kpLpTeUzmIA0HyHKbhHVxJn7sMgVY0RmAIzyIVFw16WzB9PIDWioYCpkVu3O2+0
-eoZ3ddmILdwkg1ri8IkHQMSlNEgUvZ9PBOeFtXXKWNtCAl13qi8KFFvqAVbtsGqc3Ode/omX5ZqLbQo/
-f/mNSpeHR/WUAsxF1Wh7OZP5zDUks3xdIoiSE91G/cK/Y9rBPl4uFtHKk2a2QC77735tjosQMNDUJv4U
-rb5bbjFjtjiLWz3w3Ssnd65SeKjkK+dfOVnwQSjHERkbMnL7f3PN7LqSh2NY24LheoNwgy+oLUF6C1QZ
-++Vwj4fTTgW7PiS++b5xj879CLruApuSHwPlhDHIRIFmypBZMyqybUE9BVSQFoWTkKco95x6Frct0F5Z
-UYyh5DyAXDoCk8MCcmqEQKIclpDvudFKb3LoumiaBOqR4NQJOfZ6dHosA59/X8pnMS3Fc1LN9cC65nKD
-4N9xyHiYxm/3GXOhFzWxJLwivHyTcGjPIPyjX/5L/S0KvS+DwJ1RVgleXlPQZ2OQMSvP3Fm17bh+N3fQ
-df8ZPMz6NQQpLYZblLifElm+qyEiN97AN9UYebyel0sZ72QsXNuM+fle/QkAAP//UgphX70FAAA=
+H4sIAAAAAAAC/6VWTW/bMAy951cIRrHTZCfbToHjYuhxQ3cYhh0TRWJqIf7IJLlpUeS/j5IcJ47lFmkL
+1LEkvkfqkZRMKZ2sZSVk9aDnE0oIqVgJc2L/eNFoA2pi3xXoulEcVxIFjON08jhLWotbngPf6oVRDTjr
+DSuKNePbOXk5TCi6SA1bF4CMTOtF5AfuSXVJ9nQ2nUZEikXkiahbijLHlZocmPDvfqxOg9bgSLxT9BvR
+tfJ4Iphh1A4XkTbMIONv+5MmJh+lCKKtJlF2j893YGuB2Du7MXKP79czGFkCxl/uouwn04Y4LhB9Ihy1
+utj5TrHUrGvxfDJ7eSGKVQ9AbnYAiswX5CY+5j9u0xnbJU0OhwBKis/kBh6hMg5rLWOftHN7zFFvh24z
+1nYRIZVHMSGwqCwsGtq6dHlj58z7iN10GGFTNATY2RF7TEXAHmeX46AuE+fIbnKAQRu56TvApjgXyrfZ
+qSmoBl5XgqlnYuDJ0LIxIAakUGgYMPPcZki8yo5YvZeG5yFZV8ISqBWZkpVuOMfkrMiMrPZMVVgeq9D2
+oOo5vKxrcd6YUX/1JBD8ewrFM73ciuPUO1YdWddMYE26J20jbg+T7NePNLGmQZ9H/UYcz65y3MpzdPzX
+D9/v/et12+7qpfX/p9pW9b56y/81PnxdHB3cKWkkZ8VrHqpBGeKhJAbVMQSnjOQKNr69YiGB44EXqxrb
+YLnDBfmExImT69adJ4Hj5BNeJJd9LW1AUTZyPKQJG6vNt5q3E24we9Z84YSVBf0SBWFGmgIPp+/cprIA
+Ydt6/Uwuo2f2vzF5rTCqcLgxr8vSHtaHwzyIP613eRvGlAWjTOVxfxuGNz51pJRLxe3dnSYyI+c7GMp2
+VQGNpAR7poAPJwXzsX07H/e1/QxqCqOJlhWHgaBIbJb1WoN6BLFk5iNiFjWKWbc6/ra7/KCA4Q587QIM
+IrovFauA6yivxeAyjHSEHIQ91H2e04dKONb+DFr7Dxh8sVdY9h9cVrZGsQoAAA==
+`,
+	},
+
+	"/_cluster.html": {
+		local:   "ui/_cluster.html",
+		size:    2123,
+		modtime: 1500000000,
+		compressed: `
+H4sIAAAAAAAC/61VwY7bIBC9+yuQm0N7IN60PUWOLz1u1e2l6rHCBicoNqwAbzaK8u9lDHYgdtqo3RwS
+mBneYx4zE4xxUnJBudjqdYIRQoK0bI3gUzWdNkwlsFZMy05V1pMpRiprzl5WWRhRk6YpSbVfo9M5wRb2
+dEKLSnbCaLTeoMVyoFn6U0vvPJ+TnPIXS0e03qQU1w17RW2JP6VFjxx6W4U/e3Pv0s9EDL6S0C1D/TfW
+XVUxrdPicoul3JOjZcszOFSgp0eHnln4fyc6ECVsVhGRtwVcP53lLQgpEVumIr5KccMr0gSEX7zpLRg1
+q6SgRB0j0k7shTyIgPOHs/yRssGkMzJgBcRpaUCN7UjZMAuPZA1RPe1c7DNjCqoIweK9/oDGw+FN/E+S
+mx7W38dt+m+sW3TAq4eHoerMjhEayGPUZeMDiu+WMs/sYuL5JinT866nx3m7L5J55/Cg814v/bzzKzFM
+VMfYaXc+H7CPmeamlPQYPY+CgkMLUPdGIw8vEGo1KGwBeI2ENA4helmnuytoG8cazSDYBU5r24X75oJ4
+Qa01vU6YxgafhVQedye1gRnnt4RSO9ui2wenbl59EvyXfkW28j+myHDTsF4UB8mUshebJDGC8gGxJnbA
+YvZqty0xXApsFLfIDUuLPOPQfHHZRzCuQecSdBrGCmbXEt7S1FeGsKXeV0afEuxm5cwJ2ilWb9J36ZAV
+xOKaNwYEUiAQJYZgMDuRemiQJ9jkGfm/VEb1r/8X7gkOZ/s98dFsvudAOFdvxI89ElYkvIdFoN7VuKb/
+1Wq0guHY6qHD+tC4/Eb1YsrLjJhKbH1uUtgF3KBIfgP8cAzdSwgAAA==
 `,
 	},
 
@@ -12175,15 +12198,103 @@ nJiAJC66TD22UcV0/i//JwAA//9HBa+xSk4BAA==
 `,
 	},
 
+	"/check.html": {
+		local:   "ui/check.html",
+		size:    6492,
+		modtime: 1500000000,
+		compressed: `
+H4sIAAAAAAAC/61YbW/juBH+7l/B6oK13EZSksu2QGKrWOzdAofrdg+9bfthsUhoibJ4kUQdRfkFOf/3
+zpDUi2XFzqEXILZFzjwznHfK87zJkhcxL1bV3cQjhBQ0Z3cE/woRswn+kKwStYxgOZCMRorJYH0d6O0B
+S5Sy6GnAM+0zlYzJKnh+Jr9WxMEHh+z3gWZrl3mMi1MNo3jORK0A/W2lFxKaZUsaPd2R571eEEW2e+AJ
+UExTWhG3BZ4Rt8zq6Ilc+M0JfdTZ1zoQh8YxKFk5s+nwFCmvlJC7P+YcgUU7e54vX/+w83jgVVDiQutD
+7hZ9FrO232uCjFYK9/V3j8jqjGRIxxOL5aORcHWe3oRa3VZMu4Wr8yqHc5EIcKuFo9hWeXmtWOyEouiz
+gPoPlm8eaJ5wMg8QezIvWwEgnv26bZgqRRUjV52okhaNpCWNV4zoT6+qowjtEX76EbCBqMVjWcVGQa/P
+gm6oLMBCTvhf8+O1yN+eV5dFooip3Dnhv4unQmyKMexzKDEtVhAr4XvJFY9oNsQoYu3TzrCFUI2mrKDL
+jCHBa5T8jlea3ErowDtsi1sCDF+zU7i8SIQT/mQIzyOKZcXkmiouispPMlqW4IpT+K3bPlji8zLAb9lJ
+ncEMT074M5KdR6Mm514bAZoQ/95FGApg5hU4Zrnr5Q7F/1qlQgLwUJYfiTxnhYKtuwFPt3Oo7nikzIMS
+czG9xYNCHH+G+pXxAk4MS5N5zNfNSWIvydiW5Evv2iE8hqy3pE6LKTE4yQVIh9JyWJV6BUcrA8CtDawA
+hPcSDmVlufIArdpwFaUWzqbZo4n/RygPjzb/HyGrH63/HyEPH1szP4I0p5VSqV3GFk7K+CqF+nxzW27v
+Sc4Lb8NjlcICPi+FjJn0pKG5LrekEhmPySblinVYiivEAiXRCI2K+BvUzMvWKz3VmzJoPWl2oFOUNbqK
+eD36drV1k5EczgMw27EH9eK8PK7GRFfczj+RqIsX2gD2wTpTbjWzCo4RXZJEihyRKl5EjLgJl6N9Zdaz
+hVNhlyR0JYgSHa9uTaNkY8H5SZvEBKVVULc0JCola7Nt5WXoOlJ6N07YNMDOoAAomUZoiu2Y2ZzwM5zD
+zDoEezTW0FKKuI7AprTYWWNVZMeUr5Xsld6eetC5ZRJTRU1HvQ1/gmchc4oG+A7WbZYpLLStHvpBf3pV
+bp03VymjcVc25kp2D5Yg/MiU5NE8gJ9He/+hWc3Gt9pON7bZ9Zmx3Y+84Hmdv7BJty9vfpZgr8MteLKH
+wvX2uHO1FPGuI+vqDGbUJbnIdak5snfPVAfSjX8oeOsi9yN7POKuoLbBwhrt1N+Z9bF61co4yLbjoYBm
+TLBSbHU6FmI3TstoetuRkK626+owsHGs478dvlQ8TtBoc5qmOcFpqtaap8lyEzXnqEz4vEg1r9arxlDQ
+2eST7kUE3e/lOhN0gW4s4BBd5xfO9V+vHGK6wMK5uXWgqgJSeCiki8VjY8OeiUj4gQ46yP6uk75PMTaq
+8ylONh70eeGMh/topv+LQ3wF5ANU97H0GlirG0qwbUvg9RLdF/ojQf/PzWuorRVjvdEC2bBAQ2+FBlsr
+HPg+/di1DSzuEjrvmsnLHhsKGrIVovCGrAnl2ezwGCccMmoUHP3AJBE0oFcapVPzaOB8SDTQMDG1daBh
+SSj+7VxKl3Dqk2AqhcOmIosfUog73UmhT5YVWbJMbF7JipT7/f9ppB8KhQJeCJsXxvoioF3LhF9xLbWK
+DSW3oMQpdBdv8+F3q/cPbOqftBFY/Aodseo/CEv/QO3QZIayUxSn1TvO8Mm8guJWKqJ2JTOzQvALXVOz
+Cql74SZ1EaFR3NmzBllT2bxoIAvt4tG567ffyJev9y2HGXOJ5ejfMPf7e3OvCwKSQigkQE0zAfEHzdIO
+KzC1KAG1OoZnqD4YnJr5Em4gFcwu4DIkzgVYGZIVrwl2lOkpIBl9AvlXVhwMLMTFHQ6LVnE/Y8VKpTC1
+Xt/DeojUhHvejDy35gQnua6l/8K/2lMsgHRG/rTQWdQ899nMqK51+MsC4NuNvQnAQ8olEvZoJuZz0ijQ
+F9pxXrjTb9oyOIVhFdzpNkLJlIhkpIJZw2KhArtOZ0bqkVa/C7spqhbb1s8+fOvyWNINoaTtdAjEKNyP
+yt5MafretCKmpyOYToaJ1Qwand8igHIIcBS4TSQYMHD6havAjzMfW6s7tTJm9wfEurmSHjFVSrpTvTyk
+Nc33iNYsD4n1SSogxizprGxUt+EF95LmDPyS6EvU7DBOMBbM5aodEd+8IYcrX8zJvg6j0WiCWvhlXaXu
+OJcZo3rKd/Gof8162qM2FtEm0pzcDMVKpmpZ9GP70Du8AKN8pCrFecqHVpTt3KLOskur7MCOME619HR7
+nr4UUNXR7hdAX1p1e4ZeXxI+MDKyoRCXw2wyOCBUCkjzP5s4uT9iwxJpw8IjN/DvulrhBZ5zRv5Orvy3
+5A5AYUuvgAAkME8I7Lbst31Td5YkW1+JD3zLYvd6hql4OYXPXW/xftxbqJ/OuAWJRVTjyxWYdBkUlu8z
+hk///BmCV6nyLgg2m42/+dYXchXcXF1d4WQ5vSTTUmQ7k3KdDHz2K6beQfDzJdw73amxOTCYH/4v8OVO
+yXR2mg3fmaAUmKvOSYBCJJ4YEn9zdfW3ZZK8it68IkGua//ttG8bzF+MJein71OexS5iNLULvvEfpkzd
+JQ/v3b03SzRjUhH92b3I0xDvdVfD63ci6iL2CflBQSTv9NyEnU9AScSXzKAItHaOV3WCO1D38GV+it3b
+b16R9Mf0MpxTAqNVYi4JfsxZhDdIKeDcDyVs8C2+3HfCNxmV8p68gy6g1YGJnob60v8/bzzWTlwZAAA=
+`,
+	},
+
 	"/index.html": {
 		local:   "ui/index.html",
-		size:    284,
+		size:    9249,
 		modtime: 1500000000,
 		compressed: `
-H4sIAAAAAAAC/6yPwWrEIBCG7z7FkAZUKJruNa6XnvoUi+gs2qZJ0FnZEnz3suux116/Gb6P38STfY/o
-v4rR8WQZMyFVSOE8+CcdrNEh1ceh+Jx2AvrZ8TwQ3kl/uuo6HSwbxfW2ekrbKuTBAABGwV+6hUu1bC4I
-fhwwqpDQu0IqbzfCy57xmu7Qmr70ZxXpe+FyZk9JQfpYCXN1y5/Af0QejvYKb9M0yZk1OTOj+yb7GwAA
-//+9lKZ/HAEAAA==
+H4sIAAAAAAAC/61aX3PbuBF/96dA2DQkJxIlO717kC3dXH1t53rXZKa5m3twPRmIhCScKZIBQNkan797
+dxckBVKkHDfNg0UC+w+Lxe4Py4zH47OlzBKZrfXsbMwYy/hWzBj+y/JEnOGDEjovVQzDEyV4bISa7M4n
+ND0G/qvNxeI6LTWMX03g+ezsKpE7JpO5F9thb3E1gSGcQdqNiO90TbrK1ZbFKdd67uHzWGapzATbLsfv
+PCuE6McrmaIolme6XG6lmXtKmFJlbMVTLbwFmXols6I0zOwLMfe04CreeC3pcZ4ZlafMfRnrLduq8YVH
+i597+NdjRcpjscnTRKi593dSzpZ7IgFlVpsWqYjNixVow01tMcnJCyPzjO14WsK0t/g+TdlHJAI32blB
+4qm3+PDTs1Tn3uI3rjLY5mdJL7zFtZJGxjx9lvadt/g1u8vy++xZ0iy/8xbvc8O61l5NrBe/0qcYjs+5
+9D3Q6Ge0bzkQVsqNeDDjbWlE0orEOC8zgzFNxIuzqwka1op7InTCXpt9KqqwRKmTWOvKWrOJdK4MXwLB
+I4tLBW8zVuQyg4i7ZE9doojreDbjK4xHZAB3iMzMmM/+c/HNXy/8PhZYdsNzxHJNLLAatJGMjZUsjGvt
+73zH7SgY/TpYlVmMLgzCR1K144oVgrIIm7OsTNPLZnwnxT0MPjY7g0ZRgvFxy/xRM6HETigNWYYOtB1/
+urT7Mpkwe/4ZzxISAesTTOX3muUrerY+Z9aRPI5zRfaY3M6WSsGayZxLGJGaSV2LhqxWFKkUCUMT9szI
+rSAuKwxolUhznoikWRYy7GFdXVfU85TWGBC8Dvw/tTKYH162KDF8iRJZohUk48C/cRLRrR9GEMVBGJn8
+5/xeqGuuRdARQhmlX4hNNo2UjnLYgiHleKAG2MwyT/ad1Vlf0Ux3ibRNSE6zlRoDnojWwvSZpJH48amz
+xg3kGZyYVkGB/15HUJE2AWoYHTZDjlCnsyW1jIQbzqp9QYoIB1wLDmGrJa4HbFalcBTWlVHfIGuEj7f9
+VHLFAnRllIpsbTbszRvI6QpiMrCcMNXZ0wgcIx4+rIgtZFdsGrL2Gsi8xjQ6KG3bn5iAMdJtY2I+x4N2
+56N60tsMf71wZ2VW6itHmbtWmg1xunr63xWjwx29zSagcPx9uez2rlVxYfL1OhVBxRn2bG091aPPRurb
+OTvvqmqeXIkYvJSrD4mVj9iyJ3zvxF7DKm4wixHHqM6i8Asx4992DIVjDZYCp6RzAz9XJKTyIAy8fdvr
+MWB5oFPCqzOCXDfytnNUato90S6PaI+I0XMPYMS+T6utAgTqAlpiVRLYd+yczdj4vEe7ExoPbPFiuWMU
+3Cv3VJBUwqaX/Rtq0xyUCKiJlJrcSag3d0IUVF9SqQ3WL5vzqhrVTnoWDZ1K0MfZ8MPyd2CKcBvovOjQ
+hlfYTpFZJ8LQh6+swkqTRUqQp23pcgt/7QMspRGhLMwpGUCJsAqu3pNhpVeugepR4bRFVWcyOHkAOOA3
+/KKjc1x/DqgHRCqxzXfiGtFc4AOCYQiE3OrUw095fYxC5p7P3rLmrMGzTwWRJ4kV2Ykln6RDPKGqAS2E
+Hf1qlVWeABwGMYC6KBNUyQ2HLVMtqgZDVFIJkAwAENJnr16gCgkD//ERoiORIubaRCoHUPupUGIlH9jT
+0+RTRR1tzDbtt/xLBRGxlTOyKKljPcQ/rhvucQCgHOAGLuBMQ8mAXWiunlSzlUzTBD3lrJZS/WP/UTmC
+XGz4xNQlBWvJ18Y+iDkR/s+GPq6oin58dHbByT6VlJqB/fEH890NI48Hxy5fljJNNHhYoet7EDNWChxc
+y53IEAcDWA5wQCM+5UC2yTHPZszd49AJSMAuyt2iQgg1spI6O0UCEITRZESvbay35MlaYKl7nM7Yja/L
+OBZaY5n78JN/O2LnOHpvb7Q4Wl1uceodMQi45CRc7XGyuqL6t089StAMq+2G7LBY5RYde+MnPFvDGQIZ
+9ZUYK6wrI5XZHeHJ0+eCRH+HHpnjORdZDJv3679/vM63RZ6BE8hbIR76N3CBHKCxBspk6AaBQWUSDCgn
+yji9G6MCfwP2wGLQ5irSrESCm8eYnR2EqkZIO6h9SpZou2+bRox2vYeG3FoROY7uIyUkU4k7GNhLidin
+TQkjn4bI8V4HWrcF8NjQa0ZG/fUF04MVzOO77okGFx1qgU/HaNwEHjs0D9zz6cAVKzfeYIwlXyIboyLA
+A+GcBzgIzTl4OorgOoAHksnJ1dHVpYojn4EqDARd8KzujtjjQ3+dZW/T8YXXRMsRAPCNNCnh1e9jPJWp
+APYEG2u4usaYiJeQbxQu+DAW59stpiWotLMOeT01w2zYUtqcBf9KNk0lDheBMXGPY6niVGCrRi6Ya9Pz
+TgM/H+P/F7kNPHb35R57n2MrtkyNxjoZC8cHINp8ypdaqJ1IPnHzpS5Ic3BBXq3+I65naNlVyaO4tNI6
+1yZMPbX0Qo3/4nXy0LEP7sfn06klayLd+gUXRk8309sqU9nX89swHB35e9RjysJvp7g6L4SjE3aTW72G
+lV6DTqagJM34OncC7bjeIlznRtsuEraTRMoLDZFud+5QaRu5kJbvoNCyf+QsKRWn7mUgonU0Y9755mL7
+TnuHamulOMX2YF4XFOHBxEr6Lw7YeMsfgunIPkONgq0JfsCLPER9ELIxo5eCA551JIZswmCnpt0SATWO
+2Rrh+52cWatdzNm7b6dHnQbkfFuZtErzXDUMk4oefLzxB8+fI/7bLxDe0P+5kj4hNtCx9U8FO0liDnfF
+pf2j/VaCvhfUXckWxGK8BlQSENgSpF422GvDDeOAnXyD0OrQc9wLcxD9uZQKQ8OC/kPLlZt48xLEdQJw
+2XI/1NBj1Kw7BsJ9l+LXAcLiGnIc8EGIGBmfAGr33dB7+Ki8E1/nEL9ABGIJVwS8Xw7Xekxv/fAdZ6pN
+/k2aTWDxbsvlnStrC4o7tb9zLQC7kjJtdXSfutEV55CZNYTXslTa0F2JVGoIGpMf7k2dAKllD1wTccFN
+235uG/fdZR/a+lqYXyAlQPQORkCb4fAdoB0ldI3sXu9H7OKb6aALeproEaj37dc+C6Gc6+bZ8SUYqeNU
+xndYSG3HsBblNEXcKyXkQUVO/kGsOBRd1+TmShrUIUd9L9uLC9v3Z7wmjZhti0c8k1AWRPCoY5Wn6S95
+Metf3GqlsTUembx4qqtLeOSN7sLc7sdo8NsENTPmrG06Dh7djA+9DwgP/O2GR6sDMmev3PdnAt+RTaIv
+Twnu9G2dVN2+8Pa66OV9iz7PHfYcJH3WzHYTgLlX91d1X85q/9/LDDRGf8Mw/Ejf4N0NwE6KUYJv62Sw
+Uvm2+oRFiRY2GHStN/Z7F4FDSFb3GwllA79sW3gSK5EAuwQXM5O70j+X9DVsI7YhfXcriwS7/MjEVysR
+w92GCgfXDPuODG6pUMwU4Bp9WXeoCqFknuDVOd27spVYc5VAVkOlrIAABvGtsrjhOwBJJPOe71sRjKuj
+7sAjKzP5GdJYWoKA11H9fxnogEeWzAN0CbgZ4BM4m+71t8ctUyJtt0crtp42fOV1SHHinjmbE/juf5Ag
+kZOBq3wtHOHExG7fxIr1u21zO4wYmVT9LCFWMig9PjlrKH01+RhBQq1uxP758cP7CuAJOvlHjdZwoDzW
+fWvYVwCnOwtrm6Y1u4eiiHjJbjvsgdOyMj/it2zsWQ1VjlOwg/bnVMmpE1n1XTGJCB23QXwPNDh0A0IH
+05/wxsii4Muzly/t/9KMrQwYtMC6fgQo1RL1pt4+hnOH/gyXfDWxX/sXZ/8FrFIbjSEkAAA=
 `,
 	},
 
@@ -0,0 +1,156 @@
+package reacter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/go-stockutil/sliceutil"
+	"github.com/ghetzel/go-stockutil/typeutil"
+)
+
+var DefaultStreamBufferSize = 64
+var DefaultStreamKeepalive = 15 * time.Second
+
+// An EventFilter selects which events a subscriber receives.  Empty fields match everything.
+type EventFilter struct {
+	Nodes  []string `json:"nodes,omitempty"`
+	Checks []string `json:"checks,omitempty"`
+	States []string `json:"states,omitempty"`
+}
+
+// Builds a filter from the "node", "check", and "state" query string parameters of the given
+// request.  Each parameter may be repeated, or contain a comma-separated list of values.
+func EventFilterFromRequest(req *http.Request) EventFilter {
+	query := req.URL.Query()
+	values := func(key string) []string {
+		out := make([]string, 0)
+
+		for _, value := range query[key] {
+			for _, v := range strings.Split(value, `,`) {
+				if v = strings.TrimSpace(v); v != `` {
+					out = append(out, v)
+				}
+			}
+		}
+
+		return out
+	}
+
+	return EventFilter{
+		Nodes:  values(`node`),
+		Checks: values(`check`),
+		States: values(`state`),
+	}
+}
+
+// Whether the given event passes the filter.  Heartbeats only pass filters that don't specify
+// checks or states.
+func (self EventFilter) Match(event CheckEvent) bool {
+	if event.Heartbeat != nil {
+		if len(self.Checks) > 0 || len(self.States) > 0 {
+			return false
+		}
+
+		return len(self.Nodes) == 0 || sliceutil.ContainsString(self.Nodes, event.Heartbeat.NodeName)
+	} else if event.Check == nil {
+		return false
+	}
+
+	if len(self.Nodes) > 0 && !sliceutil.ContainsString(self.Nodes, event.Check.NodeName) {
+		return false
+	}
+
+	if len(self.Checks) > 0 && !sliceutil.ContainsString(self.Checks, event.Check.Name) {
+		return false
+	}
+
+	if len(self.States) > 0 {
+		for _, state := range self.States {
+			switch strings.ToLower(state) {
+			case event.Check.StateString(), event.Check.State.String(), typeutil.String(int(event.Check.State)):
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// Returns a channel that receives every processed event matching the given filter, and a function
+// that must be called to unsubscribe.  Slow subscribers miss events rather than blocking event
+// processing.
+func (self *Reacter) Subscribe(filter EventFilter) (<-chan CheckEvent, func()) {
+	events := make(chan CheckEvent, DefaultStreamBufferSize)
+
+	self.subscribers.Store(events, filter)
+
+	return events, func() {
+		self.subscribers.Delete(events)
+	}
+}
+
+func (self *Reacter) publish(event CheckEvent) {
+	self.subscribers.Range(func(key interface{}, value interface{}) bool {
+		if value.(EventFilter).Match(event) {
+			select {
+			case key.(chan CheckEvent) <- event:
+			default:
+				log.Debugf("Event stream subscriber is not keeping up; dropping event")
+			}
+		}
+
+		return true
+	})
+}
+
+// Streams events to the client as Server-Sent Events until it disconnects.
+func (self *Server) streamEvents(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		http.Error(w, `Streaming is not supported`, http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := self.reacter.Subscribe(EventFilterFromRequest(req))
+	defer unsubscribe()
+
+	keepalive := time.NewTicker(DefaultStreamKeepalive)
+	defer keepalive.Stop()
+
+	w.Header().Set(`Content-Type`, `text/event-stream`)
+	w.Header().Set(`Cache-Control`, `no-cache`)
+	w.Header().Set(`Connection`, `keep-alive`)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case event := <-events:
+			name := `check`
+
+			if event.Heartbeat != nil {
+				name = `heartbeat`
+			}
+
+			if data, err := json.Marshal(self.reacter.Redactor.Event(event)); err == nil {
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+			} else {
+				log.Warningf("Failed to serialize streamed event: %v", err)
+				continue
+			}
+		case <-keepalive.C:
+			fmt.Fprintf(w, ": keepalive\n\n")
+		case <-req.Context().Done():
+			return
+		}
+
+		flusher.Flush()
+	}
+}
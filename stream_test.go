@@ -0,0 +1,69 @@
+package reacter
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestEventFilterMatch(t *testing.T) {
+	check := NewCheck()
+	check.NodeName = `db1`
+	check.Name = `replication_lag`
+	check.State = CriticalState
+
+	event := CheckEvent{Check: check}
+	heartbeat := CheckEvent{Heartbeat: &Heartbeat{NodeName: `db1`}}
+
+	for _, tt := range []struct {
+		name    string
+		filter  EventFilter
+		event   CheckEvent
+		matches bool
+	}{
+		{`empty filter`, EventFilter{}, event, true},
+		{`node`, EventFilter{Nodes: []string{`db2`, `db1`}}, event, true},
+		{`other node`, EventFilter{Nodes: []string{`db2`}}, event, false},
+		{`check`, EventFilter{Checks: []string{`replication_lag`}}, event, true},
+		{`other check`, EventFilter{Checks: []string{`disk`}}, event, false},
+		{`state name`, EventFilter{States: []string{`CRITICAL`}}, event, true},
+		{`state number`, EventFilter{States: []string{`2`}}, event, true},
+		{`other states`, EventFilter{States: []string{`ok`, `warning`, `1`}}, event, false},
+		{`every field`, EventFilter{Nodes: []string{`db1`}, Checks: []string{`replication_lag`}, States: []string{`critical`}}, event, true},
+		{`one field fails`, EventFilter{Nodes: []string{`db1`}, Checks: []string{`disk`}, States: []string{`critical`}}, event, false},
+		{`heartbeat with empty filter`, EventFilter{}, heartbeat, true},
+		{`heartbeat node`, EventFilter{Nodes: []string{`db1`}}, heartbeat, true},
+		{`heartbeat other node`, EventFilter{Nodes: []string{`db2`}}, heartbeat, false},
+		{`heartbeat with checks`, EventFilter{Checks: []string{`replication_lag`}}, heartbeat, false},
+		{`heartbeat with states`, EventFilter{States: []string{`critical`}}, heartbeat, false},
+		{`no check`, EventFilter{}, CheckEvent{}, false},
+	} {
+		if matches := tt.filter.Match(tt.event); matches != tt.matches {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.matches, matches)
+		}
+	}
+
+	//  "okay" (the check's state string) and "ok" (the state's name) are both accepted
+	check.State = SuccessState
+
+	for _, state := range []string{`ok`, `okay`, `0`} {
+		if !(EventFilter{States: []string{state}}).Match(event) {
+			t.Errorf("expected state %q to match an ok check", state)
+		}
+	}
+}
+
+func TestEventFilterFromRequest(t *testing.T) {
+	for _, tt := range []struct {
+		query    string
+		expected EventFilter
+	}{
+		{``, EventFilter{Nodes: []string{}, Checks: []string{}, States: []string{}}},
+		{`?node=db1&node=db2`, EventFilter{Nodes: []string{`db1`, `db2`}, Checks: []string{}, States: []string{}}},
+		{`?check=disk,%20load,&state=critical`, EventFilter{Nodes: []string{}, Checks: []string{`disk`, `load`}, States: []string{`critical`}}},
+	} {
+		if filter := EventFilterFromRequest(httptest.NewRequest(`GET`, `/`+tt.query, nil)); !reflect.DeepEqual(filter, tt.expected) {
+			t.Errorf("%q: expected %+v, got %+v", tt.query, tt.expected, filter)
+		}
+	}
+}
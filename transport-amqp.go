@@ -0,0 +1,98 @@
+package reacter
+
+import (
+	"net/url"
+
+	"github.com/ghetzel/go-stockutil/typeutil"
+)
+
+func init() {
+	for _, scheme := range []string{`amqp`, `amqps`} {
+		RegisterSink(scheme, func(uri *url.URL) (Sink, error) {
+			return NewPublisherFromURL(uri)
+		})
+
+		RegisterSource(scheme, func(uri *url.URL) (Source, error) {
+			return NewConsumerFromURL(uri)
+		})
+	}
+}
+
+// Creates and connects a publisher from a URI whose query string may specify the "exchange" and
+// "exchange_type" (e.g.: "amqp://rabbitmq/?exchange=checks".)
+func NewPublisherFromURL(uri *url.URL) (*Publisher, error) {
+	query := uri.Query()
+
+	if publisher, err := NewPublisher(brokerURI(uri)); err == nil {
+		if v := query.Get(`exchange`); v != `` {
+			publisher.Exchange = v
+		}
+
+		if v := query.Get(`exchange_type`); v != `` {
+			publisher.ExchangeType = v
+		}
+
+		if err := publisher.Connect(); err == nil {
+			return publisher, nil
+		} else {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+}
+
+// Creates and connects a consumer from a URI whose query string may specify any of "queue",
+// "durable", "autodelete", "exclusive", "prefetch", "exchange", "exchange_type", "binding_key"
+// (which may be repeated), and "dead_letter_exchange" (e.g.:
+// "amqp://rabbitmq/?queue=db-team&durable=true&exchange=checks&binding_key=checks.db-*.%23".)
+func NewConsumerFromURL(uri *url.URL) (*Consumer, error) {
+	query := uri.Query()
+
+	if consumer, err := NewConsumer(brokerURI(uri)); err == nil {
+		if v := query.Get(`queue`); v != `` {
+			consumer.QueueName = v
+		}
+
+		if v := query.Get(`exchange_type`); v != `` {
+			consumer.ExchangeType = v
+		}
+
+		if v := query.Get(`prefetch`); v != `` {
+			consumer.Prefetch = int(typeutil.Int(v))
+		}
+
+		consumer.Durable = typeutil.Bool(query.Get(`durable`))
+		consumer.Autodelete = typeutil.Bool(query.Get(`autodelete`))
+		consumer.Exclusive = typeutil.Bool(query.Get(`exclusive`))
+		consumer.Exchange = query.Get(`exchange`)
+		consumer.BindingKeys = query[`binding_key`]
+		consumer.DeadLetterExchange = query.Get(`dead_letter_exchange`)
+
+		if err := consumer.Connect(); err == nil {
+			return consumer, nil
+		} else {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+}
+
+// Returns the given URI without its query string (which holds options for reacter, not the broker.)
+func brokerURI(uri *url.URL) string {
+	u := *uri
+	u.RawQuery = ``
+
+	return u.String()
+}
+
+// Publishes the event (see Publish); this makes a Publisher a Sink.
+func (self *Publisher) Write(event CheckEvent) error {
+	return self.Publish(event)
+}
+
+// Processes messages until the consumer is closed (see Process); this makes a Consumer a Source.
+func (self *Consumer) Read(fn func(data []byte) error) error {
+	return self.Process(fn)
+}
@@ -0,0 +1,763 @@
+package reacter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/go-stockutil/timeutil"
+	"github.com/ghetzel/go-stockutil/typeutil"
+)
+
+var DefaultHTTPSinkTimeout = 10 * time.Second
+var DefaultHTTPSinkBatchSize = 100
+var DefaultHTTPSinkFlushInterval = time.Second
+var DefaultHTTPSinkRetryInterval = time.Second
+var DefaultHTTPSinkMaxRetryInterval = time.Minute
+var DefaultHTTPSinkMaxBufferSize int64 = 64 * 1024 * 1024
+
+// The largest request body (after decompression) accepted by the event ingest endpoints.
+var MaxIngestSize int64 = 32 * 1024 * 1024
+
+func init() {
+	for _, scheme := range []string{`http`, `https`} {
+		RegisterSink(scheme, func(uri *url.URL) (Sink, error) {
+			return NewHTTPSinkFromURL(uri)
+		})
+	}
+
+	RegisterSource(`http`, func(uri *url.URL) (Source, error) {
+		return NewHTTPSource(uri.Host, uri.Path)
+	})
+}
+
+// An HTTPSink POSTs events to a URL in batches, either as a JSON array or as newline-delimited
+// JSON.  Batches are buffered (in memory, or on disk if a BufferDir is given) and sent in order by
+// a separate goroutine, so a slow or unreachable endpoint never holds up Write.  Batches that fail
+// because of a network error or a 5xx, 408, or 429 response are retried with exponential backoff;
+// batches the endpoint rejects with any other 4xx response are dropped.  If the buffer grows
+// beyond MaxBufferSize bytes, the oldest batches are dropped.
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+	Header http.Header
+	// Either "json" (a JSON array of events) or "ndjson" (one JSON-encoded event per line.)
+	Format string
+	// Compress request bodies with gzip.
+	Gzip bool
+	// Batches are sent once they hold BatchSize events, or every FlushInterval, whichever is first.
+	BatchSize        int
+	FlushInterval    time.Duration
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	// If set, undelivered batches are kept in this directory, so they survive restarts.
+	BufferDir     string
+	MaxBufferSize int64
+	events        chan []byte
+	pending       chan struct{}
+	done          chan struct{}
+	stopped       chan struct{}
+	buffer        *sinkBuffer
+	startOnce     sync.Once
+	closeOnce     sync.Once
+	startErr      error
+}
+
+func NewHTTPSink(uri string) (*HTTPSink, error) {
+	if u, err := url.Parse(uri); err == nil {
+		sink := &HTTPSink{
+			Client: &http.Client{
+				Timeout: DefaultHTTPSinkTimeout,
+			},
+			Header:           make(http.Header),
+			Format:           `json`,
+			BatchSize:        DefaultHTTPSinkBatchSize,
+			FlushInterval:    DefaultHTTPSinkFlushInterval,
+			RetryInterval:    DefaultHTTPSinkRetryInterval,
+			MaxRetryInterval: DefaultHTTPSinkMaxRetryInterval,
+			MaxBufferSize:    DefaultHTTPSinkMaxBufferSize,
+			done:             make(chan struct{}),
+			stopped:          make(chan struct{}),
+		}
+
+		//  credentials given in the URL are sent as basic authentication
+		if u.User != nil {
+			password, _ := u.User.Password()
+
+			req := &http.Request{
+				Header: sink.Header,
+			}
+
+			req.SetBasicAuth(u.User.Username(), password)
+			u.User = nil
+		}
+
+		sink.URL = u.String()
+
+		return sink, nil
+	} else {
+		return nil, err
+	}
+}
+
+// Creates a sink from a URI whose query string may specify any of "format", "gzip", "batch_size",
+// "flush_interval", "buffer_dir", "max_buffer_size" (in bytes), and "token" (sent as a bearer
+// token, and which may be a secret reference like "${env:TOKEN}".)  These options are removed from
+// the URL that events are sent to.
+func NewHTTPSinkFromURL(uri *url.URL) (*HTTPSink, error) {
+	u := *uri
+	query := u.Query()
+	options := make(url.Values)
+
+	for _, key := range []string{`format`, `gzip`, `batch_size`, `flush_interval`, `buffer_dir`, `max_buffer_size`, `token`} {
+		if _, ok := query[key]; ok {
+			options.Set(key, query.Get(key))
+			query.Del(key)
+		}
+	}
+
+	u.RawQuery = query.Encode()
+
+	if sink, err := NewHTTPSink(u.String()); err == nil {
+		if v := options.Get(`format`); v != `` {
+			sink.Format = v
+		}
+
+		if v := options.Get(`batch_size`); v != `` {
+			sink.BatchSize = int(typeutil.Int(v))
+		}
+
+		if v := options.Get(`flush_interval`); v != `` {
+			if d, err := timeutil.ParseDuration(v); err == nil {
+				sink.FlushInterval = d
+			} else {
+				return nil, fmt.Errorf("flush_interval: %v", err)
+			}
+		}
+
+		if v := options.Get(`max_buffer_size`); v != `` {
+			sink.MaxBufferSize = typeutil.Int(v)
+		}
+
+		if v := options.Get(`token`); v != `` {
+			if token, err := ResolveValue(v); err == nil {
+				sink.Header.Set(`Authorization`, `Bearer `+token)
+			} else {
+				return nil, fmt.Errorf("token: %v", err)
+			}
+		}
+
+		sink.Gzip = typeutil.Bool(options.Get(`gzip`))
+		sink.BufferDir = options.Get(`buffer_dir`)
+
+		return sink, nil
+	} else {
+		return nil, err
+	}
+}
+
+// Adds the event to the current batch.  Events are delivered in the background; delivery failures
+// are logged, not returned.
+func (self *HTTPSink) Write(event CheckEvent) error {
+	if err := self.start(); err != nil {
+		return err
+	}
+
+	if data, err := json.Marshal(event); err == nil {
+		select {
+		case self.events <- data:
+			return nil
+		case <-self.done:
+			return fmt.Errorf("Sink is closed")
+		}
+	} else {
+		return err
+	}
+}
+
+// Sends any events that haven't been sent yet (buffering them if they can't be), and stops.
+func (self *HTTPSink) Close() error {
+	self.closeOnce.Do(func() {
+		close(self.done)
+	})
+
+	//  make sure the background goroutine has either never started or has finished
+	self.startOnce.Do(func() {
+		close(self.stopped)
+	})
+
+	<-self.stopped
+	return nil
+}
+
+func (self *HTTPSink) start() error {
+	self.startOnce.Do(func() {
+		switch self.Format {
+		case `json`, `ndjson`:
+		default:
+			self.startErr = fmt.Errorf("Unsupported format %q (expected 'json' or 'ndjson')", self.Format)
+			close(self.stopped)
+			return
+		}
+
+		if self.BatchSize <= 0 {
+			self.BatchSize = 1
+		}
+
+		if self.FlushInterval <= 0 {
+			self.FlushInterval = DefaultHTTPSinkFlushInterval
+		}
+
+		if buffer, err := newSinkBuffer(self.BufferDir, self.MaxBufferSize); err == nil {
+			self.buffer = buffer
+		} else {
+			self.startErr = err
+			close(self.stopped)
+			return
+		}
+
+		self.events = make(chan []byte, self.BatchSize)
+		self.pending = make(chan struct{}, 1)
+		go self.run()
+	})
+
+	return self.startErr
+}
+
+// collects events into batches and hands them to the sender through the buffer
+func (self *HTTPSink) run() {
+	sent := make(chan struct{})
+
+	go self.sendBuffered(sent)
+
+	ticker := time.NewTicker(self.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([][]byte, 0, self.BatchSize)
+
+	//  every batch goes through the buffer, so batches are always delivered in order
+	flush := func() {
+		if len(batch) > 0 {
+			self.buffer.Push(batch)
+			batch = make([][]byte, 0, self.BatchSize)
+
+			select {
+			case self.pending <- struct{}{}:
+			default:
+			}
+		}
+	}
+
+	for {
+		select {
+		case data := <-self.events:
+			if batch = append(batch, data); len(batch) >= self.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-self.done:
+			for len(self.events) > 0 {
+				batch = append(batch, <-self.events)
+			}
+
+			flush()
+			close(self.pending)
+
+			<-sent
+			close(self.stopped)
+			return
+		}
+	}
+}
+
+// sends buffered batches in order until the sink is closed, then makes one last attempt to send
+// whatever is left
+func (self *HTTPSink) sendBuffered(sent chan struct{}) {
+	defer close(sent)
+
+	interval := self.RetryInterval
+
+	//  batches left over from a previous process are sent right away
+	retry := time.After(0)
+
+	for {
+		closing := false
+
+		select {
+		case _, ok := <-self.pending:
+			if closing = !ok; !closing && retry != nil {
+				//  new batches wait behind the one being retried
+				continue
+			}
+		case <-retry:
+		}
+
+		retry = nil
+
+		if err := self.sendAll(); err == nil {
+			interval = self.RetryInterval
+		} else if closing {
+			log.Warningf("Failed to send %d batch(es) of events to %s: %v", self.buffer.Len(), self.URL, err)
+		} else {
+			log.Warningf("Failed to send events to %s, retrying in %v: %v", self.URL, interval, err)
+			retry = time.After(interval)
+
+			if interval *= 2; interval > self.MaxRetryInterval {
+				interval = self.MaxRetryInterval
+			}
+		}
+
+		if closing {
+			return
+		}
+	}
+}
+
+// sends buffered batches until either the buffer is empty or a batch fails in a way that is worth
+// retrying
+func (self *HTTPSink) sendAll() error {
+	for {
+		batch, events, err := self.buffer.Peek()
+
+		if batch == nil {
+			return nil
+		} else if err != nil {
+			log.Errorf("Failed to read buffered events, dropping them: %v", err)
+		} else if err := self.send(events); err != nil {
+			if _, ok := err.(PermanentError); ok {
+				log.Errorf("Dropping %d event(s) rejected by %s: %v", len(events), self.URL, err)
+			} else {
+				return err
+			}
+		}
+
+		self.buffer.Remove(batch)
+	}
+}
+
+func (self *HTTPSink) send(events [][]byte) error {
+	var body bytes.Buffer
+	var writer io.Writer = &body
+	var gz *gzip.Writer
+	var contentType string
+
+	if self.Gzip {
+		gz = gzip.NewWriter(&body)
+		writer = gz
+	}
+
+	switch self.Format {
+	case `ndjson`:
+		contentType = `application/x-ndjson`
+		writer.Write(bytes.Join(events, []byte("\n")))
+		writer.Write([]byte("\n"))
+	default:
+		contentType = `application/json`
+		writer.Write([]byte(`[`))
+		writer.Write(bytes.Join(events, []byte(`,`)))
+		writer.Write([]byte(`]`))
+	}
+
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+
+	if req, err := http.NewRequest(`POST`, self.URL, &body); err == nil {
+		for k, v := range self.Header {
+			req.Header[k] = v
+		}
+
+		req.Header.Set(`Content-Type`, contentType)
+
+		if self.Gzip {
+			req.Header.Set(`Content-Encoding`, `gzip`)
+		}
+
+		if res, err := self.Client.Do(req); err == nil {
+			defer res.Body.Close()
+
+			if res.StatusCode >= 400 {
+				msg, _ := ioutil.ReadAll(res.Body)
+				err := fmt.Errorf("%s responded with %s: %s", self.URL, res.Status, bytes.TrimSpace(msg))
+
+				//  resending a batch the endpoint refuses to accept won't change its mind (unless it
+				//  was only too busy to accept it)
+				if res.StatusCode < 500 && res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests {
+					return PermanentError{err}
+				}
+
+				return err
+			}
+
+			return nil
+		} else {
+			return err
+		}
+	} else {
+		return err
+	}
+}
+
+// Holds batches of serialized events that haven't been delivered yet, oldest first.  Batches are
+// kept in memory, or as files (one event per line) in a directory if one is given.
+type sinkBuffer struct {
+	dir     string
+	maxSize int64
+	size    int64
+	last    int64
+	batches []*bufferedBatch
+	lock    sync.Mutex
+}
+
+type bufferedBatch struct {
+	path   string
+	events [][]byte
+	size   int64
+}
+
+func newSinkBuffer(dir string, maxSize int64) (*sinkBuffer, error) {
+	buffer := &sinkBuffer{
+		maxSize: maxSize,
+	}
+
+	if dir != `` {
+		buffer.dir = fileutil.MustExpandUser(dir)
+
+		if err := os.MkdirAll(buffer.dir, 0700); err != nil {
+			return nil, err
+		}
+
+		//  pick up where a previous process left off
+		if matches, err := filepath.Glob(filepath.Join(buffer.dir, `*.batch`)); err == nil {
+			sort.Strings(matches)
+
+			for _, path := range matches {
+				if stat, err := os.Stat(path); err == nil {
+					buffer.batches = append(buffer.batches, &bufferedBatch{
+						path: path,
+						size: stat.Size(),
+					})
+
+					buffer.size += stat.Size()
+				}
+			}
+
+			if len(matches) > 0 {
+				log.Noticef("Found %d undelivered batch(es) in %s", len(matches), buffer.dir)
+			}
+		} else {
+			return nil, err
+		}
+	}
+
+	return buffer, nil
+}
+
+func (self *sinkBuffer) Len() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	return len(self.batches)
+}
+
+// Adds a batch to the end of the buffer, dropping the oldest batches if the buffer is full.
+func (self *sinkBuffer) Push(events [][]byte) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	batch := &bufferedBatch{}
+
+	for _, event := range events {
+		batch.size += int64(len(event) + 1)
+	}
+
+	if self.dir != `` {
+		//  batch files are named so that they sort in the order they were written
+		seq := time.Now().UnixNano()
+
+		if seq <= self.last {
+			seq = self.last + 1
+		}
+
+		self.last = seq
+		batch.path = filepath.Join(self.dir, fmt.Sprintf("%020d.batch", seq))
+
+		if err := ioutil.WriteFile(batch.path, append(bytes.Join(events, []byte("\n")), '\n'), 0600); err != nil {
+			log.Errorf("Failed to buffer %d event(s) in %s, dropping them: %v", len(events), self.dir, err)
+			return
+		}
+	} else {
+		batch.events = events
+	}
+
+	self.batches = append(self.batches, batch)
+	self.size += batch.size
+
+	for self.maxSize > 0 && self.size > self.maxSize && len(self.batches) > 1 {
+		log.Errorf("Undelivered event buffer is full (%d bytes), dropping the oldest batch", self.maxSize)
+		self.remove(self.batches[0])
+	}
+}
+
+// Returns the oldest batch (or nil if the buffer is empty) and its events.
+func (self *sinkBuffer) Peek() (*bufferedBatch, [][]byte, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if len(self.batches) == 0 {
+		return nil, nil, nil
+	}
+
+	batch := self.batches[0]
+
+	if batch.path == `` {
+		return batch, batch.events, nil
+	}
+
+	if data, err := ioutil.ReadFile(batch.path); err == nil {
+		events := make([][]byte, 0)
+
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				events = append(events, line)
+			}
+		}
+
+		return batch, events, nil
+	} else {
+		return batch, nil, err
+	}
+}
+
+// Removes the given batch, if it is still buffered.  Batches may be dropped while they're being
+// sent (if the buffer fills up), so they're removed by identity rather than position.
+func (self *sinkBuffer) Remove(batch *bufferedBatch) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.remove(batch)
+}
+
+func (self *sinkBuffer) remove(batch *bufferedBatch) {
+	for i, buffered := range self.batches {
+		if buffered == batch {
+			self.batches = append(self.batches[:i], self.batches[i+1:]...)
+			self.size -= batch.size
+
+			if batch.path != `` {
+				if err := os.Remove(batch.path); err != nil && !os.IsNotExist(err) {
+					log.Warningf("Failed to remove buffered batch %s: %v", batch.path, err)
+				}
+			}
+
+			return
+		}
+	}
+}
+
+// Calls fn with each event in the body of the given request, which may contain a single event, a
+// JSON array of events, or one event per line, and may be gzip-compressed.  Returns the status to
+// respond with: 202 if every event was processed, 400 if any couldn't be parsed, or 500 if any
+// failed to be processed (in which case the client should retry), along with the error (if any.)
+func ReadEvents(req *http.Request, fn func(data []byte) error) (int, error) {
+	var body io.Reader = req.Body
+
+	if strings.EqualFold(req.Header.Get(`Content-Encoding`), `gzip`) {
+		if gz, err := gzip.NewReader(req.Body); err == nil {
+			defer gz.Close()
+			body = gz
+		} else {
+			return http.StatusBadRequest, err
+		}
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, MaxIngestSize+1))
+
+	if err != nil {
+		return http.StatusBadRequest, err
+	} else if int64(len(data)) > MaxIngestSize {
+		return http.StatusRequestEntityTooLarge, fmt.Errorf("Request body is larger than %d bytes", MaxIngestSize)
+	}
+
+	var events [][]byte
+
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		var raw []json.RawMessage
+
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return http.StatusBadRequest, err
+		}
+
+		for _, event := range raw {
+			events = append(events, event)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				events = append(events, append([]byte{}, line...))
+			}
+		}
+	}
+
+	status := http.StatusAccepted
+	var failure error
+
+	for _, event := range events {
+		if err := fn(event); err != nil {
+			if _, ok := err.(PermanentError); ok {
+				status = http.StatusBadRequest
+				failure = err
+			} else if status != http.StatusBadRequest {
+				status = http.StatusInternalServerError
+				failure = err
+			}
+		}
+	}
+
+	return status, failure
+}
+
+// An HTTPSource listens for events POSTed to the given path (see ReadEvents for the accepted
+// formats.)  If a Server is given, requests must present its credentials (its bearer token, basic
+// credentials, or a certificate signed by its client CA), and are served over TLS if it has a
+// certificate.  Without credentials, only loopback addresses are listened on.
+type HTTPSource struct {
+	Address  string
+	Path     string
+	Server   *Server
+	listener net.Listener
+	closed   bool
+	lock     sync.Mutex
+}
+
+// Listens on the given address, or on the loopback interface if the address has no host (e.g.:
+// ":9000".)
+func NewHTTPSource(address string, path string) (*HTTPSource, error) {
+	if path == `` {
+		path = `/`
+	}
+
+	if host, port, err := net.SplitHostPort(address); err == nil && host == `` {
+		address = net.JoinHostPort(`127.0.0.1`, port)
+	}
+
+	if listener, err := net.Listen(`tcp`, address); err == nil {
+		return &HTTPSource{
+			Address:  listener.Addr().String(),
+			Path:     path,
+			listener: listener,
+		}, nil
+	} else {
+		return nil, err
+	}
+}
+
+// Whether requests must be authenticated.
+func (self *HTTPSource) requiresAuth() bool {
+	return self.Server != nil && (self.Server.Token != `` || self.Server.requiresAuth())
+}
+
+// Returns the listener to serve requests on, which uses TLS if the Server has a certificate.
+func (self *HTTPSource) serverListener() (net.Listener, error) {
+	if addr, ok := self.listener.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() && !self.requiresAuth() {
+		return nil, fmt.Errorf("Refusing to accept events on %s without authentication; set a token, basic credentials, or a client CA, or listen on a loopback address", self.Address)
+	}
+
+	if self.Server == nil {
+		return self.listener, nil
+	}
+
+	if config, err := self.Server.serverTLSConfig(); err == nil {
+		if self.Server.TLSEnabled() {
+			if cert, err := tls.LoadX509KeyPair(self.Server.CertFile, self.Server.KeyFile); err == nil {
+				config.Certificates = []tls.Certificate{cert}
+			} else {
+				return nil, err
+			}
+
+			return tls.NewListener(self.listener, config), nil
+		} else if config.ClientCAs != nil {
+			return nil, fmt.Errorf("A certificate and key are required to verify client certificates")
+		}
+
+		return self.listener, nil
+	} else {
+		return nil, err
+	}
+}
+
+// Serves requests until the source is closed.  Requests are answered once their events have been
+// processed.  Events from concurrent requests are processed one at a time.
+func (self *HTTPSource) Read(fn func(data []byte) error) error {
+	listener, err := self.serverListener()
+
+	if err != nil {
+		self.listener.Close()
+		return err
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(self.Path, func(w http.ResponseWriter, req *http.Request) {
+		if self.requiresAuth() && !self.Server.authenticated(req) {
+			self.Server.unauthorized(w)
+			return
+		}
+
+		if req.Method != `POST` {
+			http.Error(w, `Method Not Allowed`, http.StatusMethodNotAllowed)
+			return
+		}
+
+		self.lock.Lock()
+		status, err := ReadEvents(req, fn)
+		self.lock.Unlock()
+
+		if err != nil {
+			http.Error(w, err.Error(), status)
+		} else {
+			w.WriteHeader(status)
+		}
+	})
+
+	err = http.Serve(listener, mux)
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.closed {
+		return nil
+	}
+
+	return err
+}
+
+func (self *HTTPSource) Close() error {
+	self.lock.Lock()
+	self.closed = true
+	self.lock.Unlock()
+
+	return self.listener.Close()
+}
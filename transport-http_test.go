@@ -0,0 +1,431 @@
+package reacter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func bufferedEvents(t *testing.T, buffer *sinkBuffer) []string {
+	batch, events, err := buffer.Peek()
+
+	if err != nil {
+		t.Fatal(err)
+	} else if batch == nil {
+		return nil
+	}
+
+	out := make([]string, len(events))
+
+	for i, event := range events {
+		out[i] = string(event)
+	}
+
+	return out
+}
+
+func TestSinkBuffer(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `reacter-sink-buffer`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		name string
+		dir  string
+	}{
+		{`memory`, ``},
+		{`disk`, dir},
+	} {
+		buffer, err := newSinkBuffer(tt.dir, 0)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buffer.Push([][]byte{[]byte(`{"a":1}`), []byte(`{"a":2}`)})
+		buffer.Push([][]byte{[]byte(`{"b":1}`)})
+		buffer.Push([][]byte{[]byte(`{"c":1}`)})
+
+		if n := buffer.Len(); n != 3 {
+			t.Fatalf("%s: expected 3 batches, got %d", tt.name, n)
+		}
+
+		if events := strings.Join(bufferedEvents(t, buffer), ` `); events != `{"a":1} {"a":2}` {
+			t.Errorf("%s: expected the oldest batch first, got %s", tt.name, events)
+		}
+
+		//  batches are removed by identity, even once they're no longer the oldest
+		second := buffer.batches[1]
+		buffer.Remove(second)
+		buffer.Remove(second)
+
+		if n := buffer.Len(); n != 2 {
+			t.Errorf("%s: expected 2 batches after removing one, got %d", tt.name, n)
+		}
+
+		first, _, _ := buffer.Peek()
+		buffer.Remove(first)
+
+		if events := strings.Join(bufferedEvents(t, buffer), ` `); events != `{"c":1}` {
+			t.Errorf("%s: expected the last batch to remain, got %s", tt.name, events)
+		}
+
+		if tt.dir != `` {
+			//  a new buffer picks up the batches a previous one left behind
+			resumed, err := newSinkBuffer(tt.dir, 0)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if events := strings.Join(bufferedEvents(t, resumed), ` `); resumed.Len() != 1 || events != `{"c":1}` {
+				t.Errorf("%s: expected the undelivered batch to be resumed, got %d batch(es): %s", tt.name, resumed.Len(), events)
+			}
+		}
+
+		last, _, _ := buffer.Peek()
+		buffer.Remove(last)
+
+		if batch, _, _ := buffer.Peek(); batch != nil || buffer.size != 0 {
+			t.Errorf("%s: expected an empty buffer, got %d batch(es) of %d bytes", tt.name, buffer.Len(), buffer.size)
+		}
+	}
+}
+
+func TestSinkBufferDropsOldestWhenFull(t *testing.T) {
+	buffer, err := newSinkBuffer(``, 20)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, event := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`, `{"n":4}`} {
+		buffer.Push([][]byte{[]byte(event)})
+	}
+
+	if n := buffer.Len(); n != 2 {
+		t.Fatalf("expected 2 batches to fit in 20 bytes, got %d", n)
+	}
+
+	if events := strings.Join(bufferedEvents(t, buffer), ` `); events != `{"n":3}` {
+		t.Errorf("expected the oldest batches to be dropped, got %s", events)
+	}
+}
+
+type sinkEndpoint struct {
+	statuses []int
+	requests []string
+	lock     sync.Mutex
+}
+
+func (self *sinkEndpoint) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	status := http.StatusAccepted
+
+	if len(self.statuses) > 0 {
+		status = self.statuses[0]
+		self.statuses = self.statuses[1:]
+	}
+
+	self.requests = append(self.requests, string(body))
+	w.WriteHeader(status)
+}
+
+func (self *sinkEndpoint) received() []string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	return append([]string{}, self.requests...)
+}
+
+func TestHTTPSinkRetries(t *testing.T) {
+	for _, tt := range []struct {
+		statuses []int
+		attempts int
+	}{
+		{[]int{http.StatusAccepted}, 1},
+		{[]int{http.StatusBadRequest}, 1},
+		{[]int{http.StatusUnauthorized}, 1},
+		{[]int{http.StatusUnprocessableEntity}, 1},
+		{[]int{http.StatusRequestTimeout, http.StatusAccepted}, 2},
+		{[]int{http.StatusTooManyRequests, http.StatusAccepted}, 2},
+		{[]int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusAccepted}, 3},
+	} {
+		endpoint := &sinkEndpoint{
+			statuses: append([]int{}, tt.statuses...),
+		}
+
+		server := httptest.NewServer(endpoint)
+		sink, err := NewHTTPSink(server.URL)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sink.BatchSize = 1
+		sink.RetryInterval = time.Millisecond
+		sink.MaxRetryInterval = time.Millisecond
+
+		check := NewCheck()
+		check.Name = `test`
+
+		if err := sink.Write(CheckEvent{Check: check}); err != nil {
+			t.Fatal(err)
+		}
+
+		waitFor(t, fmt.Sprintf("%d attempt(s) for %v", tt.attempts, tt.statuses), func() bool {
+			return len(endpoint.received()) >= tt.attempts && sink.buffer.Len() == 0
+		})
+
+		//  a second event shows that the first batch is no longer holding up the buffer
+		if err := sink.Write(CheckEvent{Check: check}); err != nil {
+			t.Fatal(err)
+		}
+
+		waitFor(t, fmt.Sprintf("the next batch after %v", tt.statuses), func() bool {
+			return len(endpoint.received()) == tt.attempts+1
+		})
+
+		sink.Close()
+		server.Close()
+	}
+}
+
+func TestHTTPSinkWriteDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+
+	defer server.Close()
+	defer close(release)
+
+	sink, err := NewHTTPSink(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink.BatchSize = 1
+	sink.Client.Timeout = 100 * time.Millisecond
+	check := NewCheck()
+	check.Name = `test`
+
+	written := make(chan error)
+
+	go func() {
+		for i := 0; i < 1000; i++ {
+			if err := sink.Write(CheckEvent{Check: check}); err != nil {
+				written <- err
+				return
+			}
+		}
+
+		written <- nil
+	}()
+
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write blocked while the endpoint was not responding")
+	}
+
+	closed := make(chan error)
+
+	go func() {
+		closed <- sink.Close()
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not give up on the unresponsive endpoint")
+	}
+}
+
+func gzipped(data string) string {
+	var body bytes.Buffer
+
+	gz := gzip.NewWriter(&body)
+	gz.Write([]byte(data))
+	gz.Close()
+
+	return body.String()
+}
+
+func TestReadEvents(t *testing.T) {
+	defer func(max int64) {
+		MaxIngestSize = max
+	}(MaxIngestSize)
+
+	MaxIngestSize = 64
+
+	for _, tt := range []struct {
+		name     string
+		body     string
+		encoding string
+		status   int
+		events   []string
+	}{
+		{`single event`, `{"n":1}`, ``, http.StatusAccepted, []string{`{"n":1}`}},
+		{`array`, `[{"n":1}, {"n":2}]`, ``, http.StatusAccepted, []string{`{"n":1}`, `{"n":2}`}},
+		{`ndjson`, "{\"n\":1}\n\n{\"n\":2}\n", ``, http.StatusAccepted, []string{`{"n":1}`, `{"n":2}`}},
+		{`gzip`, gzipped(`[{"n":1}]`), `gzip`, http.StatusAccepted, []string{`{"n":1}`}},
+		{`bad gzip`, `[{"n":1}]`, `gzip`, http.StatusBadRequest, nil},
+		{`bad array`, `[{"n":1}`, ``, http.StatusBadRequest, nil},
+		{`empty`, ``, ``, http.StatusAccepted, nil},
+		{`too large`, `[` + strings.Repeat(`{"n":1},`, 10) + `{"n":1}]`, ``, http.StatusRequestEntityTooLarge, nil},
+		{`one malformed`, "{\"n\":1}\nmalformed\n{\"n\":2}", ``, http.StatusBadRequest, []string{`{"n":1}`, `malformed`, `{"n":2}`}},
+		{`one failed`, "{\"n\":1}\nfail\n{\"n\":2}", ``, http.StatusInternalServerError, []string{`{"n":1}`, `fail`, `{"n":2}`}},
+		{`malformed outranks failed`, "fail\nmalformed", ``, http.StatusBadRequest, []string{`fail`, `malformed`}},
+	} {
+		req := httptest.NewRequest(`POST`, `/`, strings.NewReader(tt.body))
+
+		if tt.encoding != `` {
+			req.Header.Set(`Content-Encoding`, tt.encoding)
+		}
+
+		var events []string
+
+		status, err := ReadEvents(req, func(data []byte) error {
+			events = append(events, string(data))
+
+			switch string(data) {
+			case `malformed`:
+				return PermanentError{fmt.Errorf("not an event")}
+			case `fail`:
+				return fmt.Errorf("handler failed")
+			default:
+				return nil
+			}
+		})
+
+		if status != tt.status {
+			t.Errorf("%s: expected status %d, got %d (%v)", tt.name, tt.status, status, err)
+		} else if (status >= 400) != (err != nil) {
+			t.Errorf("%s: status %d returned with error %v", tt.name, status, err)
+		}
+
+		if strings.Join(events, ` `) != strings.Join(tt.events, ` `) {
+			t.Errorf("%s: expected events %v, got %v", tt.name, tt.events, events)
+		}
+	}
+}
+
+func TestHTTPSourceAuthentication(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		address  string
+		server   func(server *Server)
+		username string
+		password string
+		token    string
+		status   int
+		refused  bool
+	}{
+		{name: `loopback without credentials`, address: `:0`, status: http.StatusAccepted},
+		{name: `any address without credentials`, address: `0.0.0.0:0`, refused: true},
+		{name: `any address with credentials`, address: `0.0.0.0:0`, server: func(s *Server) { s.Token = `s3cr3t` }, token: `s3cr3t`, status: http.StatusAccepted},
+		{name: `missing token`, address: `:0`, server: func(s *Server) { s.Token = `s3cr3t` }, status: http.StatusUnauthorized},
+		{name: `wrong token`, address: `:0`, server: func(s *Server) { s.Token = `s3cr3t` }, token: `guess`, status: http.StatusUnauthorized},
+		{name: `token`, address: `:0`, server: func(s *Server) { s.Token = `s3cr3t` }, token: `s3cr3t`, status: http.StatusAccepted},
+		{name: `missing basic credentials`, address: `:0`, server: func(s *Server) { s.Username, s.Password = `ops`, `pass` }, status: http.StatusUnauthorized},
+		{name: `basic credentials`, address: `:0`, server: func(s *Server) { s.Username, s.Password = `ops`, `pass` }, username: `ops`, password: `pass`, status: http.StatusAccepted},
+		{name: `unreadable client CA`, address: `:0`, server: func(s *Server) { s.ClientCAFile = `/nonexistent/ca.pem` }, refused: true},
+	} {
+		source, err := NewHTTPSource(tt.address, `/events`)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tt.server != nil {
+			source.Server = NewServer(NewReacter())
+			tt.server(source.Server)
+		}
+
+		var events []string
+		served := make(chan error, 1)
+
+		go func() {
+			served <- source.Read(func(data []byte) error {
+				events = append(events, string(data))
+				return nil
+			})
+		}()
+
+		if tt.refused {
+			select {
+			case err := <-served:
+				if err == nil {
+					t.Errorf("%s: expected the source to refuse to listen", tt.name)
+				}
+			case <-time.After(time.Second):
+				t.Errorf("%s: expected the source to refuse to listen", tt.name)
+				source.Close()
+			}
+
+			continue
+		}
+
+		_, port, _ := net.SplitHostPort(source.Address)
+		req, _ := http.NewRequest(`POST`, `http://127.0.0.1:`+port+`/events`, strings.NewReader(`{"n":1}`))
+
+		if tt.username != `` {
+			req.SetBasicAuth(tt.username, tt.password)
+		} else if tt.token != `` {
+			req.Header.Set(`Authorization`, `Bearer `+tt.token)
+		}
+
+		if response, err := http.DefaultClient.Do(req); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else {
+			response.Body.Close()
+
+			if response.StatusCode != tt.status {
+				t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, response.StatusCode)
+			}
+		}
+
+		source.Close()
+
+		if err := <-served; err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+
+		if accepted := len(events) == 1; accepted != (tt.status == http.StatusAccepted) {
+			t.Errorf("%s: expected events to be handled only if accepted, got %v", tt.name, events)
+		}
+	}
+
+	if source, err := NewHTTPSource(`:0`, ``); err != nil {
+		t.Fatal(err)
+	} else if host, _, _ := net.SplitHostPort(source.Address); host != `127.0.0.1` {
+		t.Errorf("expected an address without a host to listen on loopback, got %s", source.Address)
+	} else {
+		source.Close()
+	}
+}
@@ -0,0 +1,273 @@
+package reacter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+func init() {
+	RegisterSink(`stdout`, func(uri *url.URL) (Sink, error) {
+		return NewStreamSink(os.Stdout, nil), nil
+	})
+
+	RegisterSource(`stdin`, func(uri *url.URL) (Source, error) {
+		return NewStreamSource(os.Stdin, nil), nil
+	})
+
+	RegisterSink(`file`, func(uri *url.URL) (Sink, error) {
+		if path, err := uriPath(uri); err == nil {
+			if file, err := os.OpenFile(fileutil.MustExpandUser(path), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); err == nil {
+				return NewStreamSink(file, file), nil
+			} else {
+				return nil, err
+			}
+		} else {
+			return nil, err
+		}
+	})
+
+	RegisterSource(`file`, func(uri *url.URL) (Source, error) {
+		if path, err := uriPath(uri); err == nil {
+			if file, err := os.Open(fileutil.MustExpandUser(path)); err == nil {
+				return NewStreamSource(file, file), nil
+			} else {
+				return nil, err
+			}
+		} else {
+			return nil, err
+		}
+	})
+
+	RegisterSink(`unix`, func(uri *url.URL) (Sink, error) {
+		if path, err := uriPath(uri); err == nil {
+			return &UnixSink{
+				Path: fileutil.MustExpandUser(path),
+			}, nil
+		} else {
+			return nil, err
+		}
+	})
+
+	RegisterSource(`unix`, func(uri *url.URL) (Source, error) {
+		if path, err := uriPath(uri); err == nil {
+			return NewUnixSource(fileutil.MustExpandUser(path))
+		} else {
+			return nil, err
+		}
+	})
+}
+
+// A StreamSink writes each event to a stream as a line of JSON.  The closer (if any) is closed
+// along with the sink.
+type StreamSink struct {
+	writer io.Writer
+	closer io.Closer
+	lock   sync.Mutex
+}
+
+func NewStreamSink(writer io.Writer, closer io.Closer) *StreamSink {
+	return &StreamSink{
+		writer: writer,
+		closer: closer,
+	}
+}
+
+func (self *StreamSink) Write(event CheckEvent) error {
+	if data, err := json.Marshal(event); err == nil {
+		self.lock.Lock()
+		defer self.lock.Unlock()
+
+		_, err = fmt.Fprintf(self.writer, "%s\n", string(data))
+		return err
+	} else {
+		return err
+	}
+}
+
+func (self *StreamSink) Close() error {
+	if self.closer == nil {
+		return nil
+	}
+
+	return self.closer.Close()
+}
+
+// A StreamSource reads events from a stream containing one JSON-encoded event per line.  The closer
+// (if any) is closed along with the source.
+type StreamSource struct {
+	reader io.Reader
+	closer io.Closer
+}
+
+func NewStreamSource(reader io.Reader, closer io.Closer) *StreamSource {
+	return &StreamSource{
+		reader: reader,
+		closer: closer,
+	}
+}
+
+// Reads until the end of the stream, returning an error if any event failed to be processed.
+func (self *StreamSource) Read(fn func(data []byte) error) error {
+	var failed failures
+
+	scanner := bufio.NewScanner(self.reader)
+
+	for scanner.Scan() {
+		failed.call(fn, scanner.Bytes())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return failed.err()
+}
+
+func (self *StreamSource) Close() error {
+	if self.closer == nil {
+		return nil
+	}
+
+	return self.closer.Close()
+}
+
+// A UnixSink writes each event as a line of JSON to a unix socket, (re)connecting as needed.
+type UnixSink struct {
+	Path string
+	conn net.Conn
+	lock sync.Mutex
+}
+
+func (self *UnixSink) Write(event CheckEvent) error {
+	data, err := json.Marshal(event)
+
+	if err != nil {
+		return err
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.conn == nil {
+		if conn, err := net.Dial(`unix`, self.Path); err == nil {
+			self.conn = conn
+		} else {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintf(self.conn, "%s\n", string(data)); err != nil {
+		//  the listener went away; reconnect on the next write
+		self.conn.Close()
+		self.conn = nil
+		return err
+	}
+
+	return nil
+}
+
+func (self *UnixSink) Close() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.conn != nil {
+		err := self.conn.Close()
+		self.conn = nil
+		return err
+	}
+
+	return nil
+}
+
+// A UnixSource listens on a unix socket, and reads events (one JSON-encoded event per line) from
+// every client that connects to it.
+type UnixSource struct {
+	Path     string
+	listener net.Listener
+	lock     sync.Mutex
+}
+
+// Listens on the given socket path.
+func NewUnixSource(path string) (*UnixSource, error) {
+	if listener, err := listenUnix(path, 0); err == nil {
+		return &UnixSource{
+			Path:     path,
+			listener: listener,
+		}, nil
+	} else {
+		return nil, err
+	}
+}
+
+// Accepts connections until the source is closed.  Events from concurrent clients are processed one
+// at a time.
+func (self *UnixSource) Read(fn func(data []byte) error) error {
+	var failed failures
+
+	for {
+		conn, err := self.listener.Accept()
+
+		if err != nil {
+			break
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+
+			scanner := bufio.NewScanner(conn)
+
+			for scanner.Scan() {
+				self.lock.Lock()
+				failed.call(fn, scanner.Bytes())
+				self.lock.Unlock()
+			}
+
+			if err := scanner.Err(); err != nil {
+				log.Warningf("Failed to read from %s: %v", self.Path, err)
+			}
+		}(conn)
+	}
+
+	return failed.err()
+}
+
+func (self *UnixSource) Close() error {
+	return self.listener.Close()
+}
+
+// Listens on the given unix socket path, replacing any stale socket left behind by a previous
+// process.  If given, the socket's permissions are set to mode.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fileutil.Exists(path) {
+		if conn, err := net.Dial(`unix`, path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is already in use", path)
+		} else if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen(`unix`, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	return listener, nil
+}
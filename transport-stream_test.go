@@ -0,0 +1,148 @@
+package reacter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestStreamTransports(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `reacter-stream`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		name string
+		uri  string
+	}{
+		{`file`, `file://` + filepath.Join(dir, `events.json`)},
+		{`unix socket`, `unix://` + filepath.Join(dir, `events.sock`)},
+	} {
+		var lock sync.Mutex
+
+		names := make([]string, 0)
+		expected := []string{`disk`, `load`, `replication_lag`}
+
+		read := func(data []byte) error {
+			var event CheckEvent
+
+			if err := json.Unmarshal(data, &event); err != nil {
+				return PermanentError{err}
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			names = append(names, event.Check.Name)
+			return nil
+		}
+
+		received := func() []string {
+			lock.Lock()
+			defer lock.Unlock()
+
+			return append([]string{}, names...)
+		}
+
+		var source Source
+		var done chan error
+
+		//  a unix socket source has to be listening before anything can be written to it
+		if tt.name == `unix socket` {
+			if source, err = NewSource(tt.uri); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+
+			done = make(chan error)
+
+			go func() {
+				done <- source.Read(read)
+			}()
+		}
+
+		sink, err := NewSink(tt.uri)
+
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		for _, name := range expected {
+			check := NewCheck()
+			check.Name = name
+
+			if err := sink.Write(CheckEvent{Check: check}); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+
+		if err := sink.Close(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+
+		if source == nil {
+			if source, err = NewSource(tt.uri); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+
+			if err := source.Read(read); err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+		} else {
+			waitFor(t, tt.name+` events`, func() bool {
+				return len(received()) == len(expected)
+			})
+		}
+
+		source.Close()
+
+		if done != nil {
+			if err := <-done; err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+		}
+
+		if got := received(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected events %v, got %v", tt.name, expected, got)
+		}
+	}
+}
+
+func TestUnixSourceRefusesSocketInUse(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `reacter-stream`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, `events.sock`)
+	source, err := NewUnixSource(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewUnixSource(path); err == nil {
+		t.Errorf("expected listening on a socket in use to fail")
+	}
+
+	source.Close()
+
+	//  the socket left behind is stale now, so it can be replaced
+	if _, err := os.Stat(path); err == nil {
+		if source, err := NewUnixSource(path); err == nil {
+			source.Close()
+		} else {
+			t.Errorf("expected a stale socket to be replaced: %v", err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package reacter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+// A Sink receives the events emitted by a Reacter (e.g.: by writing them to a file or publishing
+// them to a message broker.)
+type Sink interface {
+	Write(event CheckEvent) error
+	Close() error
+}
+
+// A Source produces serialized events for an EventRouter.  Read calls fn with each event until the
+// source is exhausted or closed.  Sources that can retry delivery (e.g.: message brokers) should do
+// so when fn fails, unless it returns a PermanentError.
+type Source interface {
+	Read(fn func(data []byte) error) error
+	Close() error
+}
+
+type SinkFactory func(uri *url.URL) (Sink, error)
+type SourceFactory func(uri *url.URL) (Source, error)
+
+var sinks = make(map[string]SinkFactory)
+var sources = make(map[string]SourceFactory)
+var transportLock sync.RWMutex
+
+// Registers a factory that creates sinks from URIs with the given scheme.
+func RegisterSink(scheme string, factory SinkFactory) {
+	transportLock.Lock()
+	defer transportLock.Unlock()
+
+	sinks[strings.ToLower(scheme)] = factory
+}
+
+// Registers a factory that creates sources from URIs with the given scheme.
+func RegisterSource(scheme string, factory SourceFactory) {
+	transportLock.Lock()
+	defer transportLock.Unlock()
+
+	sources[strings.ToLower(scheme)] = factory
+}
+
+// Creates a sink from the given URI (e.g.: "stdout://", "file:///var/log/reacter.json", or
+// "amqp://rabbitmq/?exchange=checks".)  A URI of "-" is standard output.
+func NewSink(uri string) (Sink, error) {
+	if uri == `-` {
+		uri = `stdout://`
+	}
+
+	if u, err := url.Parse(uri); err == nil {
+		transportLock.RLock()
+		factory, ok := sinks[strings.ToLower(u.Scheme)]
+		transportLock.RUnlock()
+
+		if ok {
+			return factory(u)
+		} else {
+			return nil, fmt.Errorf("Unsupported output %q (expected one of: %s)", uri, schemes(sinks))
+		}
+	} else {
+		return nil, err
+	}
+}
+
+// Creates a source from the given URI (e.g.: "stdin://", "unix:///run/reacter/events.sock", or
+// "amqp://rabbitmq/?queue=reacter".)  A URI of "-" is standard input.
+func NewSource(uri string) (Source, error) {
+	if uri == `-` {
+		uri = `stdin://`
+	}
+
+	if u, err := url.Parse(uri); err == nil {
+		transportLock.RLock()
+		factory, ok := sources[strings.ToLower(u.Scheme)]
+		transportLock.RUnlock()
+
+		if ok {
+			return factory(u)
+		} else {
+			return nil, fmt.Errorf("Unsupported input %q (expected one of: %s)", uri, schemes(sources))
+		}
+	} else {
+		return nil, err
+	}
+}
+
+func schemes(factories interface{}) string {
+	names := make([]string, 0)
+
+	transportLock.RLock()
+	defer transportLock.RUnlock()
+
+	switch f := factories.(type) {
+	case map[string]SinkFactory:
+		for scheme := range f {
+			names = append(names, scheme+`://`)
+		}
+	case map[string]SourceFactory:
+		for scheme := range f {
+			names = append(names, scheme+`://`)
+		}
+	}
+
+	sort.Strings(names)
+	return strings.Join(names, `, `)
+}
+
+// Returns the path a file or unix socket URI refers to, allowing relative paths to be given as
+// e.g. "file://./events.json".
+func uriPath(uri *url.URL) (string, error) {
+	if path := uri.Host + uri.Path; path != `` {
+		return path, nil
+	} else {
+		return ``, fmt.Errorf("%s:// URIs must include a path", uri.Scheme)
+	}
+}
+
+// Counts the events whose processing failed (logging those that can never be processed), so that
+// sources which can't retry can report failures once they're exhausted.
+type failures struct {
+	count int
+	lock  sync.Mutex
+}
+
+func (self *failures) call(fn func(data []byte) error, data []byte) {
+	if err := fn(data); err != nil {
+		if _, ok := err.(PermanentError); ok {
+			log.Warningf("Failed to parse input line: %v", err)
+		} else {
+			self.lock.Lock()
+			self.count += 1
+			self.lock.Unlock()
+		}
+	}
+}
+
+func (self *failures) err() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.count > 0 {
+		return fmt.Errorf("Encountered %d error(s) while processing events", self.count)
+	}
+
+	return nil
+}
+
+// A Pipe is both a Sink and a Source: events written to it are read from it in the same process,
+// without being written anywhere else.  This is how "reacter" (without a subcommand) connects its
+// checks to its handlers.
+type Pipe struct {
+	events chan []byte
+	done   chan struct{}
+	once   sync.Once
+}
+
+func NewPipe() *Pipe {
+	return &Pipe{
+		events: make(chan []byte),
+		done:   make(chan struct{}),
+	}
+}
+
+// Blocks until the event is read (or the pipe is closed.)
+func (self *Pipe) Write(event CheckEvent) error {
+	if data, err := json.Marshal(event); err == nil {
+		select {
+		case self.events <- data:
+			return nil
+		case <-self.done:
+			return fmt.Errorf("Pipe is closed")
+		}
+	} else {
+		return err
+	}
+}
+
+func (self *Pipe) Read(fn func(data []byte) error) error {
+	var failed failures
+
+	for {
+		select {
+		case data := <-self.events:
+			failed.call(fn, data)
+		case <-self.done:
+			return failed.err()
+		}
+	}
+}
+
+func (self *Pipe) Close() error {
+	self.once.Do(func() {
+		close(self.done)
+	})
+
+	return nil
+}
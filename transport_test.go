@@ -0,0 +1,153 @@
+package reacter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewSinkAndSource(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `reacter-transport`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	events := filepath.Join(dir, `events.json`)
+
+	for _, tt := range []struct {
+		uri    string
+		sink   interface{}
+		source interface{}
+	}{
+		{`-`, &StreamSink{}, &StreamSource{}},
+		{`stdout://`, &StreamSink{}, nil},
+		{`stdin://`, nil, &StreamSource{}},
+		{`file://` + events, &StreamSink{}, &StreamSource{}},
+		{`FILE://` + events, &StreamSink{}, &StreamSource{}},
+		{`unix://` + filepath.Join(dir, `events.sock`), &UnixSink{}, &UnixSource{}},
+		{`file://`, nil, nil},
+		{`carrier-pigeon://coop`, nil, nil},
+	} {
+		if sink, err := NewSink(tt.uri); tt.sink == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error creating a sink", tt.uri)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.uri, err)
+		} else {
+			if reflect.TypeOf(sink) != reflect.TypeOf(tt.sink) {
+				t.Errorf("%s: expected a %T sink, got %T", tt.uri, tt.sink, sink)
+			}
+
+			//  don't close standard output out from under the test binary
+			if tt.uri != `-` && tt.uri != `stdout://` {
+				sink.Close()
+			}
+		}
+
+		if source, err := NewSource(tt.uri); tt.source == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error creating a source", tt.uri)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.uri, err)
+		} else {
+			if reflect.TypeOf(source) != reflect.TypeOf(tt.source) {
+				t.Errorf("%s: expected a %T source, got %T", tt.uri, tt.source, source)
+			}
+
+			if tt.uri != `-` && tt.uri != `stdin://` {
+				source.Close()
+			}
+		}
+	}
+}
+
+func TestPipe(t *testing.T) {
+	pipe := NewPipe()
+	read := make(chan []string)
+
+	go func() {
+		names := make([]string, 0)
+
+		pipe.Read(func(data []byte) error {
+			var event CheckEvent
+
+			if err := json.Unmarshal(data, &event); err != nil {
+				return PermanentError{err}
+			}
+
+			names = append(names, event.Check.Name)
+			return nil
+		})
+
+		read <- names
+	}()
+
+	for _, name := range []string{`disk`, `load`} {
+		check := NewCheck()
+		check.Name = name
+
+		if err := pipe.Write(CheckEvent{Check: check}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pipe.Close()
+
+	if names := <-read; !reflect.DeepEqual(names, []string{`disk`, `load`}) {
+		t.Errorf("expected to read [disk load], got %v", names)
+	}
+
+	if err := pipe.Write(CheckEvent{Check: NewCheck()}); err == nil {
+		t.Errorf("expected writing to a closed pipe to fail")
+	}
+}
+
+func TestStreamSourceFailures(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		err   error
+		fails bool
+	}{
+		{`processed`, nil, false},
+		{`unparseable`, PermanentError{fmt.Errorf("not an event")}, false},
+		{`failed`, fmt.Errorf("handler failed"), true},
+	} {
+		file, err := ioutil.TempFile(``, `reacter-stream`)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer os.Remove(file.Name())
+
+		file.WriteString("{}\n{}\n")
+		file.Seek(0, 0)
+
+		calls := 0
+		err = NewStreamSource(file, file).Read(func(data []byte) error {
+			calls += 1
+			return tt.err
+		})
+
+		if calls != 2 {
+			t.Errorf("%s: expected every line to be read, got %d", tt.name, calls)
+		}
+
+		if tt.fails && err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		} else if !tt.fails && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+
+		file.Close()
+	}
+}
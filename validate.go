@@ -0,0 +1,577 @@
+package reacter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/typeutil"
+	"github.com/ghetzel/reacter/util"
+	"github.com/ghodss/yaml"
+)
+
+var rxYAMLErrorLine = regexp.MustCompile(`line (\d+): (.*)$`)
+var rxJSONErrorField = regexp.MustCompile(`json: cannot unmarshal (.*) into Go struct field \w+\.(\w+)\.(\d+)\.(\w+) of type (.*)$`)
+
+// A ConfigProblem is a mistake found in a configuration file, and where it was found.
+type ConfigProblem struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (self ConfigProblem) String() string {
+	if self.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", self.File, self.Line, self.Message)
+	} else {
+		return fmt.Sprintf("%s: %s", self.File, self.Message)
+	}
+}
+
+// A ConfigValidator loads check and handler configuration files without running anything, and
+// collects every problem it finds in them.
+type ConfigValidator struct {
+	Files      []string
+	Checks     int
+	Handlers   int
+	Problems   []ConfigProblem
+	checks     map[string]string
+	handlers   map[string]string
+	references []configReference
+	reacter    *Reacter
+}
+
+// A name that a handler refers to, which can only be resolved once every file has been loaded.
+type configReference struct {
+	kind    string
+	name    string
+	handler string
+	problem ConfigProblem
+}
+
+func NewConfigValidator() *ConfigValidator {
+	return &ConfigValidator{
+		Files:    make([]string, 0),
+		Problems: make([]ConfigProblem, 0),
+		checks:   make(map[string]string),
+		handlers: make(map[string]string),
+		reacter:  NewReacter(),
+	}
+}
+
+// Loads the given configuration file and directory exactly as "reacter check" and "reacter handle"
+// do, and returns every problem found in them.
+func ValidateConfig(configFile string, configDir string) (*ConfigValidator, error) {
+	validator := NewConfigValidator()
+
+	if err := util.LoadConfigFiles(configFile, configDir, validator); err != nil {
+		return nil, err
+	}
+
+	if len(validator.Files) == 0 {
+		return nil, fmt.Errorf("No configuration found at %s or in %s", configFile, configDir)
+	}
+
+	validator.resolve()
+
+	return validator, nil
+}
+
+// Validates a single configuration file; problems are collected rather than returned so that every
+// file is loaded.
+func (self *ConfigValidator) LoadConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	self.Files = append(self.Files, path)
+
+	var raw map[string]interface{}
+	var checks Config
+	var handlers HandlerConfig
+
+	locator := newConfigLocator(data)
+
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		self.decodeProblem(path, locator, err)
+		return nil
+	}
+
+	topLevel := configKeys(Config{})
+
+	for key := range configKeys(HandlerConfig{}) {
+		topLevel[key] = true
+	}
+
+	self.unknownKeys(path, raw, topLevel, `the top level`, locator.topLevel)
+
+	if redact, ok := raw[`redact`]; ok {
+		self.unknownKeys(path, redact, configKeys(RedactConfig{}), `redact`, func(string) int {
+			return locator.topLevel(`redact`)
+		})
+	}
+
+	checksErr := yaml.Unmarshal(data, &checks)
+	handlersErr := yaml.Unmarshal(data, &handlers)
+
+	for i, item := range configList(raw[`checks`]) {
+		self.unknownKeys(path, item, configKeys(CheckConfig{}), `check '`+configName(item, i)+`'`, func(key string) int {
+			return locator.key(`checks`, i, key)
+		})
+
+		if checksErr == nil && i < len(checks.ChecksDefinitions) {
+			self.validateCheck(path, locator, i, checks.ChecksDefinitions[i])
+		}
+	}
+
+	for i, item := range configList(raw[`handlers`]) {
+		name := `handler '` + configName(item, i) + `'`
+		at := func(key string) int {
+			return locator.key(`handlers`, i, key)
+		}
+
+		self.unknownKeys(path, item, configKeys(Handler{}), name, at)
+
+		if handler, ok := item.(map[string]interface{}); ok {
+			self.unknownKeys(path, handler[`incident`], configKeys(IncidentConfig{}), `the incident of `+name, func(string) int {
+				return at(`incident`)
+			})
+
+			for _, step := range configList(handler[`escalate`]) {
+				self.unknownKeys(path, step, configKeys(EscalationStep{}), `an escalation step of `+name, func(string) int {
+					return at(`escalate`)
+				})
+			}
+		}
+
+		if handlersErr == nil && i < len(handlers.HandlerDefinitions) {
+			self.validateHandler(path, locator, i, &handlers.HandlerDefinitions[i])
+		}
+	}
+
+	if checksErr != nil {
+		self.decodeProblem(path, locator, checksErr)
+	} else if handlersErr != nil {
+		self.decodeProblem(path, locator, handlersErr)
+	}
+
+	return nil
+}
+
+func (self *ConfigValidator) validateCheck(path string, locator *configLocator, i int, check CheckConfig) {
+	line := locator.item(`checks`, i)
+	name := check.Name
+
+	self.Checks += 1
+
+	if name == `` {
+		name = fmt.Sprintf("#%d", i+1)
+		self.problem(path, line, "check %s has no name", name)
+	} else if first, ok := self.checks[name]; ok {
+		self.problem(path, locator.key(`checks`, i, `name`), "duplicate check name '%s' (first defined at %s)", name, first)
+	} else {
+		self.checks[name] = configLocation(path, line)
+	}
+
+	if !check.Passive {
+		if typeutil.IsZero(check.Command) {
+			self.problem(path, line, "check '%s' has no command", name)
+		} else {
+			args, err := (&Check{Command: check.Command}).cmdline()
+
+			if err == nil {
+				err = findExecutable(args, check.Directory)
+			}
+
+			if err != nil {
+				self.problem(path, locator.key(`checks`, i, `command`), "check '%s': %v", name, err)
+			}
+		}
+	}
+
+	size := NewObservations().Size
+
+	if check.Rise > size {
+		self.problem(path, locator.key(`checks`, i, `rise`), "check '%s' rise (%d) is larger than the number of observations kept for it (%d)", name, check.Rise, size)
+	}
+
+	if check.Fall > size {
+		self.problem(path, locator.key(`checks`, i, `fall`), "check '%s' fall (%d) is larger than the number of observations kept for it (%d)", name, check.Fall, size)
+	}
+
+	//  everything else is validated exactly as it is when the check is loaded (rise and fall were
+	//  reported above, and would only be lowered with a warning)
+	check.Rise = 0
+	check.Fall = 0
+
+	if err := self.reacter.AddCheck(check); err != nil {
+		self.problem(path, line, "check '%s': %v", name, err)
+	}
+}
+
+func (self *ConfigValidator) validateHandler(path string, locator *configLocator, i int, handler *Handler) {
+	line := locator.item(`handlers`, i)
+	name := handler.Name
+	at := func(key string) int {
+		return locator.key(`handlers`, i, key)
+	}
+
+	self.Handlers += 1
+
+	if name == `` {
+		name = fmt.Sprintf("#%d", i+1)
+		self.problem(path, line, "handler %s has no name", name)
+	} else if first, ok := self.handlers[name]; ok {
+		self.problem(path, at(`name`), "duplicate handler name '%s' (first defined at %s)", name, first)
+	} else {
+		self.handlers[name] = configLocation(path, line)
+	}
+
+	if !handler.Disable {
+		directory := fileutil.MustExpandUser(handler.Directory)
+
+		if handler.Incident == nil && typeutil.IsZero(handler.Command) {
+			self.problem(path, line, "handler '%s' has neither a command nor an incident endpoint", name)
+		} else if !typeutil.IsZero(handler.Command) {
+			args, err := handler.cmdline(handler.Command)
+
+			if err == nil {
+				err = findExecutable(args, directory)
+			}
+
+			if err != nil {
+				self.problem(path, at(`command`), "handler '%s': %v", name, err)
+			}
+		}
+
+		//  query commands are executed from the current directory
+		if !typeutil.IsZero(handler.QueryCommand) {
+			args, err := handler.cmdline(handler.QueryCommand)
+
+			if err == nil {
+				err = findExecutable(args, ``)
+			}
+
+			if err != nil {
+				self.problem(path, at(`query`), "handler '%s' query: %v", name, err)
+			}
+		}
+	}
+
+	for key, value := range map[string]interface{}{
+		`timeout`:       handler.Timeout,
+		`cooldown`:      handler.Cooldown,
+		`query_timeout`: handler.QueryTimeout,
+		`group_wait`:    handler.GroupWait,
+	} {
+		if _, err := parseDuration(value); err != nil {
+			self.problem(path, at(key), "handler '%s' %s: %v", name, key, err)
+		}
+	}
+
+	for _, check := range handler.CheckNames {
+		self.references = append(self.references, configReference{
+			kind:    `check`,
+			name:    check,
+			handler: name,
+			problem: ConfigProblem{File: path, Line: at(`checks`)},
+		})
+	}
+
+	for _, step := range handler.Escalations {
+		if _, err := parseDuration(step.After); err != nil {
+			self.problem(path, at(`escalate`), "handler '%s' escalation: %v", name, err)
+		}
+
+		for _, next := range step.Handlers {
+			self.references = append(self.references, configReference{
+				kind:    `handler`,
+				name:    next,
+				handler: name,
+				problem: ConfigProblem{File: path, Line: at(`escalate`)},
+			})
+		}
+	}
+}
+
+// Reports references to checks and handlers that weren't defined in any file.  Handlers often run
+// on a different node than the checks they handle, so checks are only verified if any were loaded.
+func (self *ConfigValidator) resolve() {
+	for _, ref := range self.references {
+		switch ref.kind {
+		case `check`:
+			if _, ok := self.checks[ref.name]; !ok && len(self.checks) > 0 {
+				self.problem(ref.problem.File, ref.problem.Line, "handler '%s' refers to check '%s', which is not defined", ref.handler, ref.name)
+			}
+		case `handler`:
+			if _, ok := self.handlers[ref.name]; !ok {
+				self.problem(ref.problem.File, ref.problem.Line, "handler '%s' escalates to handler '%s', which is not defined", ref.handler, ref.name)
+			}
+		}
+	}
+
+	//  report problems in the order the files were loaded, and from the top of each file
+	order := make(map[string]int)
+
+	for i, path := range self.Files {
+		order[path] = i
+	}
+
+	sort.SliceStable(self.Problems, func(i int, j int) bool {
+		a, b := self.Problems[i], self.Problems[j]
+
+		if order[a.File] != order[b.File] {
+			return order[a.File] < order[b.File]
+		}
+
+		return a.Line < b.Line
+	})
+}
+
+func (self *ConfigValidator) problem(path string, line int, format string, args ...interface{}) {
+	self.Problems = append(self.Problems, ConfigProblem{
+		File:    path,
+		Line:    line,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (self *ConfigValidator) unknownKeys(path string, value interface{}, allowed map[string]bool, in string, line func(key string) int) {
+	if values, ok := value.(map[string]interface{}); ok {
+		keys := make([]string, 0, len(values))
+
+		for key := range values {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if !allowed[strings.ToLower(key)] {
+				self.problem(path, line(key), "unknown key '%s' in %s", key, in)
+			}
+		}
+	}
+}
+
+// Reports an error that prevented a file from being decoded, locating it if possible.
+func (self *ConfigValidator) decodeProblem(path string, locator *configLocator, err error) {
+	if match := rxJSONErrorField.FindStringSubmatch(err.Error()); match != nil {
+		i, _ := strconv.Atoi(match[3])
+		self.problem(path, locator.key(match[2], i, match[4]), "%s must be of type %s, not %s", match[4], match[5], match[1])
+	} else if match := rxYAMLErrorLine.FindStringSubmatch(err.Error()); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		self.problem(path, line, "invalid YAML: %s", match[2])
+	} else {
+		self.problem(path, 0, "%v", err)
+	}
+}
+
+// Returns an error unless the program of the given command line is in the PATH (or, if it is a
+// path, exists and is executable.)  Relative paths are resolved against the given directory.
+func findExecutable(args []string, directory string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("command not specified")
+	}
+
+	program := args[0]
+
+	if !strings.Contains(program, `/`) {
+		if _, err := exec.LookPath(program); err != nil {
+			return fmt.Errorf("executable %q was not found in the PATH", program)
+		}
+
+		return nil
+	}
+
+	if !filepath.IsAbs(program) && directory != `` {
+		program = filepath.Join(directory, program)
+	}
+
+	if info, err := os.Stat(program); err != nil {
+		return fmt.Errorf("executable %q does not exist", program)
+	} else if info.IsDir() || info.Mode()&0111 == 0 {
+		return fmt.Errorf("%q is not executable", program)
+	}
+
+	return nil
+}
+
+func configLocation(path string, line int) string {
+	if line > 0 {
+		return fmt.Sprintf("%s:%d", path, line)
+	} else {
+		return path
+	}
+}
+
+// Returns the (lowercase) keys that the given configuration struct is loaded from.
+func configKeys(value interface{}) map[string]bool {
+	keys := make(map[string]bool)
+	kind := reflect.TypeOf(value)
+
+	for i := 0; i < kind.NumField(); i++ {
+		field := kind.Field(i)
+
+		//  unexported fields are never loaded
+		if field.PkgPath != `` {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get(`json`), `,`)[0]
+
+		if name == `-` {
+			continue
+		} else if name == `` {
+			name = field.Name
+		}
+
+		keys[strings.ToLower(name)] = true
+	}
+
+	return keys
+}
+
+func configList(value interface{}) []interface{} {
+	if items, ok := value.([]interface{}); ok {
+		return items
+	}
+
+	return nil
+}
+
+// Returns the name of the given check or handler definition, or its position if it has none.
+func configName(value interface{}, i int) string {
+	if item, ok := value.(map[string]interface{}); ok {
+		if name := typeutil.String(item[`name`]); name != `` {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("#%d", i+1)
+}
+
+// A configLocator finds the lines of a YAML configuration file on which top-level keys, the items
+// of top-level lists, and the keys of those items are defined.  Only block-style YAML is
+// understood; anything it can't find is on line 0.
+type configLocator struct {
+	lines []string
+}
+
+func newConfigLocator(data []byte) *configLocator {
+	return &configLocator{
+		lines: strings.Split(string(data), "\n"),
+	}
+}
+
+// Returns the line on which the given top-level key is defined.
+func (self *configLocator) topLevel(key string) int {
+	for i, line := range self.lines {
+		if indentOf(line) == 0 && isConfigKey(line, key) {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+// Returns the line on which the nth item of the given top-level list starts.
+func (self *configLocator) item(section string, n int) int {
+	if start, _, _ := self.bounds(section, n); start >= 0 {
+		return start + 1
+	}
+
+	return 0
+}
+
+// Returns the line on which the given key of the nth item of the given top-level list is defined,
+// or (if it can't be found) the line on which the item starts.
+func (self *configLocator) key(section string, n int, key string) int {
+	start, end, indent := self.bounds(section, n)
+
+	if start < 0 {
+		return 0
+	}
+
+	for i := start; i < end; i++ {
+		line := self.lines[i]
+
+		if i == start {
+			line = strings.Repeat(` `, indent) + strings.TrimLeft(strings.TrimLeft(line, ` `)[1:], ` `)
+		}
+
+		if indentOf(line) == indent && isConfigKey(line, key) {
+			return i + 1
+		}
+	}
+
+	return start + 1
+}
+
+// Returns the index of the first line of the nth item of the given top-level list, the index of the
+// line after its last one, and the indentation of its keys.  The first index is -1 if there is no
+// such item.
+func (self *configLocator) bounds(section string, n int) (int, int, int) {
+	starts := make([]int, 0)
+	itemIndent := -1
+	end := len(self.lines)
+
+	if first := self.topLevel(section); first > 0 {
+		for i := first; i < len(self.lines); i++ {
+			line := self.lines[i]
+			trimmed := strings.TrimSpace(line)
+
+			if trimmed == `` || strings.HasPrefix(trimmed, `#`) {
+				continue
+			} else if indentOf(line) == 0 && !isListItem(trimmed) {
+				end = i
+				break
+			} else if isListItem(trimmed) && (itemIndent < 0 || indentOf(line) == itemIndent) {
+				itemIndent = indentOf(line)
+				starts = append(starts, i)
+			}
+		}
+	}
+
+	if n >= len(starts) {
+		return -1, -1, 0
+	}
+
+	if n+1 < len(starts) {
+		end = starts[n+1]
+	}
+
+	//  keys are aligned with the first character after the item's "- "
+	item := strings.TrimLeft(self.lines[starts[n]], ` `)[1:]
+	indent := itemIndent + 1 + (len(item) - len(strings.TrimLeft(item, ` `)))
+
+	return starts[n], end, indent
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, ` `))
+}
+
+func isListItem(trimmed string) bool {
+	return trimmed == `-` || strings.HasPrefix(trimmed, `- `)
+}
+
+func isConfigKey(line string, key string) bool {
+	line = strings.TrimSpace(line)
+
+	if strings.HasPrefix(line, key) {
+		return strings.HasPrefix(strings.TrimLeft(line[len(key):], ` `), `:`)
+	}
+
+	return false
+}
@@ -0,0 +1,127 @@
+package reacter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const locatorConfig = `# checks for the database servers
+metadata:
+  role: db
+
+checks:
+- name: replication_lag
+  command: check_lag
+  interval: 30s
+
+  - not an item of checks
+-   name: disk
+    command:
+    - check_disk
+    - -w
+    - 80
+  # a comment between keys
+    timeout: 10s
+handlers:
+  - name: pager
+    query: nodes.sh
+`
+
+func TestConfigLocator(t *testing.T) {
+	locator := newConfigLocator([]byte(locatorConfig))
+
+	for _, tt := range []struct {
+		section string
+		n       int
+		key     string
+		line    int
+	}{
+		{`metadata`, -1, ``, 2},
+		{`checks`, -1, ``, 5},
+		{`handlers`, -1, ``, 18},
+		{`missing`, -1, ``, 0},
+		{`checks`, 0, ``, 6},
+		{`checks`, 1, ``, 11},
+		{`checks`, 2, ``, 0},
+		{`handlers`, 0, ``, 19},
+		{`missing`, 0, ``, 0},
+		{`checks`, 0, `name`, 6},
+		{`checks`, 0, `interval`, 8},
+		{`checks`, 1, `name`, 11},
+		{`checks`, 1, `command`, 12},
+		{`checks`, 1, `timeout`, 17},
+		{`checks`, 1, `interval`, 11},
+		{`handlers`, 0, `query`, 20},
+		{`handlers`, 1, `query`, 0},
+	} {
+		var line int
+
+		if tt.n < 0 {
+			line = locator.topLevel(tt.section)
+		} else if tt.key == `` {
+			line = locator.item(tt.section, tt.n)
+		} else {
+			line = locator.key(tt.section, tt.n, tt.key)
+		}
+
+		if line != tt.line {
+			t.Errorf("%s[%d] %q: expected line %d, got %d", tt.section, tt.n, tt.key, tt.line, line)
+		}
+	}
+}
+
+func TestValidateConfigKeys(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `reacter-validate`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		name     string
+		config   string
+		problems []string
+	}{
+		{
+			name:     `config keys`,
+			config:   "checks:\n- name: disk\n  command: ['true']\n  enabled: false\n  interval: 30s\n  history_size: 10\n",
+			problems: []string{},
+		}, {
+			name:     `misspelled key`,
+			config:   "checks:\n- name: disk\n  command: ['true']\n  intervel: 30s\n",
+			problems: []string{`:4: unknown key 'intervel' in check 'disk'`},
+		}, {
+			name:     `runtime fields`,
+			config:   "checks:\n- name: disk\n  command: ['true']\n  state: 2\n  node_name: db1\n  last_observed_at: 2020-01-01T00:00:00Z\n",
+			problems: []string{`:6: unknown key 'last_observed_at' in check 'disk'`, `:5: unknown key 'node_name' in check 'disk'`, `:4: unknown key 'state' in check 'disk'`},
+		},
+	} {
+		path := filepath.Join(dir, `checks.yml`)
+
+		if err := ioutil.WriteFile(path, []byte(tt.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		validator := NewConfigValidator()
+
+		if err := validator.LoadConfig(path); err != nil {
+			t.Fatal(err)
+		}
+
+		problems := make([]string, 0)
+
+		for _, problem := range validator.Problems {
+			problems = append(problems, strings.TrimPrefix(problem.String(), path))
+		}
+
+		if !reflect.DeepEqual(problems, tt.problems) {
+			t.Errorf("%s: expected problems %q, got %q", tt.name, tt.problems, problems)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package reacter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/typeutil"
+)
+
+var referencePattern = regexp.MustCompile(`\$\{(env|file):([^}]+)\}`)
+
+// A Values map holds configured environment variables or parameters.  Values may refer to secrets
+// stored elsewhere, either inline (e.g.: "Bearer ${env:API_TOKEN}" or "${file:/run/secrets/api}")
+// or as an object (e.g.: {env: API_TOKEN} or {file: /run/secrets/api}).  References are only
+// resolved when a command is executed, so resolved secrets are never serialized, and changes to
+// the referenced files and variables take effect without reloading.
+type Values map[string]string
+
+func (self *Values) UnmarshalJSON(data []byte) error {
+	var raw map[string]interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+
+	values := make(Values, len(raw))
+
+	for k, v := range raw {
+		if value, err := NormalizeValue(v); err == nil {
+			values[k] = typeutil.String(value)
+		} else {
+			return fmt.Errorf("%s: %v", k, err)
+		}
+	}
+
+	*self = values
+	return nil
+}
+
+// Returns the names of all values that refer to secrets stored elsewhere.
+func (self Values) References() []string {
+	keys := make([]string, 0)
+
+	for k, v := range self {
+		if IsReference(v) {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// Returns a copy of these values with all references resolved.
+func (self Values) Resolve() (map[string]string, error) {
+	resolved := make(map[string]string, len(self))
+
+	for k, v := range self {
+		if value, err := ResolveValue(v); err == nil {
+			resolved[k] = value
+		} else {
+			return nil, fmt.Errorf("%s: %v", k, err)
+		}
+	}
+
+	return resolved, nil
+}
+
+// Converts object references (e.g.: {file: /run/secrets/api}) into their inline form; all other
+// values are returned as-is.
+func NormalizeValue(value interface{}) (interface{}, error) {
+	if ref, ok := value.(map[string]interface{}); ok {
+		if len(ref) == 1 {
+			if path, ok := ref[`file`]; ok {
+				return `${file:` + typeutil.String(path) + `}`, nil
+			} else if name, ok := ref[`env`]; ok {
+				return `${env:` + typeutil.String(name) + `}`, nil
+			}
+		}
+
+		return nil, fmt.Errorf("references must specify exactly one of 'file' or 'env'")
+	} else if number, ok := value.(json.Number); ok {
+		return number.String(), nil
+	}
+
+	return value, nil
+}
+
+// Whether the given value refers to a secret stored elsewhere.
+func IsReference(value string) bool {
+	return referencePattern.MatchString(value)
+}
+
+// Replaces every reference in the given value with the contents of the referenced file (without
+// trailing newlines) or environment variable.
+func ResolveValue(value string) (string, error) {
+	var err error
+
+	resolved := referencePattern.ReplaceAllStringFunc(value, func(ref string) string {
+		match := referencePattern.FindStringSubmatch(ref)
+		source, name := match[1], strings.TrimSpace(match[2])
+
+		switch source {
+		case `env`:
+			if v, ok := os.LookupEnv(name); ok {
+				return v
+			} else if err == nil {
+				err = fmt.Errorf("environment variable %s is not set", name)
+			}
+		case `file`:
+			if data, ferr := ioutil.ReadFile(fileutil.MustExpandUser(name)); ferr == nil {
+				return strings.TrimRight(string(data), "\r\n")
+			} else if err == nil {
+				err = ferr
+			}
+		}
+
+		return ``
+	})
+
+	if err != nil {
+		return ``, err
+	}
+
+	return resolved, nil
+}
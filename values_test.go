@@ -0,0 +1,85 @@
+package reacter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveValue(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `reacter-values`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	secret := filepath.Join(dir, `secret`)
+
+	if err := ioutil.WriteFile(secret, []byte("hunter2\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Unsetenv(`REACTER_TEST_TOKEN`)
+	os.Setenv(`REACTER_TEST_TOKEN`, `abc123`)
+	os.Unsetenv(`REACTER_TEST_MISSING`)
+
+	for _, tt := range []struct {
+		value    string
+		expected string
+		fails    bool
+	}{
+		{`plain`, `plain`, false},
+		{``, ``, false},
+		{`${env:REACTER_TEST_TOKEN}`, `abc123`, false},
+		{`Bearer ${env: REACTER_TEST_TOKEN }`, `Bearer abc123`, false},
+		{`${file:` + secret + `}`, `hunter2`, false},
+		{`${env:REACTER_TEST_TOKEN}:${file:` + secret + `}`, `abc123:hunter2`, false},
+		{`${other:REACTER_TEST_TOKEN}`, `${other:REACTER_TEST_TOKEN}`, false},
+		{`$REACTER_TEST_TOKEN`, `$REACTER_TEST_TOKEN`, false},
+		{`${env:REACTER_TEST_MISSING}`, ``, true},
+		{`${file:` + filepath.Join(dir, `missing`) + `}`, ``, true},
+	} {
+		resolved, err := ResolveValue(tt.value)
+
+		if tt.fails {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q", tt.value, resolved)
+			}
+		} else if err != nil {
+			t.Errorf("%q: %v", tt.value, err)
+		} else if resolved != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.value, tt.expected, resolved)
+		}
+	}
+}
+
+func TestValuesUnmarshalJSON(t *testing.T) {
+	for _, tt := range []struct {
+		data     string
+		expected Values
+		fails    bool
+	}{
+		{`{"a":"b","n":42,"f":1.5}`, Values{`a`: `b`, `n`: `42`, `f`: `1.5`}, false},
+		{`{"token":{"env":"API_TOKEN"}}`, Values{`token`: `${env:API_TOKEN}`}, false},
+		{`{"token":{"file":"/run/secrets/api"}}`, Values{`token`: `${file:/run/secrets/api}`}, false},
+		{`{"token":{"env":"A","file":"/b"}}`, nil, true},
+		{`{"token":{}}`, nil, true},
+	} {
+		var values Values
+
+		if err := json.Unmarshal([]byte(tt.data), &values); tt.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", tt.data, values)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.data, err)
+		} else if !reflect.DeepEqual(values, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.data, tt.expected, values)
+		}
+	}
+}